@@ -4,12 +4,17 @@ Copyright © 2025 Ben Webb ben.webb340@gmail.com
 package cmd
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/spf13/cobra"
+	"github.com/webbben/caius/internal/cache"
+	"github.com/webbben/caius/internal/config"
 	"github.com/webbben/caius/internal/metrics"
 	"github.com/webbben/caius/internal/project"
 	"github.com/webbben/caius/internal/utils"
@@ -28,34 +33,114 @@ to quickly create a Cobra application.`,
 	Run: func(cmd *cobra.Command, args []string) {
 		if len(args) == 0 {
 			fmt.Fprintln(os.Stderr, "Usage: a directory or file path is required.")
-			os.Exit(1)
+			exit(1)
 		}
 		path, err := filepath.Abs(args[0])
 		if err != nil {
 			fmt.Fprintln(os.Stderr, "Error resolving path:", err)
-			os.Exit(1)
+			exit(1)
 		}
 
 		fileinfo, err := os.Stat(path)
 		if err != nil {
 			fmt.Fprintln(os.Stderr, "Error getting file information:", err)
-			os.Exit(1)
+			exit(1)
+		}
+
+		format, _ := cmd.Flags().GetString("format")
+		if err := project.ValidateOutputFormat(format); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			exit(1)
+		}
+
+		if cmd.Flags().Changed("jobs") {
+			config.ANALYZE_DIRECTORY_JOBS, _ = cmd.Flags().GetInt("jobs")
+		}
+		if cmd.Flags().Changed("max-map-lines") {
+			config.PROJECT_MAP_MAX_LINES, _ = cmd.Flags().GetInt("max-map-lines")
+		}
+		if cmd.Flags().Changed("max-map-tokens") {
+			config.PROJECT_MAP_MAX_TOKENS, _ = cmd.Flags().GetInt("max-map-tokens")
+		}
+
+		// cache lives in the project root; for single files, that's the root of the project the file is in
+		if noCache, _ := cmd.Flags().GetBool("no-cache"); !noCache {
+			cacheRoot := path
+			if !fileinfo.IsDir() {
+				cacheRoot = cache.FindProjectRoot(filepath.Dir(path))
+			}
+			c, err := cache.Open(cacheRoot)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, "Error opening analysis cache:", err)
+				exit(1)
+			}
+			project.SetAnalysisCache(c)
 		}
 
 		if fileinfo.IsDir() {
-			output, err := project.AnalyzeDirectory(path)
+			requireLLM(cmd.Context(), config.BASIC_FILE_ANALYSIS_MODEL, config.DETECT_FILE_TYPE_MODEL, config.DIRECTORY_SUMMARY_MODEL)
+			op := project.AnalyzeOptions{}
+			op.Resume, _ = cmd.Flags().GetBool("resume")
+			op.KeepGoing, _ = cmd.Flags().GetBool("keep-going")
+			if _, err := os.Stat(project.CheckpointPath(path)); op.Resume && err == nil {
+				utils.Terminal.Lowkey("resuming from the last checkpoint ...")
+			}
+
+			analysis, err := project.AnalyzeDirectory(cmd.Context(), path, op)
+			if err != nil {
+				interrupted := errors.Is(err, context.Canceled)
+				if interrupted {
+					fmt.Fprintln(os.Stderr, "\nanalysis interrupted")
+				} else {
+					fmt.Fprintln(os.Stderr, "\nfailed to analyze directory;", err)
+				}
+				// keep what was done so far; the checkpoint lets the next run skip it
+				if analysis.Partial {
+					if err := project.SaveAnalysis(path, analysis); err != nil {
+						fmt.Fprintln(os.Stderr, "Error saving partial analysis:", err)
+					} else {
+						fmt.Fprintf(os.Stderr, "%v files were analyzed, and the partial analysis was saved to %s\n", len(analysis.Files), project.PartialAnalysisPath(path))
+					}
+					fmt.Fprintf(os.Stderr, "run `caius analyze --resume %s` to continue where it left off\n", args[0])
+				}
+				if interrupted {
+					exit(130)
+				}
+				exit(1)
+			}
+			if err := project.SaveAnalysis(path, analysis); err != nil {
+				fmt.Fprintln(os.Stderr, "Error saving analysis:", err)
+			}
+
+			outFile, _ := cmd.Flags().GetString("out")
+			output, err := analysis.Format(format)
 			if err != nil {
-				fmt.Fprintln(os.Stderr, "\nfailed to analyze directory;", err)
-				os.Exit(1)
+				fmt.Fprintln(os.Stderr, err)
+				exit(1)
+			}
+			if outFile != "" {
+				err = os.WriteFile(outFile, output, 0644)
+				if err != nil {
+					fmt.Fprintln(os.Stderr, "Error writing output file:", err)
+					exit(1)
+				}
+				fmt.Println(analysis.Description)
+				utils.Terminal.Lowkey(fmt.Sprintf("(%s output written to %s)", format, outFile))
+			} else {
+				fmt.Print(string(output))
 			}
-			fmt.Println(output)
 			elapsed := metrics.SpeedRecord("AnalyzeDirectory").GetAverageDuration().Round(time.Second)
 			utils.Terminal.Lowkey(fmt.Sprintf("(%s elapsed)", elapsed))
+			if len(analysis.Failures) > 0 {
+				printFailures(analysis.Failures, args[0])
+			}
 		} else {
+			requireLLM(cmd.Context(), config.BASIC_FILE_ANALYSIS_MODEL, config.DETECT_FILE_TYPE_MODEL)
 			filename := filepath.Base(path)
 			fmt.Printf("Analyzing %s ...\n", filename)
-			response, err := project.AnalyzeFileBasic(path, filename)
+			response, err := project.AnalyzeFileBasic(cmd.Context(), path, filename)
 			if err != nil {
+				exitIfInterrupted(err)
 				fmt.Fprintf(os.Stderr, "failed to analyze file: %q", err)
 			}
 			fmt.Println("file type:", response.Type)
@@ -64,6 +149,15 @@ to quickly create a Cobra application.`,
 	},
 }
 
+// printFailures reports the files that couldn't be analyzed
+func printFailures(failures []project.FileFailure, path string) {
+	fmt.Fprintf(os.Stderr, "\n%v files failed to analyze:\n", len(failures))
+	for _, f := range failures {
+		fmt.Fprintf(os.Stderr, "  %s: %s\n", f.Path, f.Error)
+	}
+	fmt.Fprintf(os.Stderr, "run `caius analyze --resume %s` to retry them\n", path)
+}
+
 func init() {
 	rootCmd.AddCommand(analyzeCmd)
 
@@ -76,4 +170,12 @@ func init() {
 	// Cobra supports local flags which will only run when this command
 	// is called directly, e.g.:
 	// analyzeCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
+	analyzeCmd.Flags().StringP("format", "f", "text", "output format for directory analysis: "+strings.Join(project.OutputFormats, ", "))
+	analyzeCmd.Flags().StringP("out", "o", "", "write the directory analysis to this file instead of stdout")
+	analyzeCmd.Flags().IntP("jobs", "j", config.ANALYZE_DIRECTORY_JOBS, "number of files to analyze in parallel")
+	analyzeCmd.Flags().Int("max-map-lines", config.PROJECT_MAP_MAX_LINES, "max lines in the project map used to describe the project; larger projects have their directories summarized (0 = no limit)")
+	analyzeCmd.Flags().Int("max-map-tokens", config.PROJECT_MAP_MAX_TOKENS, "max estimated tokens in the project map used to describe the project (0 = no limit)")
+	analyzeCmd.Flags().Bool("resume", false, "continue a directory analysis that failed or was interrupted, skipping the files it already analyzed")
+	analyzeCmd.Flags().BoolP("keep-going", "k", false, "don't stop at files that fail to analyze; report them at the end instead")
+	analyzeCmd.Flags().Bool("no-cache", false, "don't read or write cached file analyses (re-analyzes every file)")
 }
@@ -0,0 +1,145 @@
+/*
+Copyright © 2025 Ben Webb ben.webb340@gmail.com
+*/
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+	"github.com/webbben/caius/internal/ask"
+	"github.com/webbben/caius/internal/config"
+	"github.com/webbben/caius/internal/embeddings"
+	"github.com/webbben/caius/internal/project"
+	"github.com/webbben/caius/internal/utils"
+)
+
+// askCmd represents the ask command
+var askCmd = &cobra.Command{
+	Use:   "ask [QUESTION]",
+	Short: "ask questions about an analyzed project",
+	Long: `ask questions about an analyzed project.
+
+Answers are based on the saved analysis of the project (from caius analyze) and the files that are most relevant
+to each question, and cite the files they're based on. Relevant files are found by semantic search if the project
+has an embedding index (from caius search), or by keywords otherwise.
+
+If a question is given, it's answered and caius exits. Otherwise, caius starts a chat where follow up questions
+are answered with the previous questions and answers in mind. Type /reset to start over, or /exit to quit.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		root, _ := cmd.Flags().GetString("project")
+		root, err := filepath.Abs(root)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error resolving path:", err)
+			exit(1)
+		}
+
+		analysis, err := project.LoadAnalysis(root)
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				fmt.Fprintf(os.Stderr, "No saved analysis found for %s. Run `caius analyze %s` first.\n", root, root)
+			} else {
+				fmt.Fprintln(os.Stderr, "Error loading project analysis:", err)
+			}
+			exit(1)
+		}
+		if analysis.Partial {
+			fmt.Fprintf(os.Stderr, "The saved analysis of %s is incomplete, so answers may miss some files. Run `caius analyze --resume %s` to finish it.\n", root, root)
+		}
+		session := ask.NewSession(analysis)
+		requireLLM(cmd.Context(), config.ASK_MODEL)
+		// use semantic search to find relevant files, if the project has been indexed (see caius search)
+		if embeddings.Exists(root) {
+			ix, err := embeddings.Open(root)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, "Error opening embedding index:", err)
+				exit(1)
+			}
+			if len(ix.Files) > 0 {
+				requireLLM(cmd.Context(), config.EMBEDDING_MODEL)
+				session.Retrieve = ask.EmbeddingRetriever(ix, analysis)
+			}
+		}
+
+		if len(args) > 0 {
+			if !askQuestion(cmd.Context(), session, strings.Join(args, " ")) {
+				exit(1)
+			}
+			return
+		}
+
+		fmt.Printf("Ask anything about %s. (/reset to start over, /exit to quit)\n", analysis.Name)
+		// read input in the background, so Ctrl-C at the prompt doesn't have to wait for the next line
+		lines := make(chan string)
+		go func() {
+			scanner := bufio.NewScanner(os.Stdin)
+			for scanner.Scan() {
+				lines <- scanner.Text()
+			}
+			close(lines)
+		}()
+		for {
+			fmt.Print("\n> ")
+			var line string
+			var ok bool
+			select {
+			case line, ok = <-lines:
+			case <-cmd.Context().Done():
+				exit(130)
+			}
+			if !ok {
+				fmt.Println()
+				return
+			}
+			question := strings.TrimSpace(line)
+			switch question {
+			case "":
+				continue
+			case "/exit", "/quit", "exit", "quit":
+				return
+			case "/reset":
+				session.Reset()
+				utils.Terminal.Lowkey("(conversation cleared)")
+				continue
+			}
+			askQuestion(cmd.Context(), session, question)
+		}
+	},
+}
+
+// askQuestion answers a question and prints the answer (as it's generated) along with its sources. Returns false if it failed.
+func askQuestion(ctx context.Context, session *ask.Session, question string) bool {
+	printer := newStreamPrinter()
+	session.Stream = printer.Write
+	answer, err := session.Ask(ctx, question)
+	printer.Done()
+	if err != nil {
+		exitIfInterrupted(err)
+		fmt.Fprintln(os.Stderr, "failed to answer question;", err)
+		return false
+	}
+
+	if len(answer.Citations) > 0 {
+		fmt.Println()
+		color.New(color.Bold).Println("Sources:")
+		for _, path := range answer.Citations {
+			fmt.Println("  " + path)
+		}
+	} else if len(answer.Retrieved) > 0 {
+		utils.Terminal.Lowkey("\nfiles consulted: " + strings.Join(answer.Retrieved, ", "))
+	}
+	return true
+}
+
+func init() {
+	rootCmd.AddCommand(askCmd)
+
+	askCmd.Flags().StringP("project", "p", ".", "root directory of the analyzed project")
+}
@@ -0,0 +1,147 @@
+/*
+Copyright © 2025 Ben Webb ben.webb340@gmail.com
+*/
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/webbben/caius/internal/cache"
+	"github.com/webbben/caius/internal/project"
+	"github.com/webbben/caius/internal/utils"
+)
+
+// cacheCmd represents the cache command
+var cacheCmd = &cobra.Command{
+	Use:   "cache [PATH]",
+	Short: "inspect and manage the file analysis cache of a project",
+	Long: `inspect and manage the file analysis cache of a project.
+
+File analyses are cached under .caius/cache in the project root, keyed by the file's path in the project, its content, the models used and the prompt version.
+Unchanged files are not sent to the LLM again when re-running analyze.
+
+With no subcommand, shows a summary of the cache. PATH defaults to the current directory; the cache of the project it's in is used.`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		c := openCacheOrExit(args)
+		entries, err := c.List()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error reading cache:", err)
+			exit(1)
+		}
+		size, err := c.Size()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error reading cache:", err)
+			exit(1)
+		}
+
+		stale := 0
+		for _, entry := range entries {
+			if project.IsCacheEntryStale(c, entry) {
+				stale++
+			}
+		}
+
+		fmt.Println("cache directory:", c.Dir)
+		fmt.Printf("entries: %v (%v stale)\n", len(entries), stale)
+		fmt.Printf("size: %.1f KB\n", float64(size)/1024)
+		fmt.Println("prompt version:", project.PromptVersion())
+	},
+}
+
+var cacheListCmd = &cobra.Command{
+	Use:   "list [PATH]",
+	Short: "list all cached file analyses",
+	Args:  cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		c := openCacheOrExit(args)
+		entries, err := c.List()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error reading cache:", err)
+			exit(1)
+		}
+
+		for _, entry := range entries {
+			line := fmt.Sprintf("%s  (%s, %s)", entry.FilePath, entry.Model, entry.CreatedAt.Format(time.DateTime))
+			if project.IsCacheEntryStale(c, entry) {
+				utils.Terminal.Lowkey(line + " [stale]")
+			} else {
+				fmt.Println(line)
+			}
+		}
+		fmt.Printf("\n%v entries\n", len(entries))
+	},
+}
+
+var cachePruneCmd = &cobra.Command{
+	Use:   "prune [PATH]",
+	Short: "remove stale cache entries",
+	Long: `remove stale cache entries.
+
+An entry is stale if its file has changed or been deleted, or if it was created with different models or prompts than are currently configured.
+Use --older-than to also remove entries that are older than a given duration (e.g. 720h).`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		olderThan, _ := cmd.Flags().GetDuration("older-than")
+
+		c := openCacheOrExit(args)
+		removed, err := c.Prune(func(entry cache.Entry) bool {
+			if olderThan > 0 && time.Since(entry.CreatedAt) > olderThan {
+				return true
+			}
+			return project.IsCacheEntryStale(c, entry)
+		})
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error pruning cache:", err)
+			exit(1)
+		}
+		fmt.Printf("removed %v entries\n", removed)
+	},
+}
+
+var cacheClearCmd = &cobra.Command{
+	Use:   "clear [PATH]",
+	Short: "remove all cache entries",
+	Args:  cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		c := openCacheOrExit(args)
+		err := c.Clear()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error clearing cache:", err)
+			exit(1)
+		}
+		fmt.Println("cache cleared")
+	},
+}
+
+// openCacheOrExit opens the cache of the project at the path given in args (or the current directory)
+func openCacheOrExit(args []string) *cache.Cache {
+	root := "."
+	if len(args) > 0 {
+		root = args[0]
+	}
+	root, err := filepath.Abs(root)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error resolving path:", err)
+		exit(1)
+	}
+	// use the same cache that analyze does for files in this directory
+	if info, err := os.Stat(root); err == nil && !info.IsDir() {
+		root = filepath.Dir(root)
+	}
+	root = cache.FindProjectRoot(root)
+	return &cache.Cache{Dir: cache.Dir(root), Root: root}
+}
+
+func init() {
+	rootCmd.AddCommand(cacheCmd)
+	cacheCmd.AddCommand(cacheListCmd)
+	cacheCmd.AddCommand(cachePruneCmd)
+	cacheCmd.AddCommand(cacheClearCmd)
+
+	cachePruneCmd.Flags().Duration("older-than", 0, "also remove entries older than this duration (e.g. 720h)")
+}
@@ -0,0 +1,142 @@
+/*
+Copyright © 2025 Ben Webb ben.webb340@gmail.com
+*/
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+	"github.com/webbben/caius/internal/config"
+	"github.com/webbben/caius/internal/llm"
+	"github.com/webbben/caius/internal/utils"
+)
+
+// configCmd represents the config command
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "show and change caius settings",
+	Long: `show and change caius settings.
+
+Settings are read from these places, where later ones take precedence over earlier ones:
+
+  1. the user config file (` + config.UserConfigPath() + `)
+  2. the project config file (` + config.ProjectConfigName + ` in the current directory, or one of its parents)
+  3. environment variables (CAIUS_ followed by the key in upper case, with dots as underscores, e.g. CAIUS_ANALYZE_JOBS;
+     see caius config get --verbose KEY for the exceptions)
+  4. the --set KEY=VALUE flag
+
+Config files are YAML, with each part of a key as a level of nesting, e.g.
+
+  models:
+    basic_file_analysis: deepseek-coder:1.3b
+  analyze:
+    jobs: 4`,
+}
+
+var configListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "list all settings, their values, and where each value came from",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		// not being able to reach the LLM provider shouldn't keep settings from being listed,
+		// so this doesn't start a server; models are only checked if one is already running.
+		installed, modelsErr := llm.GetProvider().ListModels()
+
+		for _, s := range config.Settings() {
+			value := s.Get()
+			if s.Secret && value != "" {
+				value = "********"
+			}
+			line := fmt.Sprintf("%s = %s", s.Key, value)
+			if s.Model && modelsErr == nil && config.ValidateModel(s.Get(), installed) != nil {
+				line += " (not installed)"
+			}
+			fmt.Printf("%-60s %s\n", line, utils.Terminal.LowkeyS("("+s.Source+")"))
+		}
+	},
+}
+
+var configGetCmd = &cobra.Command{
+	Use:   "get KEY",
+	Short: "print the current value of a setting",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		s, err := config.Lookup(args[0])
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			exit(1)
+		}
+		if verbose, _ := cmd.Flags().GetBool("verbose"); verbose {
+			fmt.Printf("%s = %s\n", s.Key, s.Get())
+			fmt.Println("type:", s.Type())
+			fmt.Println("source:", s.Source)
+			fmt.Println("env var:", s.EnvVar())
+			fmt.Println("description:", s.Description)
+			return
+		}
+		fmt.Println(s.Get())
+	},
+}
+
+var configSetCmd = &cobra.Command{
+	Use:   "set KEY VALUE",
+	Short: "save a setting to the user config file (or with --project, the project config file)",
+	Long: `save a setting to the user config file (or with --project, the project config file in the current directory).
+
+Model names are checked against the models that are installed, unless --no-validate is given.`,
+	Args: cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		key, value := args[0], args[1]
+		s, err := config.Lookup(key)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			exit(1)
+		}
+
+		if noValidate, _ := cmd.Flags().GetBool("no-validate"); s.Model && !noValidate {
+			requireLLM(cmd.Context())
+			installed, err := llm.GetProvider().ListModels()
+			if err != nil {
+				fmt.Fprintln(os.Stderr, "Error listing installed models (use --no-validate to skip this check):", err)
+				exit(1)
+			}
+			if err := config.ValidateModel(value, installed); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				exit(1)
+			}
+		}
+
+		path := config.UserConfigPath()
+		if flagPath, _ := cmd.Flags().GetString("config"); flagPath != "" {
+			path = flagPath
+		}
+		if project, _ := cmd.Flags().GetBool("project"); project {
+			path, err = filepath.Abs(config.ProjectConfigName)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, "Error resolving path:", err)
+				exit(1)
+			}
+		}
+
+		if err := config.WriteFile(path, key, value); err != nil {
+			fmt.Fprintln(os.Stderr, "Error saving setting:", err)
+			exit(1)
+		}
+		fmt.Printf("%s = %s\n", key, value)
+		utils.Terminal.Lowkey("(saved to " + path + ")")
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(configCmd)
+	configCmd.AddCommand(configListCmd)
+	configCmd.AddCommand(configGetCmd)
+	configCmd.AddCommand(configSetCmd)
+
+	configGetCmd.Flags().BoolP("verbose", "v", false, "also show where the value came from, and what the setting is for")
+	configSetCmd.Flags().Bool("project", false, "save to the project config file ("+config.ProjectConfigName+") in the current directory")
+	configSetCmd.Flags().Bool("no-validate", false, "don't check that model names are installed")
+}
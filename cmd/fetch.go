@@ -0,0 +1,64 @@
+/*
+Copyright © 2025 Ben Webb ben.webb340@gmail.com
+*/
+package cmd
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/webbben/caius/internal/utils"
+	"github.com/webbben/caius/internal/websearch"
+)
+
+// fetchCmd represents the fetch command
+var fetchCmd = &cobra.Command{
+	Use:   "fetch URL",
+	Short: "fetch a web page, and output its main content",
+	Long: `fetch a web page, and output its main content.
+
+Navigation, footers, cookie banners, comment sections and other boilerplate around the content are left out.
+By default the content is output as plain text; use --markdown to keep its headings, lists, tables, code blocks
+and links, e.g. caius fetch https://go.dev/doc/effective_go --markdown --out effective_go.md`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		u, err := url.Parse(args[0])
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			fmt.Fprintf(os.Stderr, "invalid URL %q (expected an http or https URL)\n", args[0])
+			exit(1)
+		}
+
+		markdown, _ := cmd.Flags().GetBool("markdown")
+		var content string
+		if markdown {
+			content, err = websearch.FetchMarkdown(cmd.Context(), u.String())
+		} else {
+			content, err = websearch.FetchText(cmd.Context(), u.String())
+		}
+		if err != nil {
+			exitIfInterrupted(err)
+			fmt.Fprintln(os.Stderr, "failed to fetch page;", err)
+			exit(1)
+		}
+
+		outFile, _ := cmd.Flags().GetString("out")
+		if outFile == "" {
+			fmt.Println(content)
+			return
+		}
+		if err := os.WriteFile(outFile, []byte(content+"\n"), 0644); err != nil {
+			fmt.Fprintln(os.Stderr, "Error writing output file:", err)
+			exit(1)
+		}
+		utils.Terminal.Lowkey(fmt.Sprintf("(content written to %s)", outFile))
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(fetchCmd)
+
+	fetchCmd.Flags().Bool("markdown", false, "output the content as Markdown")
+	fetchCmd.Flags().StringP("out", "o", "", "file to write the content to, instead of stdout")
+}
@@ -0,0 +1,89 @@
+/*
+Copyright © 2025 Ben Webb ben.webb340@gmail.com
+*/
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/webbben/caius/internal/files"
+	"github.com/webbben/caius/internal/project"
+	"github.com/webbben/caius/internal/utils"
+)
+
+// filesCmd represents the files command
+var filesCmd = &cobra.Command{
+	Use:   "files [PATH]",
+	Short: "list the files of a project that caius will analyze",
+	Long: `list the files of a project that caius will analyze.
+
+Files are skipped if they are dotfiles, in an always-skipped directory (.git, node_modules),
+or matched by a .gitignore or .caiusignore file in the project (full .gitignore syntax; .caiusignore rules take precedence).
+
+Use --explain to show why a specific file is included or skipped. PATH defaults to the current directory.`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		root := "."
+		if len(args) > 0 {
+			root = args[0]
+		}
+		root, err := filepath.Abs(root)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error resolving path:", err)
+			exit(1)
+		}
+
+		explainPath, _ := cmd.Flags().GetString("explain")
+		if explainPath != "" {
+			explainIgnore(root, explainPath)
+			return
+		}
+
+		fileList, err := files.GetProjectFiles(root, project.ProjectFilesOptions)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error listing project files:", err)
+			exit(1)
+		}
+		for _, file := range fileList {
+			rel, _ := filepath.Rel(root, file)
+			fmt.Println(rel)
+		}
+		utils.Terminal.Lowkey(fmt.Sprintf("\n%v files", len(fileList)))
+	},
+}
+
+// explainIgnore prints why a file is included or skipped. A relative path is relative to the project root, not the current directory.
+func explainIgnore(root string, path string) {
+	absPath := path
+	if !filepath.IsAbs(path) {
+		absPath = filepath.Join(root, path)
+	}
+	relPath, err := filepath.Rel(root, absPath)
+	if err != nil || relPath == ".." || strings.HasPrefix(relPath, ".."+string(filepath.Separator)) {
+		fmt.Fprintf(os.Stderr, "%s is not inside the project %s\n", path, root)
+		exit(1)
+	}
+
+	explanation, err := files.ExplainIgnore(root, relPath, project.ProjectFilesOptions)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error explaining path:", err)
+		exit(1)
+	}
+
+	status := "included"
+	if explanation.Ignored {
+		status = "skipped"
+	}
+	fmt.Printf("%s: %s\n", relPath, status)
+	utils.Terminal.Lowkey(explanation.Reason)
+}
+
+func init() {
+	rootCmd.AddCommand(filesCmd)
+
+	filesCmd.Flags().String("explain", "", "explain why the given file (relative to the project root) is included or skipped")
+}
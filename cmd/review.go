@@ -0,0 +1,193 @@
+/*
+Copyright © 2025 Ben Webb ben.webb340@gmail.com
+*/
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+	"github.com/webbben/caius/internal/config"
+	"github.com/webbben/caius/internal/review"
+	"github.com/webbben/caius/internal/utils"
+)
+
+var reviewFormats = []string{"text", "json", "github"}
+
+// reviewCmd represents the review command
+var reviewCmd = &cobra.Command{
+	Use:   "review [FILE]",
+	Short: "have the LLM review a file for bugs, security issues and other problems",
+	Long: `have the LLM review a file for bugs, security issues and other problems.
+
+Each finding has a line range, severity (info, low, medium, high, critical), category, message and suggested fix.
+Use --focus to narrow the review down to a specific area, e.g. --focus security.
+
+With --diff, only the changes in the git repository (the current directory, or FILE) are reviewed:
+all uncommitted changes by default (including untracked files that aren't ignored), only staged changes with --staged,
+or the changes of the current branch since it branched off of another with --base (git diff BASE...HEAD).
+Findings refer to line numbers in the new version of each file; use --format github to output them
+as GitHub Actions annotations.`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		focus, _ := cmd.Flags().GetString("focus")
+		format, _ := cmd.Flags().GetString("format")
+		if err := validateReviewFormat(format); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			exit(1)
+		}
+
+		requireLLM(cmd.Context(), config.CODE_REVIEW_MODEL, config.DETECT_FILE_TYPE_MODEL)
+
+		var results []review.FileReview
+		diff, _ := cmd.Flags().GetBool("diff")
+		if diff {
+			repoDir := "."
+			if len(args) > 0 {
+				repoDir = args[0]
+			}
+			op := review.DiffOptions{}
+			op.Base, _ = cmd.Flags().GetString("base")
+			op.Staged, _ = cmd.Flags().GetBool("staged")
+			if format == "text" {
+				fmt.Println("Reviewing changes ...")
+			}
+			reviews, err := review.ReviewDiff(cmd.Context(), repoDir, op, focus)
+			if err != nil {
+				exitIfInterrupted(err)
+				fmt.Fprintln(os.Stderr, "failed to review changes;", err)
+				exit(1)
+			}
+			results = reviews
+		} else {
+			if len(args) == 0 {
+				fmt.Fprintln(os.Stderr, "Usage: a file path is required (or use --diff to review git changes).")
+				exit(1)
+			}
+			if format == "text" {
+				fmt.Printf("Reviewing %s ...\n", args[0])
+			}
+			result, err := review.ReviewFile(cmd.Context(), args[0], focus)
+			if err != nil {
+				exitIfInterrupted(err)
+				fmt.Fprintln(os.Stderr, "failed to review file;", err)
+				exit(1)
+			}
+			results = []review.FileReview{result}
+		}
+
+		switch format {
+		case "json":
+			// a single file review is output on its own, diff reviews as a list of files
+			var v any = results
+			if !diff {
+				v = results[0]
+			}
+			output, err := json.MarshalIndent(v, "", "  ")
+			if err != nil {
+				fmt.Fprintln(os.Stderr, "Error formatting review:", err)
+				exit(1)
+			}
+			fmt.Println(string(output))
+		case "github":
+			for _, result := range results {
+				printAnnotations(result)
+			}
+		default:
+			if len(results) == 0 {
+				fmt.Println("No changes to review.")
+			}
+			for _, result := range results {
+				printReview(result)
+			}
+		}
+	},
+}
+
+func validateReviewFormat(format string) error {
+	for _, f := range reviewFormats {
+		if f == format {
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown output format %q (expected one of: %s)", format, strings.Join(reviewFormats, ", "))
+}
+
+var severityColors = map[string]*color.Color{
+	"critical": color.New(color.FgRed, color.Bold),
+	"high":     color.New(color.FgRed),
+	"medium":   color.New(color.FgYellow),
+	"low":      color.New(color.FgCyan),
+	"info":     color.New(color.FgHiBlack),
+}
+
+func printReview(result review.FileReview) {
+	if len(result.Findings) == 0 {
+		// with --diff there's one of these for each changed file, so say which one it is
+		fmt.Printf("%s: no problems found\n", result.File)
+		return
+	}
+	for _, f := range result.Findings {
+		lines := fmt.Sprintf("%s:%v", result.File, f.StartLine)
+		if f.EndLine > f.StartLine {
+			lines = fmt.Sprintf("%s-%v", lines, f.EndLine)
+		}
+		severity := severityColors[f.Severity].Sprintf("%-8s", f.Severity)
+		fmt.Printf("\n%s %s %s\n", severity, lines, utils.Terminal.LowkeyS("["+f.Category+"]"))
+		fmt.Println("  " + f.Message)
+		if f.Suggestion != "" {
+			utils.Terminal.Lowkey("  suggestion: " + f.Suggestion)
+		}
+	}
+	utils.Terminal.Lowkey(fmt.Sprintf("\n%v findings", len(result.Findings)))
+}
+
+// annotation levels of GitHub Actions workflow commands for each severity
+var annotationLevels = map[string]string{
+	"critical": "error",
+	"high":     "error",
+	"medium":   "warning",
+	"low":      "notice",
+	"info":     "notice",
+}
+
+// escapeAnnotation escapes text for GitHub Actions workflow commands
+func escapeAnnotation(s string, property bool) string {
+	s = strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A").Replace(s)
+	if property {
+		s = strings.NewReplacer(":", "%3A", ",", "%2C").Replace(s)
+	}
+	return s
+}
+
+// printAnnotations prints findings as GitHub Actions annotations, so they show up on the changed lines of a pull request
+func printAnnotations(result review.FileReview) {
+	for _, f := range result.Findings {
+		message := f.Message
+		if f.Suggestion != "" {
+			message += "\nSuggestion: " + f.Suggestion
+		}
+		fmt.Printf("::%s file=%s,line=%v,endLine=%v,title=%s::%s\n",
+			annotationLevels[f.Severity],
+			escapeAnnotation(result.File, true),
+			f.StartLine,
+			f.EndLine,
+			escapeAnnotation(fmt.Sprintf("%s (%s)", f.Category, f.Severity), true),
+			escapeAnnotation(message, false),
+		)
+	}
+}
+
+func init() {
+	rootCmd.AddCommand(reviewCmd)
+
+	reviewCmd.Flags().String("focus", "", "area to focus the review on, e.g. security, performance")
+	reviewCmd.Flags().StringP("format", "f", "text", "output format: "+strings.Join(reviewFormats, ", "))
+	reviewCmd.Flags().Bool("diff", false, "review the changes in a git repository instead of a whole file")
+	reviewCmd.Flags().String("base", "", "with --diff: review the changes of HEAD since it branched off of this branch or commit")
+	reviewCmd.Flags().Bool("staged", false, "with --diff: review only the staged changes")
+}
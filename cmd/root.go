@@ -4,9 +4,17 @@ Copyright © 2025 Ben Webb ben.webb340@gmail.com
 package cmd
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/spf13/cobra"
+	"github.com/webbben/caius/internal/config"
+	"github.com/webbben/caius/internal/llm"
 )
 
 // rootCmd represents the base command when called without any subcommands
@@ -22,14 +30,114 @@ to quickly create a Cobra application.`,
 	// Uncomment the following line if your bare application
 	// has an action associated with it:
 	// Run: func(cmd *cobra.Command, args []string) { },
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		if err := loadConfig(cmd); err != nil {
+			return err
+		}
+		return setupLLM()
+	},
+}
+
+// loadConfig applies the config files, environment variables and --set/--provider flags to the config package
+func loadConfig(cmd *cobra.Command) error {
+	overrides, _ := cmd.Flags().GetStringArray("set")
+	if provider, _ := cmd.Flags().GetString("provider"); provider != "" {
+		overrides = append(overrides, "llm.provider="+provider)
+	}
+	configPath, _ := cmd.Flags().GetString("config")
+
+	return config.Load(config.LoadOptions{
+		UserConfigPath: configPath,
+		Overrides:      overrides,
+	})
+}
+
+// setupLLM selects the configured LLM provider and retry policy. Nothing is started or pulled yet; commands call requireLLM for that.
+func setupLLM() error {
+	provider, err := llm.ProviderByName(config.LLM_PROVIDER, llm.ProviderOptions{
+		OpenAIBaseURL: config.LLM_OPENAI_BASE_URL,
+		OpenAIAPIKey:  config.LLM_OPENAI_API_KEY,
+	})
+	if err != nil {
+		return err
+	}
+	llm.SetProvider(provider)
+	llm.SetRetryPolicy(llm.RetryPolicy{
+		MaxAttempts:    config.LLM_MAX_ATTEMPTS,
+		InitialBackoff: time.Duration(config.LLM_RETRY_BACKOFF_MS) * time.Millisecond,
+		MaxBackoff:     time.Duration(config.LLM_RETRY_MAX_BACKOFF_MS) * time.Millisecond,
+		Timeout:        time.Duration(config.LLM_TIMEOUT_SECONDS) * time.Second,
+		RepairAttempts: config.LLM_REPAIR_ATTEMPTS,
+	})
+	return nil
+}
+
+// requireLLM gets the LLM provider ready for the given models (starting the ollama server and pulling models if needed),
+// or exits if that fails.
+func requireLLM(ctx context.Context, models ...string) {
+	lastModel := ""
+	err := llm.Require(ctx, func(model string, p llm.PullProgress) {
+		if model != lastModel && lastModel != "" {
+			fmt.Println()
+		}
+		lastModel = model
+		fmt.Printf("\rPulling model %s: %v/%v (%s)", model, p.Completed, p.Total, p.Status)
+	}, models...)
+	if lastModel != "" {
+		fmt.Println()
+	}
+	if err != nil {
+		exitIfInterrupted(err)
+		fmt.Fprintln(os.Stderr, "Error getting the LLM ready:", err)
+		exit(1)
+	}
+}
+
+// exitIfInterrupted exits (with the usual exit code for Ctrl-C) if err is from the command's context being cancelled.
+func exitIfInterrupted(err error) {
+	if errors.Is(err, context.Canceled) {
+		exit(130)
+	}
+}
+
+// exit shuts down anything caius started (e.g. the ollama server) before exiting.
+func exit(code int) {
+	if err := llm.Shutdown(); err != nil {
+		fmt.Fprintln(os.Stderr, "Error shutting down LLM server:", err)
+	}
+	os.Exit(code)
+}
+
+// cancelOnInterrupt cancels the commands' context on Ctrl-C (or a termination signal), so that they can stop what they're doing
+// and save their progress. A second Ctrl-C exits right away. Either way, a server that caius started isn't left behind.
+func cancelOnInterrupt(cancel context.CancelFunc) {
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-signals
+		fmt.Fprintln(os.Stderr, "\ninterrupted; stopping (press Ctrl-C again to quit right away)")
+		cancel()
+		<-signals
+		exit(130)
+	}()
 }
 
 // Execute adds all child commands to the root command and sets flags appropriately.
 // This is called by main.main(). It only needs to happen once to the rootCmd.
 func Execute() {
-	err := rootCmd.Execute()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	cancelOnInterrupt(cancel)
+
+	err := rootCmd.ExecuteContext(ctx)
 	if err != nil {
-		os.Exit(1)
+		exit(1)
+	}
+	if ctx.Err() != nil {
+		exit(130)
+	}
+	if err := llm.Shutdown(); err != nil {
+		fmt.Fprintln(os.Stderr, "Error shutting down LLM server:", err)
 	}
 }
 
@@ -38,7 +146,9 @@ func init() {
 	// Cobra supports persistent flags, which, if defined here,
 	// will be global for your application.
 
-	// rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file (default is $HOME/.caius.yaml)")
+	rootCmd.PersistentFlags().String("config", "", "user config file (default is "+config.UserConfigPath()+")")
+	rootCmd.PersistentFlags().StringArray("set", nil, "override a setting for this run, e.g. --set analyze.jobs=4 (see caius config list)")
+	rootCmd.PersistentFlags().String("provider", "", "LLM backend to use: ollama, openai or fake (same as --set llm.provider=...)")
 
 	// Cobra also supports local flags, which will only run
 	// when this action is called directly.
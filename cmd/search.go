@@ -0,0 +1,127 @@
+/*
+Copyright © 2025 Ben Webb ben.webb340@gmail.com
+*/
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/webbben/caius/internal/config"
+	"github.com/webbben/caius/internal/embeddings"
+	"github.com/webbben/caius/internal/files"
+	"github.com/webbben/caius/internal/project"
+	"github.com/webbben/caius/internal/utils"
+)
+
+// searchCmd represents the search command
+var searchCmd = &cobra.Command{
+	Use:   "search QUERY",
+	Short: "find the files of a project that are most related to a query (semantic search)",
+	Long: `find the files of a project that are most related to a query, e.g. caius search "user authentication".
+
+Files are split into chunks, and each chunk is embedded with an embedding model into a local index (.caius/embeddings.json).
+Before each search the index is updated; only files that are new or have changed since the last search are embedded again.`,
+	Args: cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		root, _ := cmd.Flags().GetString("project")
+		root, err := filepath.Abs(root)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error resolving path:", err)
+			exit(1)
+		}
+		k, _ := cmd.Flags().GetInt("top")
+		if k < 1 {
+			fmt.Fprintf(os.Stderr, "Usage: --top must be at least 1 (got %v).\n", k)
+			exit(1)
+		}
+		chunks, _ := cmd.Flags().GetBool("chunks")
+		asJson, _ := cmd.Flags().GetBool("json")
+
+		requireLLM(cmd.Context(), config.EMBEDDING_MODEL)
+		ix, err := embeddings.Open(root)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error opening embedding index:", err)
+			exit(1)
+		}
+		if noUpdate, _ := cmd.Flags().GetBool("no-update"); !noUpdate {
+			updateIndex(cmd.Context(), ix, !asJson)
+		}
+
+		query := strings.Join(args, " ")
+		var results []embeddings.Result
+		if chunks {
+			results, err = ix.Search(cmd.Context(), query, k)
+		} else {
+			results, err = ix.SearchFiles(cmd.Context(), query, k)
+		}
+		if err != nil {
+			exitIfInterrupted(err)
+			fmt.Fprintln(os.Stderr, "failed to search;", err)
+			exit(1)
+		}
+
+		if asJson {
+			output, err := json.MarshalIndent(results, "", "  ")
+			if err != nil {
+				fmt.Fprintln(os.Stderr, "Error formatting results:", err)
+				exit(1)
+			}
+			fmt.Println(string(output))
+			return
+		}
+		if len(results) == 0 {
+			fmt.Println("No results.")
+		}
+		for _, r := range results {
+			fmt.Printf("%s %s:%v-%v\n", utils.Terminal.LowkeyS(fmt.Sprintf("%.3f", r.Score)), r.Path, r.StartLine, r.EndLine)
+		}
+	},
+}
+
+// updateIndex embeds the project files that have changed since the index was last updated
+func updateIndex(ctx context.Context, ix *embeddings.Index, showProgress bool) {
+	fileList, err := files.GetProjectFiles(ix.Root, project.ProjectFilesOptions)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error listing project files:", err)
+		exit(1)
+	}
+
+	progress := func(done int, total int, path string) {}
+	if showProgress {
+		progress = func(done int, total int, path string) {
+			fmt.Printf("\r\033[2K%s", utils.Terminal.LowkeyS(fmt.Sprintf("indexing [%v/%v] %s", done+1, total, path)))
+		}
+	}
+	stats, err := ix.Update(ctx, fileList, progress)
+	if showProgress {
+		fmt.Print("\r\033[2K")
+	}
+	if err != nil {
+		if errors.Is(err, context.Canceled) {
+			fmt.Fprintf(os.Stderr, "indexing interrupted; %v files were embedded and saved\n", stats.Embedded)
+			exit(130)
+		}
+		fmt.Fprintln(os.Stderr, "failed to update embedding index;", err)
+		exit(1)
+	}
+	if showProgress && (stats.Embedded > 0 || stats.Removed > 0) {
+		utils.Terminal.Lowkey(fmt.Sprintf("(index updated: %v embedded, %v unchanged, %v removed)", stats.Embedded, stats.Unchanged, stats.Removed))
+	}
+}
+
+func init() {
+	rootCmd.AddCommand(searchCmd)
+
+	searchCmd.Flags().StringP("project", "p", ".", "root directory of the project to search")
+	searchCmd.Flags().IntP("top", "k", 10, "number of results")
+	searchCmd.Flags().Bool("chunks", false, "show the best matching chunks, instead of only the best chunk of each file")
+	searchCmd.Flags().Bool("no-update", false, "search the index as it is, without embedding new or changed files first")
+	searchCmd.Flags().Bool("json", false, "output results as JSON")
+}
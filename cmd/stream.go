@@ -0,0 +1,80 @@
+/*
+Copyright © 2025 Ben Webb ben.webb340@gmail.com
+*/
+package cmd
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/webbben/caius/internal/config"
+	"github.com/webbben/caius/internal/llm"
+	"github.com/webbben/caius/internal/utils"
+)
+
+// streamPrinter prints a response to the terminal as it's being generated.
+// The reasoning of reasoning models (e.g. deepseek-r1) is hidden, collapsed into a single line, or shown dimmed,
+// depending on config.OUTPUT_THINKING.
+type streamPrinter struct {
+	filter      llm.ThinkFilter
+	thinkStart  time.Time
+	atLineStart bool // if the cursor is at the start of a line
+}
+
+func newStreamPrinter() *streamPrinter {
+	p := &streamPrinter{atLineStart: true}
+	mode := config.OUTPUT_THINKING
+	p.filter = llm.ThinkFilter{
+		OnThinkStart: func() {
+			p.thinkStart = time.Now()
+			if mode == "collapse" {
+				p.print(utils.Terminal.LowkeyS("thinking..."), "thinking...")
+			}
+		},
+		OnThink: func(chunk string) {
+			if mode == "show" {
+				p.print(utils.Terminal.LowkeyS(chunk), chunk)
+			}
+		},
+		OnThinkEnd: func() {
+			switch mode {
+			case "collapse":
+				fmt.Print("\r\033[2K")
+				utils.Terminal.Lowkey(fmt.Sprintf("(thought for %s)", time.Since(p.thinkStart).Round(time.Second)))
+				p.atLineStart = true
+			case "show":
+				p.endLine()
+				fmt.Println()
+			}
+		},
+		OnAnswer: func(chunk string) {
+			p.print(chunk, chunk)
+		},
+	}
+	return p
+}
+
+// Write takes the next piece of the response; it's meant to be used as an llm.StreamFunc.
+func (p *streamPrinter) Write(chunk string) {
+	p.filter.Write(chunk)
+}
+
+// Done prints anything that's left once the response is done (or has failed), and ends the last line.
+func (p *streamPrinter) Done() {
+	p.filter.Flush()
+	p.endLine()
+}
+
+// print prints s, where raw is s without any colors
+func (p *streamPrinter) print(s string, raw string) {
+	fmt.Print(s)
+	p.atLineStart = strings.HasSuffix(raw, "\n")
+}
+
+func (p *streamPrinter) endLine() {
+	if !p.atLineStart {
+		fmt.Println()
+		p.atLineStart = true
+	}
+}
@@ -4,6 +4,7 @@ Copyright © 2025 Ben Webb ben.webb340@gmail.com
 package cmd
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"path/filepath"
@@ -25,6 +26,11 @@ var testCmd = &cobra.Command{
 		config.SHOW_FUNCTION_METRICS = false
 		config.SHOW_LLM_METRICS = false
 
+		if fake, _ := cmd.Flags().GetBool("fake"); fake {
+			llm.SetProvider(&llm.FakeProvider{})
+		}
+		requireLLM(cmd.Context(), testModels...)
+
 		path := ""
 		if len(args) > 0 {
 			path = args[0]
@@ -47,32 +53,34 @@ var testCmd = &cobra.Command{
 			log.Println("default: short")
 		}
 
-		speedTest(path)
+		speedTest(cmd.Context(), path)
 	},
 }
 
-func speedTest(path string) {
+// models that the speed test compares
+var testModels []string = []string{
+	llm.Models.Llama3, llm.Models.CodeLlama, llm.Models.CodeLlama13b, llm.Models.DeepSeek, llm.Models.DeepSeek14b, llm.Models.DeepSeekCoder, llm.Models.DeepSeekCoder6b,
+}
+
+func speedTest(ctx context.Context, path string) {
 	const N = 10
 
 	var r project.BasicFileAnalysisResponse
 	var err error
 
-	models := []string{
-		llm.Models.Llama3, llm.Models.CodeLlama, llm.Models.CodeLlama13b, llm.Models.DeepSeek, llm.Models.DeepSeek14b, llm.Models.DeepSeekCoder, llm.Models.DeepSeekCoder6b,
-	}
-
-	for _, model := range models {
+	for _, model := range testModels {
 		config.BASIC_FILE_ANALYSIS_MODEL = model
 
 		// "wake up" the model to ensure it's not running slowly on first call
 		utils.Terminal.Lowkey("waking up " + model + "...")
 		llm.SetModel(model)
-		llm.WakeUp()
+		llm.WakeUp(ctx)
 		utils.Terminal.Lowkey("... done")
 
 		for i := range N {
-			r, err = project.AnalyzeFileBasic(path, "index.js")
+			r, err = project.AnalyzeFileBasic(ctx, path, "index.js")
 			if err != nil {
+				exitIfInterrupted(err)
 				panic(err)
 			}
 			utils.Terminal.Lowkey(fmt.Sprintf("Model: %s, Run %v/%v", model, i+1, N))
@@ -86,4 +94,6 @@ func speedTest(path string) {
 
 func init() {
 	rootCmd.AddCommand(testCmd)
+
+	testCmd.Flags().Bool("fake", false, "use the fake LLM provider instead of real models (useful for checking the test harness itself)")
 }
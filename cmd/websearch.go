@@ -4,53 +4,151 @@ Copyright © 2025 NAME HERE <EMAIL ADDRESS>
 package cmd
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
+	"io"
+	"os"
+	"strings"
 
 	"github.com/spf13/cobra"
+	"github.com/webbben/caius/internal/config"
 	"github.com/webbben/caius/internal/utils"
 	"github.com/webbben/caius/internal/websearch"
 )
 
+var websearchFormats = []string{"text", "json"}
+
+// websearchOutput is the output of websearch --format json
+type websearchOutput struct {
+	Query   string              `json:"query"`
+	Results []websearch.Website `json:"results"`
+	Summary string              `json:"summary,omitempty"`
+}
+
 // websearchCmd represents the websearch command
 var websearchCmd = &cobra.Command{
-	Use:   "websearch",
-	Short: "A brief description of your command",
-	Long: `A longer description that spans multiple lines and likely contains examples
-and usage of using your command. For example:
-
-Cobra is a CLI library for Go that empowers applications.
-This application is a tool to generate the needed files
-to quickly create a Cobra application.`,
+	Use:   "websearch [QUERY]",
+	Short: "search the web, and have the LLM summarize what it finds",
+	Long: `search the web, and have the LLM summarize what it finds.
+
+The query is read from stdin if it isn't given as an argument, e.g. echo "golang generics" | caius websearch.
+Each result website is summarized, and then the summaries are combined into a single report;
+use --no-summary to only list the results.
+
+Results come from the search provider set in the websearch.provider setting (brave, searxng or duckduckgo).
+Use --country and --lang to search in a locale (e.g. --country de --lang de), --freshness to only get recent
+results, and --page to get more results of the same query.`,
 	Run: func(cmd *cobra.Command, args []string) {
-		websites, err := websearch.WebSearch("Trump Epstein files")
+		format, _ := cmd.Flags().GetString("format")
+		if err := validateWebsearchFormat(format); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			exit(1)
+		}
+		query, err := readQuery(args)
 		if err != nil {
-			log.Fatal(err)
+			fmt.Fprintln(os.Stderr, err)
+			exit(1)
 		}
 
-		fmt.Printf("found %v websites:\n", len(websites))
-		for _, website := range websites {
-			utils.Terminal.Lowkey(fmt.Sprintf("%s\n%s / %s", website.URL, website.WebsiteName, website.Title))
+		opts := websearch.SearchOptions{}
+		opts.Count, _ = cmd.Flags().GetInt("count")
+		opts.Country, _ = cmd.Flags().GetString("country")
+		opts.Language, _ = cmd.Flags().GetString("lang")
+		opts.Freshness, _ = cmd.Flags().GetString("freshness")
+		opts.Page, _ = cmd.Flags().GetInt("page")
+		if err := opts.Validate(); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			exit(1)
 		}
 
-		output, err := websearch.SummarizeListOfWebsites(websites)
+		noSummary, _ := cmd.Flags().GetBool("no-summary")
+		if !noSummary {
+			requireLLM(cmd.Context(), config.WEBSITE_SUMMARY_MODEL, config.WEBSITE_LIST_SUMMARY_MODEL)
+		}
+
+		websites, err := websearch.WebSearch(cmd.Context(), query, opts)
 		if err != nil {
-			log.Fatal(err)
+			exitIfInterrupted(err)
+			fmt.Fprintln(os.Stderr, "failed to search the web;", err)
+			exit(1)
+		}
+
+		output := websearchOutput{Query: query, Results: websites}
+		if format == "text" {
+			fmt.Printf("found %v websites:\n", len(websites))
+			for _, website := range websites {
+				utils.Terminal.Lowkey(fmt.Sprintf("%s\n%s / %s", website.URL, website.WebsiteName, website.Title))
+			}
+		}
+
+		if !noSummary && len(websites) > 0 {
+			// the report is only streamed to the terminal for text output
+			var printer *streamPrinter
+			var fn func(string)
+			if format == "text" {
+				printer = newStreamPrinter()
+				fn = printer.Write
+			}
+			output.Summary, err = websearch.SummarizeListOfWebsites(cmd.Context(), websites, fn)
+			if printer != nil {
+				printer.Done()
+			}
+			if err != nil {
+				exitIfInterrupted(err)
+				fmt.Fprintln(os.Stderr, "failed to summarize websites;", err)
+				exit(1)
+			}
+		}
+
+		if format == "json" {
+			b, err := json.MarshalIndent(output, "", "  ")
+			if err != nil {
+				fmt.Fprintln(os.Stderr, "Error formatting results:", err)
+				exit(1)
+			}
+			fmt.Println(string(b))
 		}
-		fmt.Println(output)
 	},
 }
 
-func init() {
-	rootCmd.AddCommand(websearchCmd)
+func validateWebsearchFormat(format string) error {
+	for _, f := range websearchFormats {
+		if f == format {
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown output format %q (expected one of: %s)", format, strings.Join(websearchFormats, ", "))
+}
 
-	// Here you will define your flags and configuration settings.
+// readQuery gives the search query from the command's arguments, or from stdin if there are none
+func readQuery(args []string) (string, error) {
+	query := strings.Join(args, " ")
+	if len(args) == 0 {
+		if stat, err := os.Stdin.Stat(); err == nil && stat.Mode()&os.ModeCharDevice != 0 {
+			return "", errors.New("Usage: a search query is required, as an argument or on stdin.")
+		}
+		b, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return "", fmt.Errorf("error reading query from stdin; %w", err)
+		}
+		query = string(b)
+	}
+	query = strings.Join(strings.Fields(query), " ")
+	if query == "" {
+		return "", errors.New("Usage: a search query is required, as an argument or on stdin.")
+	}
+	return query, nil
+}
 
-	// Cobra supports Persistent Flags which will work for this command
-	// and all subcommands, e.g.:
-	// websearchCmd.PersistentFlags().String("foo", "", "A help for foo")
+func init() {
+	rootCmd.AddCommand(websearchCmd)
 
-	// Cobra supports local flags which will only run when this command
-	// is called directly, e.g.:
-	// websearchCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
+	websearchCmd.Flags().IntP("count", "n", websearch.DefaultResultCount, "number of results")
+	websearchCmd.Flags().String("country", "", "two-letter code of the country to get results for, e.g. us")
+	websearchCmd.Flags().String("lang", "", "two-letter code of the language results should be in, e.g. en")
+	websearchCmd.Flags().String("freshness", "", "only get results from the past "+strings.Join(websearch.Freshnesses, ", "))
+	websearchCmd.Flags().Int("page", 0, "page of results to get, starting at 0")
+	websearchCmd.Flags().Bool("no-summary", false, "only list the results, without summarizing them")
+	websearchCmd.Flags().StringP("format", "f", "text", "output format: "+strings.Join(websearchFormats, ", "))
 }
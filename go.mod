@@ -6,9 +6,11 @@ toolchain go1.24.3
 
 require (
 	github.com/fatih/color v1.18.0
+	github.com/ollama/ollama v0.6.8
 	github.com/spf13/cobra v1.9.1
 	github.com/webbben/ollama-wrapper v1.2.0
 	golang.org/x/net v0.42.0
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
@@ -17,7 +19,6 @@ require (
 	github.com/lufia/plan9stats v0.0.0-20211012122336-39d0f177ccd0 // indirect
 	github.com/mattn/go-colorable v0.1.13 // indirect
 	github.com/mattn/go-isatty v0.0.20 // indirect
-	github.com/ollama/ollama v0.6.8 // indirect
 	github.com/power-devops/perfstat v0.0.0-20210106213030-5aafc221ea8c // indirect
 	github.com/shirou/gopsutil/v3 v3.24.5 // indirect
 	github.com/shoenig/go-m1cpu v0.1.6 // indirect
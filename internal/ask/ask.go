@@ -0,0 +1,298 @@
+package ask
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/webbben/caius/internal/config"
+	"github.com/webbben/caius/internal/embeddings"
+	"github.com/webbben/caius/internal/files"
+	"github.com/webbben/caius/internal/llm"
+	"github.com/webbben/caius/internal/metrics"
+	"github.com/webbben/caius/internal/project"
+	"github.com/webbben/caius/internal/utils"
+	"github.com/webbben/caius/prompts"
+)
+
+// Answer is the response to a single question.
+type Answer struct {
+	Text      string
+	Reasoning string   // what the model "thought" before answering, if it's a reasoning model (e.g. deepseek-r1)
+	Citations []string // paths of the project files that are cited in the answer
+	Retrieved []string // paths of the files that were given to the LLM as context
+}
+
+// Session is a conversation about an analyzed project. Each question is answered with the previous questions and answers in mind.
+type Session struct {
+	Analysis project.ProjectAnalysis
+	History  []llm.Message // previous questions and answers (without the retrieved file context)
+	// Retrieve finds the files that are most relevant to a question. Defaults to KeywordRetrieve.
+	Retrieve func(ctx context.Context, query string, k int) ([]project.FileData, error)
+	// Stream, if set, receives each answer piece by piece as it's generated (including the reasoning of reasoning models;
+	// see llm.ThinkFilter).
+	Stream llm.StreamFunc
+}
+
+func NewSession(analysis project.ProjectAnalysis) *Session {
+	s := &Session{Analysis: analysis}
+	s.Retrieve = func(ctx context.Context, query string, k int) ([]project.FileData, error) {
+		return KeywordRetrieve(s.Analysis, query, k), nil
+	}
+	return s
+}
+
+// Reset forgets the previous questions and answers.
+func (s *Session) Reset() {
+	s.History = nil
+}
+
+// systemPrompt gives the instructions, along with the overview of the project
+func (s *Session) systemPrompt() string {
+	return fmt.Sprintf("%s\n\nProject name: %s\nProject description: %s\n\nProject map:\n%s",
+		prompts.P_ASK_01, s.Analysis.Name, strings.TrimSpace(s.Analysis.Description), s.Analysis.ProjectMap)
+}
+
+// Ask answers a question about the project, using the files that are most relevant to it as context.
+func (s *Session) Ask(ctx context.Context, question string) (Answer, error) {
+	start := time.Now()
+	question = strings.TrimSpace(question)
+
+	// follow up questions often don't mention what they're about, so the previous question helps find the relevant files
+	query := question
+	if prev := s.lastQuestion(); prev != "" {
+		query = prev + "\n" + question
+	}
+	relevant, err := s.Retrieve(ctx, query, config.ASK_MAX_FILES)
+	if err != nil {
+		return Answer{}, utils.WrapError("ask: error finding relevant files", err)
+	}
+
+	prompt := fmt.Sprintf("%s\n\nQuestion: %s", s.fileContext(relevant), question)
+	sysPrompt := s.systemPrompt()
+	model := config.ASK_MODEL
+
+	// drop the oldest parts of the conversation if it no longer fits into the context window
+	budget := llm.PromptBudget(model, llm.ResponseTokenReserve, sysPrompt, prompt)
+	history := s.History
+	for len(history) > 0 && historyTokens(history) > budget {
+		history = history[min(2, len(history)):]
+	}
+
+	messages := []llm.Message{{Role: "system", Content: sysPrompt}}
+	messages = append(messages, history...)
+	messages = append(messages, llm.Message{Role: "user", Content: prompt})
+
+	response, err := llm.GenerateChatCompletionStream(ctx, model, messages, s.Stream)
+	if err != nil {
+		return Answer{}, utils.WrapError("ask: error generating answer", err)
+	}
+
+	// the reasoning is left out of the history, so it doesn't take up the context window of follow up questions
+	s.History = append(s.History,
+		llm.Message{Role: "user", Content: question},
+		llm.Message{Role: "assistant", Content: response.Answer},
+	)
+
+	answer := Answer{
+		Text:      response.Answer,
+		Reasoning: response.Reasoning,
+		Citations: FindCitations(response.Answer, s.Analysis.Files),
+	}
+	for _, fd := range relevant {
+		answer.Retrieved = append(answer.Retrieved, fd.Path)
+	}
+
+	metrics.AddSpeedRecord("Ask", start, metrics.FileContext{})
+	return answer, nil
+}
+
+func (s *Session) lastQuestion() string {
+	for i := len(s.History) - 1; i >= 0; i-- {
+		if s.History[i].Role == "user" {
+			return s.History[i].Content
+		}
+	}
+	return ""
+}
+
+func historyTokens(history []llm.Message) int {
+	total := 0
+	for _, m := range history {
+		total += llm.EstimateTokens(m.Content)
+	}
+	return total
+}
+
+// fileContext describes the relevant files for the LLM, including the start of their content
+func (s *Session) fileContext(relevant []project.FileData) string {
+	if len(relevant) == 0 {
+		return "(no files seem to be relevant to this question)"
+	}
+	var sb strings.Builder
+	sb.WriteString("Relevant files:\n")
+	for _, fd := range relevant {
+		fmt.Fprintf(&sb, "\n[%s]\n", fd.Path)
+		if fd.Type != "" {
+			fmt.Fprintf(&sb, "Type: %s\n", fd.Type)
+		}
+		if fd.Description != "" {
+			fmt.Fprintf(&sb, "Description: %s\n", strings.TrimSpace(fd.Description))
+		}
+		if content := readExcerpt(fd, config.ASK_FILE_CONTENT_BYTES); content != "" {
+			fmt.Fprintf(&sb, "Content:\n```\n%s\n```\n", content)
+		}
+	}
+	return sb.String()
+}
+
+// readExcerpt reads the start of a file's content, if it's a text file that can be given to the LLM
+func readExcerpt(fd project.FileData, maxBytes int) string {
+	if fd.SkipLLMProcessing || fd.FullPath == "" || maxBytes <= 0 {
+		return ""
+	}
+	content, err := os.ReadFile(fd.FullPath)
+	if err != nil || files.IsProbablyBinaryData(content) {
+		return ""
+	}
+	if len(content) > maxBytes {
+		return strings.TrimRight(files.TruncateText(string(content), maxBytes), "\n") + "\n... (truncated)"
+	}
+	return strings.TrimRight(string(content), "\n")
+}
+
+// words that show up in most questions, and don't say anything about which files are relevant
+var stopWords map[string]bool = map[string]bool{
+	"the": true, "and": true, "are": true, "for": true, "how": true, "what": true, "where": true, "which": true,
+	"who": true, "why": true, "when": true, "does": true, "this": true, "that": true, "with": true, "from": true,
+	"into": true, "there": true, "they": true, "can": true, "you": true, "file": true, "files": true, "code": true,
+	"project": true, "use": true, "used": true, "uses": true, "any": true, "all": true, "about": true, "have": true,
+	"has": true, "its": true, "than": true, "then": true, "them": true, "should": true, "would": true, "could": true,
+}
+
+// queryTerms splits a query into lowercase search terms, leaving out short and common words
+func queryTerms(query string) []string {
+	words := strings.FieldsFunc(strings.ToLower(query), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	terms := []string{}
+	for _, w := range words {
+		if len(w) < 3 || stopWords[w] || slices.Contains(terms, w) {
+			continue
+		}
+		terms = append(terms, w)
+	}
+	return terms
+}
+
+// KeywordRetrieve finds the (up to) k files of the analysis that best match the query,
+// based on how often the query's words show up in their names, paths, descriptions and directory summaries.
+func KeywordRetrieve(analysis project.ProjectAnalysis, query string, k int) []project.FileData {
+	terms := queryTerms(query)
+	if len(terms) == 0 || k <= 0 {
+		return nil
+	}
+
+	dirScores := map[string]int{}
+	for _, dir := range analysis.Directories {
+		desc := strings.ToLower(dir.Description)
+		for _, term := range terms {
+			if strings.Contains(desc, term) {
+				dirScores[dir.Path]++
+			}
+		}
+	}
+
+	type scoredFile struct {
+		fd    project.FileData
+		score int
+	}
+	scored := []scoredFile{}
+	for _, fd := range analysis.Files {
+		name := strings.ToLower(fd.Filename)
+		path := strings.ToLower(fd.Path)
+		desc := strings.ToLower(fd.Description + " " + fd.Type)
+		score := 0
+		for _, term := range terms {
+			if strings.Contains(name, term) {
+				score += 3
+			} else if strings.Contains(path, term) {
+				score += 2
+			}
+			score += min(strings.Count(desc, term), 3)
+		}
+		score += dirScores[filepath.Dir(fd.Path)]
+		if score > 0 {
+			scored = append(scored, scoredFile{fd: fd, score: score})
+		}
+	}
+
+	sort.SliceStable(scored, func(i, j int) bool {
+		return scored[i].score > scored[j].score
+	})
+	relevant := []project.FileData{}
+	for i := 0; i < len(scored) && i < k; i++ {
+		relevant = append(relevant, scored[i].fd)
+	}
+	return relevant
+}
+
+var citationRegexp = regexp.MustCompile(`\[([^\[\]\n]+)\]`)
+
+// FindCitations gives the paths of the project files that are cited (in square brackets) in the text, in order of appearance.
+func FindCitations(text string, projectFiles []project.FileData) []string {
+	citations := []string{}
+	for _, match := range citationRegexp.FindAllStringSubmatch(text, -1) {
+		cited := strings.Trim(strings.TrimSpace(match[1]), "`")
+		for _, fd := range projectFiles {
+			// also accept paths without the project name at the start
+			_, pathInProject, _ := strings.Cut(fd.Path, "/")
+			if cited == fd.Path || cited == pathInProject {
+				if !slices.Contains(citations, fd.Path) {
+					citations = append(citations, fd.Path)
+				}
+				break
+			}
+		}
+	}
+	return citations
+}
+
+// EmbeddingRetriever finds relevant files with semantic search in the project's embedding index, instead of by keywords.
+// Files that are in the index but not in the analysis (e.g. added since it was made) are still returned, just without descriptions.
+func EmbeddingRetriever(ix *embeddings.Index, analysis project.ProjectAnalysis) func(ctx context.Context, query string, k int) ([]project.FileData, error) {
+	return func(ctx context.Context, query string, k int) ([]project.FileData, error) {
+		results, err := ix.SearchFiles(ctx, query, k)
+		if err != nil {
+			return nil, err
+		}
+		byRelPath := map[string]project.FileData{}
+		for _, fd := range analysis.Files {
+			if rel, err := filepath.Rel(analysis.Root, fd.FullPath); err == nil {
+				byRelPath[filepath.ToSlash(rel)] = fd
+			}
+		}
+
+		relevant := []project.FileData{}
+		for _, r := range results {
+			fd, ok := byRelPath[r.Path]
+			if !ok {
+				fullPath := filepath.Join(analysis.Root, filepath.FromSlash(r.Path))
+				fd = project.FileData{
+					Filename: filepath.Base(fullPath),
+					Path:     filepath.Join(filepath.Base(analysis.Root), filepath.FromSlash(r.Path)),
+					FullPath: fullPath,
+				}
+			}
+			relevant = append(relevant, fd)
+		}
+		return relevant, nil
+	}
+}
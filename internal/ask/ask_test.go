@@ -0,0 +1,166 @@
+package ask
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/webbben/caius/internal/llm"
+	"github.com/webbben/caius/internal/project"
+)
+
+func testAnalysis(t *testing.T) project.ProjectAnalysis {
+	root := t.TempDir()
+	authPath := filepath.Join(root, "internal", "auth.go")
+	os.MkdirAll(filepath.Dir(authPath), 0755)
+	if err := os.WriteFile(authPath, []byte("package internal\n\nfunc Login() {}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return project.ProjectAnalysis{
+		Name:        "app",
+		Root:        root,
+		Description: "A web app.",
+		ProjectMap:  "app/internal/auth.go (go) - handles user login",
+		Files: []project.FileData{
+			{Filename: "README.md", Path: "app/README.md", Type: "markdown", Description: "Explains how to install the app."},
+			{Filename: "auth.go", Path: "app/internal/auth.go", FullPath: authPath, Type: "go", Description: "Handles user login and sessions."},
+			{Filename: "db.go", Path: "app/internal/db.go", Type: "go", Description: "Connects to the database."},
+		},
+		Directories: []project.DirectorySummary{
+			{Path: "app/internal", Description: "Core logic of the app, including the database.", FileCount: 2},
+		},
+	}
+}
+
+func TestKeywordRetrieve(t *testing.T) {
+	analysis := testAnalysis(t)
+
+	relevant := KeywordRetrieve(analysis, "Where is the login handled?", 2)
+	if len(relevant) == 0 || relevant[0].Filename != "auth.go" {
+		t.Errorf("expected auth.go to be most relevant, got %+v", relevant)
+	}
+
+	relevant = KeywordRetrieve(analysis, "how do I install it", 5)
+	if len(relevant) != 1 || relevant[0].Filename != "README.md" {
+		t.Errorf("expected only README.md to be relevant, got %+v", relevant)
+	}
+
+	if relevant = KeywordRetrieve(analysis, "what does this do?", 5); len(relevant) != 0 {
+		t.Errorf("expected no relevant files for a question with only stop words, got %+v", relevant)
+	}
+}
+
+func TestReadExcerpt(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "notes.md")
+	if err := os.WriteFile(path, []byte("# Über\n\nschöne grüße 日本語\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	fd := project.FileData{FullPath: path}
+	for maxBytes := 1; maxBytes < 30; maxBytes++ {
+		if excerpt := readExcerpt(fd, maxBytes); !utf8.ValidString(excerpt) {
+			t.Errorf("maxBytes %v: excerpt splits a character: %q", maxBytes, excerpt)
+		}
+	}
+	// 27 bytes ends in the middle of 日
+	if excerpt := readExcerpt(fd, 27); excerpt != "# Über\n\nschöne grüße \n... (truncated)" {
+		t.Errorf("unexpected excerpt %q", excerpt)
+	}
+}
+
+func TestFindCitations(t *testing.T) {
+	analysis := testAnalysis(t)
+	text := "Login is in [app/internal/auth.go], see also [internal/db.go] and [app/internal/auth.go]. [made/up.go] isn't real."
+	citations := FindCitations(text, analysis.Files)
+	expected := []string{"app/internal/auth.go", "app/internal/db.go"}
+	if !slices.Equal(citations, expected) {
+		t.Errorf("expected citations %v, got %v", expected, citations)
+	}
+}
+
+func TestSessionAsk(t *testing.T) {
+	prev := llm.GetProvider()
+	t.Cleanup(func() { llm.SetProvider(prev) })
+
+	var requests [][]llm.Message
+	fake := &llm.FakeProvider{}
+	llm.SetProvider(&chatRecorder{FakeProvider: fake, requests: &requests})
+	fake.Respond = func(req llm.CompletionRequest, schema json.RawMessage) (string, error) {
+		return "Login is handled in [app/internal/auth.go].", nil
+	}
+
+	session := NewSession(testAnalysis(t))
+	answer, err := session.Ask(context.Background(), "Where is login handled?")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(answer.Citations, []string{"app/internal/auth.go"}) {
+		t.Errorf("unexpected citations: %v", answer.Citations)
+	}
+	if len(answer.Retrieved) == 0 || answer.Retrieved[0] != "app/internal/auth.go" {
+		t.Errorf("expected auth.go to be retrieved first, got %v", answer.Retrieved)
+	}
+	question := requests[0][len(requests[0])-1].Content
+	if !strings.Contains(question, "func Login() {}") {
+		t.Errorf("expected the content of the relevant file in the question:\n%s", question)
+	}
+
+	// follow up questions include the previous conversation, but not the previous file context
+	_, err = session.Ask(context.Background(), "And sessions?")
+	if err != nil {
+		t.Fatal(err)
+	}
+	messages := requests[1]
+	if len(messages) != 4 || messages[1].Content != "Where is login handled?" || messages[2].Role != "assistant" {
+		t.Fatalf("expected system prompt, previous question and answer, and new question; got %+v", messages)
+	}
+
+	session.Reset()
+	if len(session.History) != 0 {
+		t.Errorf("expected history to be cleared")
+	}
+}
+
+// chatRecorder records the messages of every chat request
+type chatRecorder struct {
+	*llm.FakeProvider
+	requests *[][]llm.Message
+}
+
+func (c *chatRecorder) Chat(ctx context.Context, req llm.ChatRequest) (string, error) {
+	*c.requests = append(*c.requests, req.Messages)
+	return c.FakeProvider.Chat(ctx, req)
+}
+
+func TestSessionAskStream(t *testing.T) {
+	prev := llm.GetProvider()
+	t.Cleanup(func() { llm.SetProvider(prev) })
+	llm.SetProvider(&llm.FakeProvider{
+		Respond: func(req llm.CompletionRequest, schema json.RawMessage) (string, error) {
+			return "<think>auth.go looks relevant</think>\n\nLogin is handled in [app/internal/auth.go].", nil
+		},
+	})
+
+	session := NewSession(testAnalysis(t))
+	streamed := ""
+	session.Stream = func(chunk string) {
+		streamed += chunk
+	}
+	answer, err := session.Ask(context.Background(), "Where is login handled?")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(streamed, "<think>") || !strings.HasSuffix(streamed, answer.Text) {
+		t.Errorf("expected the whole response to be streamed, got %q", streamed)
+	}
+	if answer.Text != "Login is handled in [app/internal/auth.go]." || answer.Reasoning != "auth.go looks relevant" {
+		t.Errorf("expected the reasoning to be separated from the answer, got %+v", answer)
+	}
+	if len(session.History) != 2 || session.History[1].Content != answer.Text {
+		t.Errorf("expected only the answer in the history, got %+v", session.History)
+	}
+}
@@ -0,0 +1,223 @@
+package cache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/webbben/caius/internal/config"
+)
+
+// Cache is an on-disk store of analysis results, so that we don't have to re-run expensive LLM calls on files that haven't changed.
+// Each entry is stored as its own JSON file, named after its key.
+type Cache struct {
+	Dir  string
+	Root string // absolute path of the project root the cache belongs to
+}
+
+type Entry struct {
+	Key           string
+	FilePath      string // absolute path of the file this entry was generated for
+	ContentHash   string
+	Model         string
+	PromptVersion string
+	CreatedAt     time.Time
+	Data          json.RawMessage
+}
+
+// Dir returns the cache directory for a project root
+func Dir(projectRoot string) string {
+	return filepath.Join(projectRoot, ".caius", "cache")
+}
+
+// Open opens (and creates, if needed) the cache for the given project root.
+func Open(projectRoot string) (*Cache, error) {
+	root, err := filepath.Abs(projectRoot)
+	if err != nil {
+		return nil, err
+	}
+	dir := Dir(root)
+	err = os.MkdirAll(dir, 0755)
+	if err != nil {
+		return nil, errors.Join(errors.New("cache: failed to create cache directory;"), err)
+	}
+	return &Cache{Dir: dir, Root: root}, nil
+}
+
+// FindProjectRoot gives the root of the project that dir is in: the closest of dir and its parent directories
+// that has a .caius directory, a project config file or a .git directory. If there isn't one, dir itself is the root.
+func FindProjectRoot(dir string) string {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return dir
+	}
+	for d := dir; ; {
+		for _, marker := range []string{".caius", config.ProjectConfigName, ".git"} {
+			if _, err := os.Stat(filepath.Join(d, marker)); err == nil {
+				return d
+			}
+		}
+		parent := filepath.Dir(d)
+		if parent == d {
+			return dir
+		}
+		d = parent
+	}
+}
+
+// HashContent gives the hex encoded sha256 hash of some data.
+func HashContent(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+// Key combines all the inputs that affect an analysis result into a single cache key.
+func Key(parts ...string) string {
+	return HashContent([]byte(strings.Join(parts, "\x00")))
+}
+
+func (c *Cache) entryPath(key string) string {
+	return filepath.Join(c.Dir, key+".json")
+}
+
+// Get loads the entry for the given key into v. Returns false if there is no entry.
+func (c *Cache) Get(key string, v any) (bool, error) {
+	entry, found, err := c.getEntry(key)
+	if err != nil || !found {
+		return false, err
+	}
+	err = json.Unmarshal(entry.Data, v)
+	if err != nil {
+		return false, errors.Join(errors.New("cache: failed to unmarshal entry data;"), err)
+	}
+	return true, nil
+}
+
+func (c *Cache) getEntry(key string) (Entry, bool, error) {
+	b, err := os.ReadFile(c.entryPath(key))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return Entry{}, false, nil
+		}
+		return Entry{}, false, err
+	}
+	var entry Entry
+	err = json.Unmarshal(b, &entry)
+	if err != nil {
+		return Entry{}, false, errors.Join(errors.New("cache: failed to unmarshal entry "+key+";"), err)
+	}
+	return entry, true, nil
+}
+
+// Put stores v as the data for the given entry. entry.Key must be set.
+func (c *Cache) Put(entry Entry, v any) error {
+	if entry.Key == "" {
+		return errors.New("cache: entry has no key")
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	entry.Data = data
+	if entry.CreatedAt.IsZero() {
+		entry.CreatedAt = time.Now()
+	}
+
+	b, err := json.MarshalIndent(entry, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// write to a temp file first, so that an interrupted write doesn't leave a corrupted entry behind
+	tmp := c.entryPath(entry.Key) + ".tmp"
+	err = os.WriteFile(tmp, b, 0644)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp, c.entryPath(entry.Key))
+}
+
+// List returns all entries in the cache, sorted by file path.
+func (c *Cache) List() ([]Entry, error) {
+	dirEntries, err := os.ReadDir(c.Dir)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return []Entry{}, nil
+		}
+		return nil, err
+	}
+
+	entries := []Entry{}
+	for _, d := range dirEntries {
+		key, isEntry := strings.CutSuffix(d.Name(), ".json")
+		if d.IsDir() || !isEntry {
+			continue
+		}
+		entry, found, err := c.getEntry(key)
+		if err != nil {
+			return nil, err
+		}
+		if found {
+			entries = append(entries, entry)
+		}
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].FilePath == entries[j].FilePath {
+			return entries[i].CreatedAt.Before(entries[j].CreatedAt)
+		}
+		return entries[i].FilePath < entries[j].FilePath
+	})
+	return entries, nil
+}
+
+// Prune removes every entry for which shouldRemove returns true, and returns the number of entries removed.
+func (c *Cache) Prune(shouldRemove func(Entry) bool) (int, error) {
+	entries, err := c.List()
+	if err != nil {
+		return 0, err
+	}
+	removed := 0
+	for _, entry := range entries {
+		if !shouldRemove(entry) {
+			continue
+		}
+		err = os.Remove(c.entryPath(entry.Key))
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return removed, err
+		}
+		removed++
+	}
+	return removed, nil
+}
+
+// Clear removes all entries in the cache.
+func (c *Cache) Clear() error {
+	return os.RemoveAll(c.Dir)
+}
+
+// Size returns the total number of bytes used by the cache on disk.
+func (c *Cache) Size() (int64, error) {
+	var size int64 = 0
+	dirEntries, err := os.ReadDir(c.Dir)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return 0, nil
+		}
+		return 0, err
+	}
+	for _, d := range dirEntries {
+		info, err := d.Info()
+		if err != nil {
+			return 0, err
+		}
+		size += info.Size()
+	}
+	return size, nil
+}
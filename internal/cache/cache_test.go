@@ -0,0 +1,101 @@
+package cache
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+type testData struct {
+	Description string
+}
+
+func TestPutGet(t *testing.T) {
+	c, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key := Key(HashContent([]byte("package main")), "main.go", "model", "v1")
+	var got testData
+	found, err := c.Get(key, &got)
+	if err != nil || found {
+		t.Fatalf("expected empty cache, got found=%v err=%v", found, err)
+	}
+
+	err = c.Put(Entry{Key: key, FilePath: "/tmp/main.go", Model: "model"}, testData{Description: "a go program"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	found, err = c.Get(key, &got)
+	if err != nil || !found {
+		t.Fatalf("expected cache hit, got found=%v err=%v", found, err)
+	}
+	if got.Description != "a go program" {
+		t.Errorf("unexpected data: %+v", got)
+	}
+
+	// different model should give a different key
+	if Key(HashContent([]byte("package main")), "main.go", "other-model", "v1") == key {
+		t.Error("key should change when the model changes")
+	}
+}
+
+func TestListPruneClear(t *testing.T) {
+	c, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"b.go", "a.go", "c.go"} {
+		err = c.Put(Entry{Key: Key(name), FilePath: name}, testData{Description: name})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	entries, err := c.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 3 || entries[0].FilePath != "a.go" {
+		t.Fatalf("expected 3 entries sorted by path, got %+v", entries)
+	}
+
+	removed, err := c.Prune(func(e Entry) bool { return e.FilePath == "b.go" })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if removed != 1 {
+		t.Errorf("expected 1 entry removed, got %v", removed)
+	}
+
+	err = c.Clear()
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries, err = c.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("expected empty cache after clear, got %v entries", len(entries))
+	}
+}
+
+func TestFindProjectRoot(t *testing.T) {
+	root := t.TempDir()
+	dir := filepath.Join(root, "src", "pkg")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	// no markers: the directory itself is the root
+	if found := FindProjectRoot(dir); found != dir {
+		t.Errorf("expected %s, got %s", dir, found)
+	}
+	if err := os.Mkdir(filepath.Join(root, ".git"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if found := FindProjectRoot(dir); found != root {
+		t.Errorf("expected %s, got %s", root, found)
+	}
+}
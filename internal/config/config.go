@@ -1,3 +1,8 @@
+// Package config holds caius' settings.
+//
+// Every setting has a compiled-in default here, which can be overridden (in order of precedence, lowest first) by
+// the user config file (~/.config/caius/config.yaml), the project config file (.caius.yaml), CAIUS_* environment
+// variables, and the --set flag. See settings.go for the keys each setting is configured by.
 package config
 
 import "github.com/webbben/caius/internal/llm"
@@ -7,14 +12,102 @@ import "github.com/webbben/caius/internal/llm"
 // Max number of bytes to analyse for basic file analysis
 // Setting this number lower will result in slightly faster file analyses,
 // but also lower accuracy if you set it too low.
-const MAX_BYTES_BASIC_ANALYSIS int = 1000
+var MAX_BYTES_BASIC_ANALYSIS int = 1000
+
+// Number of files AnalyzeDirectory analyzes in parallel.
+// To actually benefit from more than 1, ollama needs to be able to serve parallel requests (see OLLAMA_NUM_PARALLEL).
+var ANALYZE_DIRECTORY_JOBS int = 1
+
+// Budget for the project map that is given to DescribeProject at the end of AnalyzeDirectory.
+// If the map of all files is larger than this, lower level directories are summarized and "compressed" into a single line.
+// 0 means no limit.
+var PROJECT_MAP_MAX_LINES int = 150
+var PROJECT_MAP_MAX_TOKENS int = 6000
+
+// OUTPUT
+
+// What to do with the reasoning of reasoning models (the <think> block of deepseek-r1) when a response is streamed to the terminal:
+// "hide" it, "collapse" it into a single line while the model is thinking, or "show" it dimmed.
+var OUTPUT_THINKING string = "collapse"
 
 // DEBUG CONFIG
 
 var SHOW_FUNCTION_METRICS bool = false
 var SHOW_LLM_METRICS bool = true
 
+// LLM
+
+// Backend that LLM calls are sent to: ollama, openai, or fake (no server needed, e.g. for CI)
+var LLM_PROVIDER string = "ollama"
+
+// Base URL and API key of the OpenAI compatible API used by the openai provider (e.g. llama.cpp, vLLM or LM Studio)
+var LLM_OPENAI_BASE_URL string = "http://localhost:8080/v1"
+var LLM_OPENAI_API_KEY string = ""
+
+// Retry policy for LLM calls (see llm.RetryPolicy).
+// Failed calls are attempted up to LLM_MAX_ATTEMPTS times, waiting LLM_RETRY_BACKOFF_MS before the first retry,
+// and twice as long before each one after that (up to LLM_RETRY_MAX_BACKOFF_MS).
+var LLM_MAX_ATTEMPTS int = 3
+var LLM_RETRY_BACKOFF_MS int = 1000
+var LLM_RETRY_MAX_BACKOFF_MS int = 30_000
+
+// Max seconds a single LLM call can take before it's cancelled (and retried). 0 means no limit.
+var LLM_TIMEOUT_SECONDS int = 300
+
+// Number of times an invalid JSON response is sent back to the model to be fixed, before giving up
+var LLM_REPAIR_ATTEMPTS int = 1
+
 // LLM MODELS
 
 var BASIC_FILE_ANALYSIS_MODEL = llm.Models.DeepSeekCoder
 var DETECT_FILE_TYPE_MODEL = llm.Models.DeepSeekCoder
+var DIRECTORY_SUMMARY_MODEL = llm.Models.DeepSeek
+var CODE_REVIEW_MODEL = llm.Models.DeepSeek
+var ASK_MODEL = llm.Models.DeepSeek
+var EMBEDDING_MODEL = llm.Models.NomicEmbed
+var WEBSITE_SUMMARY_MODEL = llm.Models.Llama3
+var WEBSITE_LIST_SUMMARY_MODEL = llm.Models.DeepSeek14b
+
+// REVIEW - reviewing code
+
+// Number of unchanged lines shown before and after each changed section when reviewing a diff
+var REVIEW_DIFF_CONTEXT_LINES int = 10
+
+// ASK - answering questions about an analyzed project
+
+// Number of relevant files that are given to the LLM with each question
+var ASK_MAX_FILES int = 5
+
+// Max number of bytes of each relevant file's content that is given to the LLM
+var ASK_FILE_CONTENT_BYTES int = 2000
+
+// WEBSEARCH - searching and summarizing the web
+
+// Search backend used by websearch: "brave" (the Brave Search API; needs an API key in BRAVE_SEARCH_API_KEY),
+// "searxng" (a SearXNG instance, see SEARXNG_URL), or "duckduckgo" (reads DuckDuckGo's HTML results; no key needed)
+var WEBSEARCH_PROVIDER string = "brave"
+
+// Base URL of the SearXNG instance used by the searxng search provider. It needs the JSON format enabled (search.formats in settings.yml).
+var SEARXNG_URL string = "http://localhost:8888"
+
+// Number of web pages that are downloaded in parallel, and how many of them can be from the same website
+var WEBSEARCH_FETCH_JOBS int = 4
+var WEBSEARCH_FETCH_PER_HOST int = 2
+
+// Web pages larger than this many bytes aren't downloaded
+var WEBSEARCH_MAX_PAGE_BYTES int64 = 5 * 1024 * 1024
+
+// Max number of redirects followed when downloading a web page
+var WEBSEARCH_MAX_REDIRECTS int = 5
+
+// EMBEDDINGS - semantic search
+
+// Files are split into chunks of at most this many bytes, and each chunk gets its own embedding.
+// Smaller chunks make search results more precise, but take longer to index.
+var EMBEDDING_CHUNK_BYTES int = 2000
+
+// Number of chunks sent to the embedding model in a single request
+var EMBEDDING_BATCH_SIZE int = 16
+
+// Files larger than this aren't indexed (usually generated or data files)
+var EMBEDDING_MAX_FILE_BYTES int64 = 1_000_000
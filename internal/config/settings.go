@@ -0,0 +1,367 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/webbben/caius/internal/llm"
+	"gopkg.in/yaml.v3"
+)
+
+// Setting is a single configurable value. Its value lives in one of the package's globals (e.g. ANALYZE_DIRECTORY_JOBS),
+// so code that reads the globals picks up whatever was configured.
+type Setting struct {
+	Key         string // dotted key, e.g. "analyze.jobs". In config files, each part of the key is a level of nesting.
+	Description string
+	Model       bool     // the value is the name of an LLM model
+	Choices     []string // if set, the only values the setting can have
+	Env         string   // environment variable that overrides the setting, if it isn't the default one (see EnvVar)
+	Secret      bool     // the value isn't shown when listing settings (e.g. API keys)
+	Source      string   // where the current value came from: "default", a config file path, an env var, or "flag"
+
+	value any // pointer to the global: *string, *int, *int64 or *bool
+}
+
+var settings []*Setting = []*Setting{
+	{Key: "llm.provider", value: &LLM_PROVIDER, Description: "backend that LLM calls are sent to: ollama, openai or fake"},
+	{Key: "llm.openai_base_url", value: &LLM_OPENAI_BASE_URL, Env: "CAIUS_OPENAI_BASE_URL", Description: "base URL of the OpenAI compatible API used by the openai provider"},
+	{Key: "llm.openai_api_key", value: &LLM_OPENAI_API_KEY, Env: "CAIUS_OPENAI_API_KEY", Secret: true, Description: "API key sent to the OpenAI compatible API, if it needs one"},
+	{Key: "llm.max_attempts", value: &LLM_MAX_ATTEMPTS, Description: "attempts per LLM call, including the first (1 = no retries)"},
+	{Key: "llm.retry_backoff_ms", value: &LLM_RETRY_BACKOFF_MS, Description: "milliseconds to wait before retrying a failed LLM call; doubles with each retry"},
+	{Key: "llm.retry_max_backoff_ms", value: &LLM_RETRY_MAX_BACKOFF_MS, Description: "max milliseconds to wait between retries"},
+	{Key: "llm.timeout_seconds", value: &LLM_TIMEOUT_SECONDS, Description: "max seconds a single LLM call can take before it's retried (0 = no limit)"},
+	{Key: "llm.repair_attempts", value: &LLM_REPAIR_ATTEMPTS, Description: "times an invalid JSON response is sent back to the model to be fixed"},
+	{Key: "models.basic_file_analysis", value: &BASIC_FILE_ANALYSIS_MODEL, Model: true, Description: "model that describes each file"},
+	{Key: "models.detect_file_type", value: &DETECT_FILE_TYPE_MODEL, Model: true, Description: "model that detects the type of files with unknown extensions"},
+	{Key: "models.directory_summary", value: &DIRECTORY_SUMMARY_MODEL, Model: true, Description: "model that summarizes directories and describes projects"},
+	{Key: "models.code_review", value: &CODE_REVIEW_MODEL, Model: true, Description: "model used by caius review"},
+	{Key: "models.ask", value: &ASK_MODEL, Model: true, Description: "model used by caius ask"},
+	{Key: "models.embedding", value: &EMBEDDING_MODEL, Model: true, Description: "embedding model used for semantic search"},
+	{Key: "models.website_summary", value: &WEBSITE_SUMMARY_MODEL, Model: true, Description: "model that summarizes each website found by websearch"},
+	{Key: "models.website_list_summary", value: &WEBSITE_LIST_SUMMARY_MODEL, Model: true, Description: "model that combines the website summaries of websearch"},
+	{Key: "analyze.max_bytes_basic_analysis", value: &MAX_BYTES_BASIC_ANALYSIS, Description: "max bytes of a file that are used to detect its type"},
+	{Key: "analyze.jobs", value: &ANALYZE_DIRECTORY_JOBS, Description: "number of files to analyze in parallel"},
+	{Key: "analyze.map_max_lines", value: &PROJECT_MAP_MAX_LINES, Description: "max lines in the project map (0 = no limit)"},
+	{Key: "analyze.map_max_tokens", value: &PROJECT_MAP_MAX_TOKENS, Description: "max estimated tokens in the project map (0 = no limit)"},
+	{Key: "review.diff_context_lines", value: &REVIEW_DIFF_CONTEXT_LINES, Description: "unchanged lines shown around each change when reviewing a diff"},
+	{Key: "ask.max_files", value: &ASK_MAX_FILES, Description: "number of relevant files given to the LLM with each question"},
+	{Key: "ask.file_content_bytes", value: &ASK_FILE_CONTENT_BYTES, Description: "max bytes of each relevant file's content given to the LLM"},
+	{Key: "embeddings.chunk_bytes", value: &EMBEDDING_CHUNK_BYTES, Description: "max bytes of each embedded chunk of a file"},
+	{Key: "embeddings.batch_size", value: &EMBEDDING_BATCH_SIZE, Description: "number of chunks embedded in a single request"},
+	{Key: "embeddings.max_file_bytes", value: &EMBEDDING_MAX_FILE_BYTES, Description: "files larger than this aren't indexed"},
+	{Key: "websearch.provider", value: &WEBSEARCH_PROVIDER, Choices: []string{"brave", "searxng", "duckduckgo"}, Description: "search backend used by websearch: brave (needs BRAVE_SEARCH_API_KEY), searxng or duckduckgo"},
+	{Key: "websearch.searxng_url", value: &SEARXNG_URL, Description: "base URL of the SearXNG instance used by the searxng search provider"},
+	{Key: "websearch.fetch_jobs", value: &WEBSEARCH_FETCH_JOBS, Description: "number of web pages downloaded in parallel"},
+	{Key: "websearch.fetch_per_host", value: &WEBSEARCH_FETCH_PER_HOST, Description: "number of web pages downloaded in parallel from the same website"},
+	{Key: "websearch.max_page_bytes", value: &WEBSEARCH_MAX_PAGE_BYTES, Description: "web pages larger than this aren't downloaded"},
+	{Key: "websearch.max_redirects", value: &WEBSEARCH_MAX_REDIRECTS, Description: "max redirects followed when downloading a web page"},
+	{Key: "output.thinking", value: &OUTPUT_THINKING, Choices: []string{"hide", "collapse", "show"}, Description: "what to do with the reasoning of reasoning models (e.g. deepseek-r1) in streamed output: hide, collapse or show"},
+	{Key: "debug.show_function_metrics", value: &SHOW_FUNCTION_METRICS, Description: "show function speed metrics"},
+	{Key: "debug.show_llm_metrics", value: &SHOW_LLM_METRICS, Description: "show LLM usage metrics after each command"},
+}
+
+func init() {
+	for _, s := range settings {
+		s.Source = "default"
+	}
+}
+
+// Settings gives all settings, sorted by key.
+func Settings() []*Setting {
+	sorted := slices.Clone(settings)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Key < sorted[j].Key
+	})
+	return sorted
+}
+
+// Lookup finds the setting with the given key.
+func Lookup(key string) (*Setting, error) {
+	for _, s := range settings {
+		if s.Key == key {
+			return s, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown config key %q (see caius config list)", key)
+}
+
+// EnvVar gives the name of the environment variable that overrides the setting, e.g. CAIUS_ANALYZE_JOBS for analyze.jobs
+func (s *Setting) EnvVar() string {
+	if s.Env != "" {
+		return s.Env
+	}
+	return "CAIUS_" + strings.ToUpper(strings.ReplaceAll(s.Key, ".", "_"))
+}
+
+// Get gives the current value of the setting, as a string.
+func (s *Setting) Get() string {
+	switch v := s.value.(type) {
+	case *string:
+		return *v
+	case *int:
+		return strconv.Itoa(*v)
+	case *int64:
+		return strconv.FormatInt(*v, 10)
+	case *bool:
+		return strconv.FormatBool(*v)
+	}
+	return ""
+}
+
+// Parse converts a string into the setting's type, without changing the setting.
+func (s *Setting) Parse(value string) (any, error) {
+	value = strings.TrimSpace(value)
+	var parsed any
+	var err error
+	switch s.value.(type) {
+	case *string:
+		parsed = value
+	case *int:
+		parsed, err = strconv.Atoi(value)
+	case *int64:
+		parsed, err = strconv.ParseInt(value, 10, 64)
+	case *bool:
+		parsed, err = strconv.ParseBool(value)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid value %q for %s; expected a %s", value, s.Key, s.Type())
+	}
+	if len(s.Choices) > 0 && !slices.Contains(s.Choices, value) {
+		return nil, fmt.Errorf("invalid value %q for %s; expected one of: %s", value, s.Key, strings.Join(s.Choices, ", "))
+	}
+	return parsed, nil
+}
+
+// Type gives the kind of value the setting holds: string, integer or boolean
+func (s *Setting) Type() string {
+	switch s.value.(type) {
+	case *int, *int64:
+		return "integer"
+	case *bool:
+		return "boolean"
+	}
+	return "string"
+}
+
+// Set parses and sets the value of the setting, recording where it came from.
+func (s *Setting) Set(value string, source string) error {
+	parsed, err := s.Parse(value)
+	if err != nil {
+		return err
+	}
+	switch v := s.value.(type) {
+	case *string:
+		*v = parsed.(string)
+	case *int:
+		*v = parsed.(int)
+	case *int64:
+		*v = parsed.(int64)
+	case *bool:
+		*v = parsed.(bool)
+	}
+	s.Source = source
+	return nil
+}
+
+// LoadOptions decides where Load reads settings from.
+type LoadOptions struct {
+	UserConfigPath    string   // defaults to UserConfigPath()
+	ProjectConfigPath string   // defaults to the .caius.yaml found by FindProjectConfig from the current directory
+	Overrides         []string // KEY=VALUE settings from flags, which take precedence over everything else
+}
+
+// Load applies all layers of configuration on top of the defaults: the user config file, the project config file,
+// CAIUS_* environment variables, and finally the overrides (from flags).
+func Load(op LoadOptions) error {
+	userPath := op.UserConfigPath
+	if userPath == "" {
+		userPath = UserConfigPath()
+	}
+	projectPath := op.ProjectConfigPath
+	if projectPath == "" {
+		cwd, err := os.Getwd()
+		if err == nil {
+			projectPath = FindProjectConfig(cwd)
+		}
+	}
+
+	for _, path := range []string{userPath, projectPath} {
+		if path == "" {
+			continue
+		}
+		values, err := ReadFile(path)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		for key, value := range values {
+			s, err := Lookup(key)
+			if err != nil {
+				return fmt.Errorf("%s: %w", path, err)
+			}
+			if err := s.Set(value, path); err != nil {
+				return fmt.Errorf("%s: %w", path, err)
+			}
+		}
+	}
+
+	for _, s := range settings {
+		if value, ok := os.LookupEnv(s.EnvVar()); ok && value != "" {
+			if err := s.Set(value, s.EnvVar()); err != nil {
+				return fmt.Errorf("%s: %w", s.EnvVar(), err)
+			}
+		}
+	}
+
+	for _, override := range op.Overrides {
+		key, value, found := strings.Cut(override, "=")
+		if !found {
+			return fmt.Errorf("invalid setting %q; expected KEY=VALUE", override)
+		}
+		s, err := Lookup(strings.TrimSpace(key))
+		if err != nil {
+			return err
+		}
+		if err := s.Set(value, "flag"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// UserConfigPath gives the path of the user's config file: $XDG_CONFIG_HOME/caius/config.yaml, or ~/.config/caius/config.yaml
+func UserConfigPath() string {
+	dir := os.Getenv("XDG_CONFIG_HOME")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return ""
+		}
+		dir = filepath.Join(home, ".config")
+	}
+	return filepath.Join(dir, "caius", "config.yaml")
+}
+
+// ProjectConfigName is the name of the per-project config file
+const ProjectConfigName = ".caius.yaml"
+
+// FindProjectConfig looks for a project config file in dir and each of its parent directories.
+// Returns an empty string if there isn't one.
+func FindProjectConfig(dir string) string {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return ""
+	}
+	for {
+		path := filepath.Join(dir, ProjectConfigName)
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
+
+// ReadFile reads a YAML config file into a map of dotted keys to values.
+func ReadFile(path string) (map[string]string, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var doc map[string]any
+	if err := yaml.Unmarshal(b, &doc); err != nil {
+		return nil, fmt.Errorf("%s: invalid YAML; %w", path, err)
+	}
+	values := map[string]string{}
+	flatten("", doc, values)
+	return values, nil
+}
+
+func flatten(prefix string, m map[string]any, out map[string]string) {
+	for k, v := range m {
+		key := k
+		if prefix != "" {
+			key = prefix + "." + k
+		}
+		if nested, ok := v.(map[string]any); ok {
+			flatten(key, nested, out)
+			continue
+		}
+		if v == nil {
+			out[key] = ""
+			continue
+		}
+		out[key] = fmt.Sprint(v)
+	}
+}
+
+// WriteFile sets a single setting in a YAML config file, creating the file if needed.
+// The value is validated first. Other settings in the file are kept (comments are not).
+func WriteFile(path string, key string, value string) error {
+	s, err := Lookup(key)
+	if err != nil {
+		return err
+	}
+	parsed, err := s.Parse(value)
+	if err != nil {
+		return err
+	}
+
+	doc := map[string]any{}
+	b, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	if err == nil {
+		if err := yaml.Unmarshal(b, &doc); err != nil {
+			return fmt.Errorf("%s: invalid YAML; %w", path, err)
+		}
+		if doc == nil {
+			doc = map[string]any{}
+		}
+	}
+
+	parts := strings.Split(key, ".")
+	m := doc
+	for _, part := range parts[:len(parts)-1] {
+		nested, ok := m[part].(map[string]any)
+		if !ok {
+			nested = map[string]any{}
+			m[part] = nested
+		}
+		m = nested
+	}
+	m[parts[len(parts)-1]] = parsed
+
+	out, err := yaml.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, out, 0644)
+}
+
+// ValidateModel returns an error if the model isn't one of the installed models.
+// Model names without a tag are treated as ":latest", the same way ollama does.
+func ValidateModel(model string, installed []string) error {
+	if model == "" {
+		return errors.New("model name is empty")
+	}
+	if llm.IsModelInstalled(model, installed) {
+		return nil
+	}
+	return fmt.Errorf("model %q is not installed (pull it first, e.g. ollama pull %s)", model, model)
+}
@@ -0,0 +1,129 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// restoreSettings puts all settings back the way they were when the test finishes
+func restoreSettings(t *testing.T) {
+	saved := map[*Setting][2]string{}
+	for _, s := range settings {
+		saved[s] = [2]string{s.Get(), s.Source}
+	}
+	t.Cleanup(func() {
+		for s, v := range saved {
+			s.Set(v[0], v[1])
+		}
+	})
+}
+
+func TestLoadLayers(t *testing.T) {
+	restoreSettings(t)
+	dir := t.TempDir()
+
+	userPath := filepath.Join(dir, "user", "config.yaml")
+	if err := WriteFile(userPath, "analyze.jobs", "2"); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteFile(userPath, "models.ask", "user-model"); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteFile(userPath, "ask.max_files", "3"); err != nil {
+		t.Fatal(err)
+	}
+	projectPath := filepath.Join(dir, ProjectConfigName)
+	if err := os.WriteFile(projectPath, []byte("models:\n  ask: project-model\ndebug:\n  show_llm_metrics: false\nllm:\n  openai_api_key: project-key\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("CAIUS_ASK_MAX_FILES", "7")
+	t.Setenv("CAIUS_OPENAI_BASE_URL", "http://llm.local/v1")
+
+	err := Load(LoadOptions{
+		UserConfigPath:    userPath,
+		ProjectConfigPath: projectPath,
+		Overrides:         []string{"analyze.jobs=8"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		key, value, source string
+	}{
+		{"analyze.jobs", "8", "flag"},
+		{"models.ask", "project-model", projectPath},
+		{"debug.show_llm_metrics", "false", projectPath},
+		{"ask.max_files", "7", "CAIUS_ASK_MAX_FILES"},
+		{"llm.openai_base_url", "http://llm.local/v1", "CAIUS_OPENAI_BASE_URL"},
+		{"llm.openai_api_key", "project-key", projectPath},
+		{"analyze.map_max_lines", "150", "default"},
+	}
+	for _, c := range cases {
+		s, err := Lookup(c.key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s.Get() != c.value || s.Source != c.source {
+			t.Errorf("%s: expected %s (from %s), got %s (from %s)", c.key, c.value, c.source, s.Get(), s.Source)
+		}
+	}
+	if ANALYZE_DIRECTORY_JOBS != 8 || ASK_MODEL != "project-model" || SHOW_LLM_METRICS || LLM_OPENAI_BASE_URL != "http://llm.local/v1" {
+		t.Errorf("expected the config globals to be updated")
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	restoreSettings(t)
+	dir := t.TempDir()
+
+	badKey := filepath.Join(dir, "bad_key.yaml")
+	os.WriteFile(badKey, []byte("analyze:\n  jbos: 2\n"), 0644)
+	if err := Load(LoadOptions{UserConfigPath: badKey, ProjectConfigPath: filepath.Join(dir, "missing.yaml")}); err == nil {
+		t.Error("expected an error for an unknown key")
+	}
+
+	badValue := filepath.Join(dir, "bad_value.yaml")
+	os.WriteFile(badValue, []byte("analyze:\n  jobs: lots\n"), 0644)
+	if err := Load(LoadOptions{UserConfigPath: badValue, ProjectConfigPath: filepath.Join(dir, "missing.yaml")}); err == nil {
+		t.Error("expected an error for a value of the wrong type")
+	}
+
+	if err := Load(LoadOptions{UserConfigPath: filepath.Join(dir, "missing.yaml"), ProjectConfigPath: filepath.Join(dir, "missing.yaml"), Overrides: []string{"analyze.jobs"}}); err == nil {
+		t.Error("expected an error for an override without a value")
+	}
+
+	if err := WriteFile(filepath.Join(dir, "config.yaml"), "debug.show_llm_metrics", "maybe"); err == nil {
+		t.Error("expected an error when writing an invalid value")
+	}
+
+	if err := Load(LoadOptions{UserConfigPath: filepath.Join(dir, "missing.yaml"), ProjectConfigPath: filepath.Join(dir, "missing.yaml"), Overrides: []string{"output.thinking=loud"}}); err == nil {
+		t.Error("expected an error for a value that isn't one of the setting's choices")
+	}
+}
+
+func TestFindProjectConfig(t *testing.T) {
+	root := t.TempDir()
+	nested := filepath.Join(root, "a", "b")
+	os.MkdirAll(nested, 0755)
+	os.WriteFile(filepath.Join(root, ProjectConfigName), []byte(""), 0644)
+
+	if got := FindProjectConfig(nested); got != filepath.Join(root, ProjectConfigName) {
+		t.Errorf("expected project config to be found in a parent directory, got %q", got)
+	}
+}
+
+func TestValidateModel(t *testing.T) {
+	installed := []string{"deepseek-r1:7b", "nomic-embed-text:latest"}
+	for _, model := range []string{"deepseek-r1:7b", "nomic-embed-text", "nomic-embed-text:latest"} {
+		if err := ValidateModel(model, installed); err != nil {
+			t.Errorf("expected %s to be valid: %v", model, err)
+		}
+	}
+	for _, model := range []string{"deepseek-r1:14b", "llama3.2", ""} {
+		if err := ValidateModel(model, installed); err == nil {
+			t.Errorf("expected %q to be invalid", model)
+		}
+	}
+}
@@ -0,0 +1,305 @@
+package embeddings
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/webbben/caius/internal/cache"
+	"github.com/webbben/caius/internal/config"
+	"github.com/webbben/caius/internal/files"
+	"github.com/webbben/caius/internal/llm"
+	"github.com/webbben/caius/internal/metrics"
+	"github.com/webbben/caius/internal/utils"
+)
+
+// ChunkVector is the embedding of a single chunk of a file.
+type ChunkVector struct {
+	StartLine int       `json:"start_line"`
+	EndLine   int       `json:"end_line"`
+	Vector    []float32 `json:"vector"`
+}
+
+// FileEntry holds the embeddings of all chunks of a file.
+type FileEntry struct {
+	ContentHash string        `json:"content_hash"`
+	Chunks      []ChunkVector `json:"chunks"`
+}
+
+// Index is an on-disk store of file chunk embeddings for a project, used for semantic search.
+// Files are keyed by their path relative to the project root.
+type Index struct {
+	Root      string               `json:"-"`
+	Model     string               `json:"model"`
+	ChunkSize int                  `json:"chunk_size"`
+	UpdatedAt time.Time            `json:"updated_at"`
+	Files     map[string]FileEntry `json:"files"`
+}
+
+// Result is a single chunk found by Search.
+type Result struct {
+	Path      string  `json:"path"` // relative to the project root
+	StartLine int     `json:"start_line"`
+	EndLine   int     `json:"end_line"`
+	Score     float64 `json:"score"` // cosine similarity to the query
+}
+
+// UpdateStats counts what changed in an Update.
+type UpdateStats struct {
+	Embedded  int // files that were new or changed, and were (re-)embedded
+	Unchanged int
+	Removed   int
+	Skipped   int // binary or very large files
+}
+
+// IndexPath gives the path of a project's embedding index
+func IndexPath(root string) string {
+	return filepath.Join(root, ".caius", "embeddings.json")
+}
+
+// Open loads the embedding index of a project, or starts a new one if there isn't one yet.
+// If the index was built with a different embedding model or chunk size than is currently configured, it's started over.
+func Open(root string) (*Index, error) {
+	ix := &Index{
+		Root:      root,
+		Model:     config.EMBEDDING_MODEL,
+		ChunkSize: config.EMBEDDING_CHUNK_BYTES,
+		Files:     map[string]FileEntry{},
+	}
+	b, err := os.ReadFile(IndexPath(root))
+	if errors.Is(err, os.ErrNotExist) {
+		return ix, nil
+	}
+	if err != nil {
+		return nil, errors.Join(errors.New("embeddings: failed to read index;"), err)
+	}
+
+	var saved Index
+	err = json.Unmarshal(b, &saved)
+	if err != nil {
+		return nil, errors.Join(errors.New("embeddings: failed to parse index;"), err)
+	}
+	if saved.Model != ix.Model || saved.ChunkSize != ix.ChunkSize || saved.Files == nil {
+		return ix, nil
+	}
+	saved.Root = root
+	return &saved, nil
+}
+
+// Exists reports if a project has an embedding index on disk.
+func Exists(root string) bool {
+	_, err := os.Stat(IndexPath(root))
+	return err == nil
+}
+
+// Save writes the index to disk.
+func (ix *Index) Save() error {
+	path := IndexPath(ix.Root)
+	err := os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		return errors.Join(errors.New("embeddings: failed to create .caius directory;"), err)
+	}
+	b, err := json.Marshal(ix)
+	if err != nil {
+		return errors.Join(errors.New("embeddings: failed to marshal index;"), err)
+	}
+	tmp := path + ".tmp"
+	err = os.WriteFile(tmp, b, 0644)
+	if err != nil {
+		return errors.Join(errors.New("embeddings: failed to write index;"), err)
+	}
+	return os.Rename(tmp, path)
+}
+
+// Update brings the index up to date with the given files (absolute paths within the project root), and saves it.
+// Only files that are new or have changed since the last update are embedded; files that are no longer in the list are removed.
+// If ctx is cancelled (or embedding fails), the files embedded so far are still saved.
+func (ix *Index) Update(ctx context.Context, fileList []string, progress func(done int, total int, path string)) (UpdateStats, error) {
+	start := time.Now()
+	stats := UpdateStats{}
+	seen := map[string]bool{}
+
+	for i, file := range fileList {
+		rel, err := filepath.Rel(ix.Root, file)
+		if err != nil {
+			return stats, err
+		}
+		rel = filepath.ToSlash(rel)
+		seen[rel] = true
+		if progress != nil {
+			progress(i, len(fileList), rel)
+		}
+
+		info, err := os.Stat(file)
+		if err != nil {
+			return stats, err
+		}
+		if info.Size() > config.EMBEDDING_MAX_FILE_BYTES || files.IgnoreFiles(filepath.Base(file)) {
+			delete(ix.Files, rel)
+			stats.Skipped++
+			continue
+		}
+		content, err := os.ReadFile(file)
+		if err != nil {
+			return stats, err
+		}
+		if len(content) == 0 || files.IsProbablyBinaryData(content) {
+			delete(ix.Files, rel)
+			stats.Skipped++
+			continue
+		}
+
+		contentHash := cache.HashContent(content)
+		if entry, ok := ix.Files[rel]; ok && entry.ContentHash == contentHash {
+			stats.Unchanged++
+			continue
+		}
+
+		chunks, err := ix.embedFile(ctx, rel, string(content))
+		if err != nil {
+			// save what we have so far, so the work isn't lost
+			saveErr := ix.Save()
+			if ctx.Err() != nil {
+				return stats, errors.Join(ctx.Err(), saveErr)
+			}
+			return stats, errors.Join(utils.WrapError("embeddings: error embedding "+rel, err), saveErr)
+		}
+		ix.Files[rel] = FileEntry{ContentHash: contentHash, Chunks: chunks}
+		stats.Embedded++
+		metrics.AddSpeedRecord("EmbedFile", start, metrics.FileContext{Filepath: file, FileBytes: info.Size()})
+		start = time.Now()
+	}
+
+	for rel := range ix.Files {
+		if !seen[rel] {
+			delete(ix.Files, rel)
+			stats.Removed++
+		}
+	}
+
+	ix.UpdatedAt = time.Now()
+	return stats, ix.Save()
+}
+
+// embedFile splits a file into chunks and embeds each one.
+// The file path is embedded along with each chunk, since file and directory names say a lot about what's in them.
+func (ix *Index) embedFile(ctx context.Context, rel string, content string) ([]ChunkVector, error) {
+	chunks := files.ChunkText(content, ix.ChunkSize)
+	vectors := []ChunkVector{}
+
+	batchSize := max(config.EMBEDDING_BATCH_SIZE, 1)
+	for batchStart := 0; batchStart < len(chunks); batchStart += batchSize {
+		batch := chunks[batchStart:min(batchStart+batchSize, len(chunks))]
+		inputs := make([]string, len(batch))
+		for i, chunk := range batch {
+			inputs[i] = fmt.Sprintf("File: %s\n\n%s", rel, chunk.Text)
+		}
+		embeddings, err := llm.GenerateEmbeddingsWithModel(ctx, ix.Model, inputs)
+		if err != nil {
+			return nil, err
+		}
+		for i, chunk := range batch {
+			vectors = append(vectors, ChunkVector{
+				StartLine: chunk.StartLine,
+				EndLine:   chunk.EndLine,
+				Vector:    embeddings[i],
+			})
+		}
+	}
+	return vectors, nil
+}
+
+// Search finds the k chunks that are most similar to the query. If k isn't positive, there are no results.
+func (ix *Index) Search(ctx context.Context, query string, k int) ([]Result, error) {
+	if k <= 0 {
+		return []Result{}, nil
+	}
+	results, err := ix.scoreAll(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	return results[:min(k, len(results))], nil
+}
+
+// SearchFiles finds the k files that are most similar to the query, each with its best matching chunk.
+// If k isn't positive, there are no results.
+func (ix *Index) SearchFiles(ctx context.Context, query string, k int) ([]Result, error) {
+	if k <= 0 {
+		return []Result{}, nil
+	}
+	results, err := ix.scoreAll(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	best := []Result{}
+	seen := map[string]bool{}
+	for _, r := range results {
+		if len(best) >= k {
+			break
+		}
+		if seen[r.Path] {
+			continue
+		}
+		seen[r.Path] = true
+		best = append(best, r)
+	}
+	return best, nil
+}
+
+// scoreAll scores every chunk in the index against the query, best first
+func (ix *Index) scoreAll(ctx context.Context, query string) ([]Result, error) {
+	if len(ix.Files) == 0 {
+		return []Result{}, nil
+	}
+	embeddings, err := llm.GenerateEmbeddingsWithModel(ctx, ix.Model, []string{query})
+	if err != nil {
+		return nil, utils.WrapError("embeddings: error embedding query", err)
+	}
+	queryVector := embeddings[0]
+
+	results := []Result{}
+	for path, entry := range ix.Files {
+		for _, chunk := range entry.Chunks {
+			results = append(results, Result{
+				Path:      path,
+				StartLine: chunk.StartLine,
+				EndLine:   chunk.EndLine,
+				Score:     CosineSimilarity(queryVector, chunk.Vector),
+			})
+		}
+	}
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Score != results[j].Score {
+			return results[i].Score > results[j].Score
+		}
+		if results[i].Path != results[j].Path {
+			return results[i].Path < results[j].Path
+		}
+		return results[i].StartLine < results[j].StartLine
+	})
+	return results, nil
+}
+
+// CosineSimilarity gives the cosine of the angle between two vectors (1 = same direction, 0 = unrelated).
+// Vectors of different lengths, or zero vectors, have a similarity of 0.
+func CosineSimilarity(a []float32, b []float32) float64 {
+	if len(a) != len(b) || len(a) == 0 {
+		return 0
+	}
+	var dot, normA, normB float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		normA += float64(a[i]) * float64(a[i])
+		normB += float64(b[i]) * float64(b[i])
+	}
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(normA) * math.Sqrt(normB))
+}
@@ -0,0 +1,121 @@
+package embeddings
+
+import (
+	"context"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/webbben/caius/internal/llm"
+)
+
+func TestCosineSimilarity(t *testing.T) {
+	cases := []struct {
+		a, b     []float32
+		expected float64
+	}{
+		{[]float32{1, 0}, []float32{1, 0}, 1},
+		{[]float32{1, 0}, []float32{0, 1}, 0},
+		{[]float32{1, 1}, []float32{-1, -1}, -1},
+		{[]float32{1, 2, 3}, []float32{2, 4, 6}, 1},
+		{[]float32{0, 0}, []float32{1, 0}, 0},
+		{[]float32{1}, []float32{1, 0}, 0},
+	}
+	for _, c := range cases {
+		if got := CosineSimilarity(c.a, c.b); math.Abs(got-c.expected) > 1e-9 {
+			t.Errorf("CosineSimilarity(%v, %v) = %v, expected %v", c.a, c.b, got, c.expected)
+		}
+	}
+}
+
+type countingProvider struct {
+	*llm.FakeProvider
+	inputs int
+}
+
+func (c *countingProvider) Embed(ctx context.Context, model string, inputs []string) ([][]float32, error) {
+	c.inputs += len(inputs)
+	return c.FakeProvider.Embed(ctx, model, inputs)
+}
+
+func TestIndexUpdateAndSearch(t *testing.T) {
+	prev := llm.GetProvider()
+	t.Cleanup(func() { llm.SetProvider(prev) })
+	provider := &countingProvider{FakeProvider: &llm.FakeProvider{}}
+	llm.SetProvider(provider)
+
+	root := t.TempDir()
+	write := func(name string, content string) string {
+		path := filepath.Join(root, name)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	fileList := []string{
+		write("auth/login.go", "func Login(user, password) checks the password and creates a session token"),
+		write("db/db.go", "func Connect() opens the database connection pool"),
+		write("image.png", "\x89PNG\x00\x00\x00binary"),
+	}
+
+	ix, err := Open(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stats, err := ix.Update(context.Background(), fileList, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Embedded != 2 || stats.Skipped != 1 {
+		t.Errorf("expected 2 embedded and 1 skipped file, got %+v", stats)
+	}
+
+	results, err := ix.SearchFiles(context.Background(), "password session", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || results[0].Path != "auth/login.go" {
+		t.Errorf("expected auth/login.go as the best match, got %+v", results)
+	}
+	for _, k := range []int{0, -1} {
+		chunks, err := ix.Search(context.Background(), "password session", k)
+		if err != nil || len(chunks) != 0 {
+			t.Errorf("k=%v: expected no chunks, got %+v, %v", k, chunks, err)
+		}
+		files, err := ix.SearchFiles(context.Background(), "password session", k)
+		if err != nil || len(files) != 0 {
+			t.Errorf("k=%v: expected no files, got %+v, %v", k, files, err)
+		}
+	}
+
+	// reopening the index from disk and updating again shouldn't embed anything, unless a file changed or was removed
+	ix, err = Open(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ix.Files) != 2 {
+		t.Fatalf("expected 2 files in the saved index, got %v", len(ix.Files))
+	}
+	provider.inputs = 0
+	stats, err = ix.Update(context.Background(), fileList, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Embedded != 0 || stats.Unchanged != 2 || provider.inputs != 0 {
+		t.Errorf("expected nothing to be re-embedded, got %+v (%v inputs embedded)", stats, provider.inputs)
+	}
+
+	write("db/db.go", "func Connect() opens the database connection pool with a password")
+	stats, err = ix.Update(context.Background(), fileList[1:2], nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Embedded != 1 || stats.Removed != 1 {
+		t.Errorf("expected 1 re-embedded and 1 removed file, got %+v", stats)
+	}
+	if _, ok := ix.Files["auth/login.go"]; ok {
+		t.Errorf("expected removed file to be gone from the index")
+	}
+}
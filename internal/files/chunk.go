@@ -0,0 +1,124 @@
+package files
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// Chunk is a section of a file's content.
+type Chunk struct {
+	StartLine int // first line of the chunk (1-based)
+	EndLine   int // last line of the chunk (inclusive)
+	Text      string
+}
+
+// boundaryScore rates how good of a place the start of a line is for splitting a file.
+// Higher is better; 0 means it's not a boundary at all.
+func boundaryScore(prevLine string, line string) int {
+	trimmed := strings.TrimSpace(line)
+	prevBlank := strings.TrimSpace(prevLine) == ""
+
+	// markdown headings
+	if strings.HasPrefix(trimmed, "#") && strings.HasPrefix(line, "#") && !strings.HasPrefix(line, "#!") && !strings.HasPrefix(line, "#include") {
+		return 3
+	}
+	// a top level (non-indented) line after a blank line is usually the start of a new function, class, type, etc.
+	if prevBlank && trimmed != "" && line[0] != ' ' && line[0] != '\t' && !strings.HasPrefix(trimmed, "}") && !strings.HasPrefix(trimmed, ")") {
+		return 2
+	}
+	if prevBlank {
+		return 1
+	}
+	return 0
+}
+
+// ChunkText splits text into chunks of at most maxBytes, preferring to split at function or section boundaries.
+//
+// Chunks are made up of whole lines, unless a single line is longer than maxBytes (e.g. minified code),
+// in which case that line is split up on its own.
+func ChunkText(text string, maxBytes int) []Chunk {
+	if maxBytes <= 0 || len(text) <= maxBytes {
+		return []Chunk{{StartLine: 1, EndLine: strings.Count(text, "\n") + 1, Text: text}}
+	}
+
+	lines := strings.SplitAfter(text, "\n")
+	chunks := []Chunk{}
+
+	start := 0 // index of the first line in the current chunk
+	for start < len(lines) {
+		// a single line that doesn't fit; split it by bytes, without splitting up a character
+		if len(lines[start]) > maxBytes {
+			line := lines[start]
+			for len(line) > 0 {
+				n := runeBoundary(line, maxBytes)
+				if n == 0 {
+					// maxBytes is smaller than the character itself
+					_, n = utf8.DecodeRuneInString(line)
+				}
+				chunks = append(chunks, Chunk{StartLine: start + 1, EndLine: start + 1, Text: line[:n]})
+				line = line[n:]
+			}
+			start++
+			continue
+		}
+
+		// take as many lines as fit
+		size := 0
+		end := start
+		for end < len(lines) && size+len(lines[end]) <= maxBytes {
+			size += len(lines[end])
+			end++
+		}
+
+		// if there's more to go, look back for a good boundary to split at, but don't make the chunk too small
+		if end < len(lines) {
+			bestScore := 0
+			bestSplit := end
+			minEnd := start + max((end-start)/2, 1)
+			for i := end; i > minEnd; i-- {
+				score := boundaryScore(lines[i-1], lines[i])
+				if score > bestScore {
+					bestScore = score
+					bestSplit = i
+				}
+			}
+			end = bestSplit
+		}
+
+		chunks = append(chunks, Chunk{
+			StartLine: start + 1,
+			EndLine:   end,
+			Text:      strings.Join(lines[start:end], ""),
+		})
+		start = end
+	}
+
+	return chunks
+}
+
+// TruncateText cuts text down to at most maxBytes. It's cut after the last line that fits, unless that
+// would lose more than half of what fits, in which case it's cut between the last characters that fit.
+func TruncateText(text string, maxBytes int) string {
+	if len(text) <= maxBytes {
+		return text
+	}
+	if maxBytes <= 0 {
+		return ""
+	}
+	n := runeBoundary(text, maxBytes)
+	if i := strings.LastIndexByte(text[:n], '\n'); i >= 0 && i+1 >= n/2 {
+		return text[:i+1]
+	}
+	return text[:n]
+}
+
+// runeBoundary gives the largest index up to n at which s can be cut without splitting a UTF-8 character
+func runeBoundary(s string, n int) int {
+	if n >= len(s) {
+		return len(s)
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return n
+}
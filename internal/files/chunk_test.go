@@ -0,0 +1,109 @@
+package files
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestChunkTextFits(t *testing.T) {
+	chunks := ChunkText("a\nb\nc", 100)
+	if len(chunks) != 1 || chunks[0].StartLine != 1 || chunks[0].EndLine != 3 {
+		t.Errorf("expected a single chunk of 3 lines, got %+v", chunks)
+	}
+}
+
+func TestChunkTextBoundaries(t *testing.T) {
+	// three go functions, each ~10 lines
+	var sb strings.Builder
+	for i := range 3 {
+		fmt.Fprintf(&sb, "func f%v() {\n", i)
+		for j := range 8 {
+			fmt.Fprintf(&sb, "\tx := %v\n", j)
+		}
+		sb.WriteString("}\n\n")
+	}
+	text := sb.String()
+
+	// room for about one and a half functions per chunk
+	chunks := ChunkText(text, 150)
+	if len(chunks) < 2 {
+		t.Fatalf("expected multiple chunks, got %v", len(chunks))
+	}
+
+	joined := ""
+	for i, chunk := range chunks {
+		if len(chunk.Text) > 150 {
+			t.Errorf("chunk %v is too large: %v bytes", i, len(chunk.Text))
+		}
+		if i > 0 && !strings.HasPrefix(chunk.Text, "func ") {
+			t.Errorf("expected chunk %v to start at a function boundary, got:\n%s", i, chunk.Text)
+		}
+		if i > 0 && chunk.StartLine != chunks[i-1].EndLine+1 {
+			t.Errorf("chunk %v doesn't continue from the previous chunk", i)
+		}
+		joined += chunk.Text
+	}
+	if joined != text {
+		t.Error("chunks don't add up to the original text")
+	}
+}
+
+func TestChunkTextLongLine(t *testing.T) {
+	text := "short\n" + strings.Repeat("x", 250) + "\nend\n"
+	chunks := ChunkText(text, 100)
+	joined := ""
+	for _, chunk := range chunks {
+		if len(chunk.Text) > 100 {
+			t.Errorf("chunk is too large: %v bytes", len(chunk.Text))
+		}
+		joined += chunk.Text
+	}
+	if joined != text {
+		t.Error("chunks don't add up to the original text")
+	}
+}
+
+func TestChunkTextLongLineNonASCII(t *testing.T) {
+	text := "short\n" + strings.Repeat("héllo wörld 日本語 ", 20) + "\nend\n"
+	for _, maxBytes := range []int{1, 2, 7, 100} {
+		chunks := ChunkText(text, maxBytes)
+		joined := ""
+		for _, chunk := range chunks {
+			if !utf8.ValidString(chunk.Text) {
+				t.Errorf("maxBytes %v: chunk splits a character: %q", maxBytes, chunk.Text)
+			}
+			// a character larger than maxBytes is kept whole
+			if len(chunk.Text) > max(maxBytes, utf8.UTFMax) {
+				t.Errorf("maxBytes %v: chunk is too large: %v bytes", maxBytes, len(chunk.Text))
+			}
+			joined += chunk.Text
+		}
+		if joined != text {
+			t.Errorf("maxBytes %v: chunks don't add up to the original text", maxBytes)
+		}
+	}
+}
+
+func TestTruncateText(t *testing.T) {
+	tests := []struct {
+		text     string
+		maxBytes int
+		expected string
+	}{
+		{"short", 100, "short"},
+		{"one\ntwo\nthree", 10, "one\ntwo\n"},
+		// the last line break is too far back, so it's cut mid-line
+		{"a\nbcdefghijk", 10, "a\nbcdefghi"},
+		{"日本語", 7, "日本"},
+		{"héllo", 2, "h"},
+		{"日本語", 2, ""},
+		{"abc", 0, ""},
+	}
+	for _, tt := range tests {
+		if truncated := TruncateText(tt.text, tt.maxBytes); truncated != tt.expected {
+			t.Errorf("TruncateText(%q, %v): expected %q, got %q", tt.text, tt.maxBytes, tt.expected, truncated)
+		}
+	}
+}
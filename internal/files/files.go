@@ -15,26 +15,59 @@ var skipDirs []string = []string{".git", "node_modules"}
 
 type GetProjectFilesOptions struct {
 	SkipDotfiles bool // if true, "dotfiles" (files or directories starting with a period) will be skipped
+	SkipIgnored  bool // if true, files matched by .gitignore or .caiusignore files in the project will be skipped
+}
+
+func isSkipDir(name string) bool {
+	return slices.Contains(skipDirs, name)
 }
 
 func GetProjectFiles(root string, op GetProjectFilesOptions) ([]string, error) {
+	var matcher *IgnoreMatcher
+	if op.SkipIgnored {
+		var err error
+		matcher, err = NewIgnoreMatcher(root)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	files := make([]string, 0)
 	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "Error accessing path %q: %v\n", path, err)
 			return err
 		}
+		relPath, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		isRoot := relPath == "."
+
 		if d.IsDir() {
+			if isRoot {
+				return nil
+			}
 			if op.SkipDotfiles && d.Name()[0] == '.' {
 				return fs.SkipDir
 			}
-			if slices.Contains(skipDirs, d.Name()) {
+			if isSkipDir(d.Name()) {
 				return fs.SkipDir
 			}
+			if matcher != nil {
+				if matcher.IsIgnored(relPath, true) {
+					return fs.SkipDir
+				}
+				// load the ignore files of this directory before walking into it
+				return matcher.LoadDir(relPath)
+			}
 		} else {
 			if op.SkipDotfiles && filepath.Base(path)[0] == '.' {
 				return nil
 			}
+			if matcher != nil && matcher.IsIgnored(relPath, false) {
+				return nil
+			}
 			files = append(files, path)
 		}
 		return nil
@@ -43,8 +76,8 @@ func GetProjectFiles(root string, op GetProjectFilesOptions) ([]string, error) {
 	return files, err
 }
 
-// GroupFilesByDirectory groups all files that share the same directory and maps them to their directory path
-// TODO: might use this in a mechanism that "compresses" directories in the AnalyzeDirectory workflow.
+// GroupFilesByDirectory groups all files that share the same directory and maps them to their directory path.
+// Used for "compressing" directories into summaries in the AnalyzeDirectory workflow.
 func GroupFilesByDirectory(fileList []string) map[string][]string {
 	m := map[string][]string{}
 	for _, filePath := range fileList {
@@ -0,0 +1,320 @@
+package files
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// names of the ignore files that are read in each directory. .caiusignore is read after .gitignore, so its rules take precedence.
+var ignoreFileNames []string = []string{".gitignore", ".caiusignore"}
+
+// IgnoreRule is a single pattern from an ignore file, following .gitignore semantics.
+type IgnoreRule struct {
+	Pattern string // the pattern as written in the ignore file
+	Source  string // ignore file the rule came from, relative to the project root
+	Line    int
+	Base    string // directory the ignore file is in, relative to the project root ("" for the root)
+	Negate  bool   // pattern started with "!"; matching paths are re-included
+	DirOnly bool   // pattern ended with "/"; only matches directories
+
+	re *regexp.Regexp
+}
+
+func (r IgnoreRule) String() string {
+	return fmt.Sprintf("%s:%v: %s", r.Source, r.Line, r.Pattern)
+}
+
+// IgnoreMatcher decides which paths in a project are ignored, based on the .gitignore and .caiusignore files in the project.
+// Ignore files in subdirectories are loaded with LoadDir as the project is walked.
+type IgnoreMatcher struct {
+	root       string
+	rules      []IgnoreRule
+	loadedDirs map[string]bool
+}
+
+// NewIgnoreMatcher creates a matcher for the project at root, and loads the root's ignore files (including .git/info/exclude).
+func NewIgnoreMatcher(root string) (*IgnoreMatcher, error) {
+	m := &IgnoreMatcher{
+		root:       root,
+		loadedDirs: map[string]bool{},
+	}
+	err := m.loadFile(filepath.Join(".git", "info", "exclude"), "")
+	if err != nil {
+		return nil, err
+	}
+	err = m.LoadDir("")
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// LoadDir loads the ignore files of a directory (relative to the project root). Loading a directory more than once does nothing.
+//
+// Rules only apply to paths inside the directory their ignore file is in, and rules from deeper directories take precedence,
+// so directories should be loaded from the top down (like filepath.WalkDir does).
+func (m *IgnoreMatcher) LoadDir(relDir string) error {
+	relDir = cleanRelPath(relDir)
+	if m.loadedDirs[relDir] {
+		return nil
+	}
+	m.loadedDirs[relDir] = true
+
+	for _, name := range ignoreFileNames {
+		err := m.loadFile(path.Join(relDir, name), relDir)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *IgnoreMatcher) loadFile(relPath string, base string) error {
+	f, err := os.Open(filepath.Join(m.root, filepath.FromSlash(relPath)))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		rule, ok := ParseIgnoreRule(scanner.Text())
+		if !ok {
+			continue
+		}
+		rule.Source = filepath.ToSlash(relPath)
+		rule.Line = lineNum
+		rule.Base = base
+		m.rules = append(m.rules, rule)
+	}
+	return scanner.Err()
+}
+
+// ParseIgnoreRule parses a line of a .gitignore file. Returns false if the line has no pattern (blank lines and comments).
+func ParseIgnoreRule(line string) (IgnoreRule, bool) {
+	// trailing spaces are ignored, unless escaped with a backslash
+	line = strings.TrimRight(line, "\r")
+	for strings.HasSuffix(line, " ") && !strings.HasSuffix(line, "\\ ") {
+		line = line[:len(line)-1]
+	}
+	if line == "" || strings.HasPrefix(line, "#") {
+		return IgnoreRule{}, false
+	}
+
+	rule := IgnoreRule{Pattern: line}
+	pattern := line
+	if strings.HasPrefix(pattern, "!") {
+		rule.Negate = true
+		pattern = pattern[1:]
+	}
+	if strings.HasSuffix(pattern, "/") {
+		rule.DirOnly = true
+		pattern = strings.TrimRight(pattern, "/")
+	}
+	if pattern == "" {
+		return IgnoreRule{}, false
+	}
+
+	// a slash at the beginning or middle of the pattern anchors it to the ignore file's directory.
+	// otherwise, it can match at any level below it.
+	anchored := strings.Contains(pattern, "/")
+	pattern = strings.TrimPrefix(pattern, "/")
+
+	expr := globToRegexp(pattern)
+	if !anchored {
+		expr = "(?:.*/)?" + expr
+	}
+	re, err := regexp.Compile("^" + expr + "$")
+	if err != nil {
+		return IgnoreRule{}, false
+	}
+	rule.re = re
+	return rule, true
+}
+
+// globToRegexp converts a gitignore glob to a regular expression.
+func globToRegexp(pattern string) string {
+	var sb strings.Builder
+	for i := 0; i < len(pattern); i++ {
+		c := pattern[i]
+		switch c {
+		case '*':
+			if i+1 < len(pattern) && pattern[i+1] == '*' {
+				atStart := i == 0 || pattern[i-1] == '/'
+				if atStart && i+2 < len(pattern) && pattern[i+2] == '/' {
+					// "**/" matches zero or more directories
+					sb.WriteString("(?:.*/)?")
+					i += 2
+					continue
+				}
+				if atStart && i+2 == len(pattern) {
+					// trailing "/**" matches everything inside
+					sb.WriteString(".*")
+					i++
+					continue
+				}
+				// any other "**" is just a regular "*"
+				i++
+			}
+			sb.WriteString("[^/]*")
+		case '?':
+			sb.WriteString("[^/]")
+		case '[':
+			end := strings.IndexByte(pattern[i+1:], ']')
+			if end == -1 {
+				sb.WriteString(regexp.QuoteMeta("["))
+				continue
+			}
+			class := pattern[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			sb.WriteString("[" + strings.ReplaceAll(class, "\\", "\\\\") + "]")
+			i += end + 1
+		case '\\':
+			if i+1 < len(pattern) {
+				i++
+				sb.WriteString(regexp.QuoteMeta(string(pattern[i])))
+			}
+		default:
+			sb.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	return sb.String()
+}
+
+func cleanRelPath(relPath string) string {
+	relPath = path.Clean(filepath.ToSlash(relPath))
+	if relPath == "." || relPath == "/" {
+		return ""
+	}
+	return strings.TrimPrefix(relPath, "/")
+}
+
+// Match finds the rule that decides whether a path (relative to the project root) is ignored.
+// Returns false if no rule matches. The path is ignored if a rule matched and it isn't a negation.
+//
+// Only the path itself is checked; if a parent directory is ignored, the path should be treated as ignored too (see Explain).
+func (m *IgnoreMatcher) Match(relPath string, isDir bool) (IgnoreRule, bool) {
+	relPath = cleanRelPath(relPath)
+
+	// the last matching rule wins
+	for i := len(m.rules) - 1; i >= 0; i-- {
+		rule := m.rules[i]
+		if rule.DirOnly && !isDir {
+			continue
+		}
+		target := relPath
+		if rule.Base != "" {
+			var inBase bool
+			target, inBase = strings.CutPrefix(relPath, rule.Base+"/")
+			if !inBase {
+				continue
+			}
+		}
+		if rule.re.MatchString(target) {
+			return rule, true
+		}
+	}
+	return IgnoreRule{}, false
+}
+
+// IsIgnored reports whether a path (relative to the project root) is ignored by the loaded rules.
+func (m *IgnoreMatcher) IsIgnored(relPath string, isDir bool) bool {
+	rule, matched := m.Match(relPath, isDir)
+	return matched && !rule.Negate
+}
+
+type IgnoreExplanation struct {
+	Path    string
+	Ignored bool
+	Reason  string
+	Rule    *IgnoreRule // the rule that decided the outcome, if any
+}
+
+// ExplainIgnore explains why a path would be included in or skipped by GetProjectFiles.
+// relPath is relative to the project root.
+func ExplainIgnore(root string, relPath string, op GetProjectFilesOptions) (IgnoreExplanation, error) {
+	relPath = cleanRelPath(relPath)
+	explanation := IgnoreExplanation{Path: relPath}
+
+	info, err := os.Stat(filepath.Join(root, filepath.FromSlash(relPath)))
+	if err != nil {
+		return explanation, err
+	}
+
+	var matcher *IgnoreMatcher
+	if op.SkipIgnored {
+		matcher, err = NewIgnoreMatcher(root)
+		if err != nil {
+			return explanation, err
+		}
+	}
+
+	// check each directory on the way down, since an ignored directory is never walked into
+	parts := []string{}
+	if relPath != "" {
+		parts = strings.Split(relPath, "/")
+	}
+	for i, name := range parts {
+		current := strings.Join(parts[:i+1], "/")
+		isDir := i < len(parts)-1 || info.IsDir()
+
+		if reason := builtinSkipReason(name, isDir, op); reason != "" {
+			explanation.Ignored = true
+			explanation.Reason = fmt.Sprintf("%s: %s", current, reason)
+			return explanation, nil
+		}
+
+		if matcher == nil {
+			continue
+		}
+		rule, matched := matcher.Match(current, isDir)
+		if matched && !rule.Negate {
+			explanation.Ignored = true
+			explanation.Rule = &rule
+			if current == relPath {
+				explanation.Reason = fmt.Sprintf("matched by rule %q (%s:%v)", rule.Pattern, rule.Source, rule.Line)
+			} else {
+				explanation.Reason = fmt.Sprintf("parent directory %s/ is matched by rule %q (%s:%v)", current, rule.Pattern, rule.Source, rule.Line)
+			}
+			return explanation, nil
+		}
+		if matched && current == relPath {
+			explanation.Rule = &rule
+			explanation.Reason = fmt.Sprintf("re-included by rule %q (%s:%v)", rule.Pattern, rule.Source, rule.Line)
+			return explanation, nil
+		}
+		if isDir {
+			err = matcher.LoadDir(current)
+			if err != nil {
+				return explanation, err
+			}
+		}
+	}
+
+	explanation.Reason = "no ignore rule matches"
+	return explanation, nil
+}
+
+// builtinSkipReason checks the rules that GetProjectFiles always applies, regardless of ignore files.
+func builtinSkipReason(name string, isDir bool, op GetProjectFilesOptions) string {
+	if op.SkipDotfiles && name[0] == '.' {
+		return "dotfiles are skipped"
+	}
+	if isDir && isSkipDir(name) {
+		return "always skipped directory"
+	}
+	return ""
+}
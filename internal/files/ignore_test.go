@@ -0,0 +1,144 @@
+package files
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestParseIgnoreRule(t *testing.T) {
+	testCases := []struct {
+		pattern string
+		path    string
+		isDir   bool
+		match   bool
+	}{
+		{"*.log", "debug.log", false, true},
+		{"*.log", "logs/debug.log", false, true},
+		{"*.log", "debug.log.txt", false, false},
+		{"dist/", "dist", true, true},
+		{"dist/", "dist", false, false},
+		{"dist/", "app/dist", true, true},
+		{"/build", "build", true, true},
+		{"/build", "app/build", true, false},
+		{"doc/frotz", "doc/frotz", true, true},
+		{"doc/frotz", "a/doc/frotz", true, false},
+		{"**/foo", "foo", false, true},
+		{"**/foo", "a/b/foo", false, true},
+		{"a/**/b", "a/b", false, true},
+		{"a/**/b", "a/x/y/b", false, true},
+		{"abc/**", "abc/x/y", false, true},
+		{"abc/**", "abc", true, false},
+		{"file?.txt", "file1.txt", false, true},
+		{"file?.txt", "file10.txt", false, false},
+		{"[a-c].go", "b.go", false, true},
+		{"[!a-c].go", "b.go", false, false},
+		{"\\#notacomment", "#notacomment", false, true},
+		{"vendor", "vendor", true, true},
+		{"vendor", "src/vendor", true, true},
+	}
+
+	for _, testCase := range testCases {
+		rule, ok := ParseIgnoreRule(testCase.pattern)
+		if !ok {
+			t.Errorf("failed to parse pattern %q", testCase.pattern)
+			continue
+		}
+		m := &IgnoreMatcher{rules: []IgnoreRule{rule}}
+		_, matched := m.Match(testCase.path, testCase.isDir)
+		if matched != testCase.match {
+			t.Errorf("pattern %q, path %q (dir=%v): expected match=%v, got %v", testCase.pattern, testCase.path, testCase.isDir, testCase.match, matched)
+		}
+	}
+
+	for _, line := range []string{"", "   ", "# comment", "!"} {
+		if _, ok := ParseIgnoreRule(line); ok {
+			t.Errorf("expected %q to not be a rule", line)
+		}
+	}
+}
+
+func writeTestFiles(t *testing.T, root string, fileContents map[string]string) {
+	for name, content := range fileContents {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestGetProjectFilesIgnored(t *testing.T) {
+	root := t.TempDir()
+	writeTestFiles(t, root, map[string]string{
+		".gitignore":           "*.log\ndist/\n/vendor\n!important.log\n",
+		".caiusignore":         "generated/\n",
+		"main.go":              "",
+		"debug.log":            "",
+		"important.log":        "",
+		"dist/app.js":          "",
+		"vendor/lib/lib.go":    "",
+		"src/vendor/keep.go":   "",
+		"src/generated/gen.go": "",
+		"src/.gitignore":       "*.tmp\n!keep.tmp\n",
+		"src/a.tmp":            "",
+		"src/keep.tmp":         "",
+		"other/b.tmp":          "",
+		"node_modules/x/x.js":  "",
+	})
+
+	fileList, err := GetProjectFiles(root, GetProjectFilesOptions{SkipDotfiles: true, SkipIgnored: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := []string{}
+	for _, file := range fileList {
+		rel, _ := filepath.Rel(root, file)
+		got = append(got, filepath.ToSlash(rel))
+	}
+	expected := []string{"important.log", "main.go", "other/b.tmp", "src/keep.tmp", "src/vendor/keep.go"}
+	slices.Sort(got)
+	if !slices.Equal(got, expected) {
+		t.Errorf("expected files %v, got %v", expected, got)
+	}
+}
+
+func TestExplainIgnore(t *testing.T) {
+	root := t.TempDir()
+	writeTestFiles(t, root, map[string]string{
+		".gitignore":    "build/\n*.log\n!keep.log\n",
+		"build/out.txt": "",
+		"app.log":       "",
+		"keep.log":      "",
+		"main.go":       "",
+		".env":          "",
+	})
+	op := GetProjectFilesOptions{SkipDotfiles: true, SkipIgnored: true}
+
+	testCases := []struct {
+		path    string
+		ignored bool
+		line    int
+	}{
+		{"build/out.txt", true, 1},
+		{"app.log", true, 2},
+		{"keep.log", false, 3},
+		{"main.go", false, 0},
+		{".env", true, 0},
+	}
+	for _, testCase := range testCases {
+		explanation, err := ExplainIgnore(root, testCase.path, op)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if explanation.Ignored != testCase.ignored {
+			t.Errorf("%s: expected ignored=%v, got %v (%s)", testCase.path, testCase.ignored, explanation.Ignored, explanation.Reason)
+		}
+		if testCase.line != 0 && (explanation.Rule == nil || explanation.Rule.Line != testCase.line) {
+			t.Errorf("%s: expected rule on line %v, got %+v", testCase.path, testCase.line, explanation.Rule)
+		}
+	}
+}
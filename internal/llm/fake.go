@@ -0,0 +1,204 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// FakeProvider is a deterministic, in-process Provider that never talks to a real model.
+//
+// It's meant for tests, and for running caius (e.g. in CI) without having to pull any models.
+// By default, plain completions echo the first line of the prompt, and JSON completions are built from the schema
+// (every string property becomes "fake <property name>", numbers are 0, etc).
+// Chats are treated as plain completions of their last message, with the first system message as the system prompt.
+// Streamed responses are delivered word by word.
+// Embeddings are hashed bags of words, so texts that share words are similar.
+// Calls made with a cancelled context fail with the context's error, like a real backend would.
+type FakeProvider struct {
+	// Respond overrides the default responses. schema is nil for plain text completions.
+	Respond func(req CompletionRequest, schema json.RawMessage) (string, error)
+	// Models that the fake reports as installed. Pulling a model adds it here.
+	Models []string
+
+	mu    sync.Mutex
+	calls []CompletionRequest
+}
+
+func (f *FakeProvider) Name() string {
+	return "fake"
+}
+
+func (f *FakeProvider) Complete(ctx context.Context, req CompletionRequest) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	f.recordCall(req)
+	if f.Respond != nil {
+		return f.Respond(req, nil)
+	}
+	firstLine, _, _ := strings.Cut(strings.TrimSpace(req.Prompt), "\n")
+	return fmt.Sprintf("fake completion (%s): %s", req.Model, firstLine), nil
+}
+
+func (f *FakeProvider) CompleteJson(ctx context.Context, req CompletionRequest, schema json.RawMessage) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	f.recordCall(req)
+	if f.Respond != nil {
+		return f.Respond(req, schema)
+	}
+	value, err := FakeValueFromSchema(schema)
+	if err != nil {
+		return "", err
+	}
+	b, err := json.Marshal(value)
+	return string(b), err
+}
+
+func (f *FakeProvider) Chat(ctx context.Context, req ChatRequest) (string, error) {
+	completionReq := CompletionRequest{Model: req.Model, Temperature: req.Temperature}
+	for _, m := range req.Messages {
+		if m.Role == "system" && completionReq.SystemPrompt == "" {
+			completionReq.SystemPrompt = m.Content
+		}
+	}
+	if len(req.Messages) > 0 {
+		completionReq.Prompt = req.Messages[len(req.Messages)-1].Content
+	}
+	return f.Complete(ctx, completionReq)
+}
+
+func (f *FakeProvider) CompleteStream(ctx context.Context, req CompletionRequest, fn StreamFunc) (string, error) {
+	response, err := f.Complete(ctx, req)
+	if err != nil {
+		return "", err
+	}
+	return response, fakeStream(ctx, response, fn)
+}
+
+func (f *FakeProvider) ChatStream(ctx context.Context, req ChatRequest, fn StreamFunc) (string, error) {
+	response, err := f.Chat(ctx, req)
+	if err != nil {
+		return "", err
+	}
+	return response, fakeStream(ctx, response, fn)
+}
+
+func fakeStream(ctx context.Context, response string, fn StreamFunc) error {
+	for _, word := range strings.SplitAfter(response, " ") {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		fn(word)
+	}
+	return nil
+}
+
+// number of dimensions of the fake embeddings
+const fakeEmbeddingSize = 64
+
+func (f *FakeProvider) Embed(ctx context.Context, model string, inputs []string) ([][]float32, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	embeddings := make([][]float32, len(inputs))
+	for i, input := range inputs {
+		vec := make([]float32, fakeEmbeddingSize)
+		words := strings.FieldsFunc(strings.ToLower(input), func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+		})
+		for _, w := range words {
+			h := fnv.New32a()
+			h.Write([]byte(w))
+			vec[h.Sum32()%fakeEmbeddingSize]++
+		}
+		embeddings[i] = vec
+	}
+	return embeddings, nil
+}
+
+func (f *FakeProvider) ListModels() ([]string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return slices.Clone(f.Models), nil
+}
+
+func (f *FakeProvider) PullModel(ctx context.Context, model string, progress func(PullProgress)) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if !slices.Contains(f.Models, model) {
+		f.Models = append(f.Models, model)
+	}
+	if progress != nil {
+		progress(PullProgress{Status: "success", Total: 1, Completed: 1})
+	}
+	return nil
+}
+
+func (f *FakeProvider) Health() error {
+	return nil
+}
+
+func (f *FakeProvider) recordCall(req CompletionRequest) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls = append(f.calls, req)
+}
+
+// Calls returns every completion request the fake has received, in order.
+func (f *FakeProvider) Calls() []CompletionRequest {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return slices.Clone(f.calls)
+}
+
+// FakeValueFromSchema builds a placeholder value that satisfies the given JSON schema.
+func FakeValueFromSchema(schema json.RawMessage) (any, error) {
+	if len(schema) == 0 {
+		return map[string]any{}, nil
+	}
+	s, err := ParseSchema(schema)
+	if err != nil {
+		return nil, fmt.Errorf("fake provider: invalid schema; %w", err)
+	}
+	return fakeValue(s, "value"), nil
+}
+
+func fakeValue(s *Schema, name string) any {
+	if len(s.Enum) > 0 {
+		return s.Enum[0]
+	}
+	schemaType := ""
+	if len(s.Type) > 0 {
+		schemaType = s.Type[0]
+	}
+	switch schemaType {
+	case "object":
+		obj := map[string]any{}
+		keys := make([]string, 0, len(s.Properties))
+		for k := range s.Properties {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			obj[k] = fakeValue(s.Properties[k], k)
+		}
+		return obj
+	case "array":
+		return []any{}
+	case "integer", "number":
+		return 0
+	case "boolean":
+		return false
+	default:
+		return "fake " + name
+	}
+}
@@ -1,13 +1,17 @@
 package llm
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"log"
+	"slices"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/webbben/caius/internal/metrics"
-	ollamawrapper "github.com/webbben/ollama-wrapper"
 )
 
 type models struct {
@@ -43,6 +47,10 @@ type models struct {
 	// This is the slowest model, so I don't think I'll be making use of it.
 	// Maybe on beefier systems it would be useful for writing code though?
 	CodeLlama13b string
+	// Embedding model, used for semantic search.
+	//
+	// Size: 274 MB
+	NomicEmbed string
 }
 
 var Models models = models{
@@ -53,88 +61,299 @@ var Models models = models{
 	DeepSeekCoder6b: "deepseek-coder:6.7b",
 	CodeLlama:       "codellama:7b",
 	CodeLlama13b:    "codellama:13b",
+	NomicEmbed:      "nomic-embed-text",
+}
+
+// DefaultContextWindow is the context window (in tokens) assumed for models that aren't in ModelContextWindows.
+// This matches ollama's default num_ctx.
+var DefaultContextWindow int = 4096
+
+// ModelContextWindows is the number of tokens each model can take in a single prompt (including the system prompt and its response).
+// For ollama, this is sent as the num_ctx option, so raising it here makes ollama actually use a larger context (and more memory).
+var ModelContextWindows map[string]int = map[string]int{
+	Models.Llama3:          8192,
+	Models.DeepSeek:        8192,
+	Models.DeepSeek14b:     8192,
+	Models.DeepSeekCoder:   8192,
+	Models.DeepSeekCoder6b: 8192,
+	Models.CodeLlama:       8192,
+	Models.CodeLlama13b:    8192,
+}
+
+// ContextWindow gives the context window size (in tokens) of the given model.
+func ContextWindow(model string) int {
+	if size, ok := ModelContextWindows[model]; ok && size > 0 {
+		return size
+	}
+	return DefaultContextWindow
+}
+
+// EstimateTokens gives a rough estimate of the number of tokens in a string (~4 characters per token).
+func EstimateTokens(s string) int {
+	return len(s) / 4
+}
+
+// ResponseTokenReserve is the number of tokens to leave free in the context window for the model's response
+const ResponseTokenReserve int = 1024
+
+// PromptBudget gives the number of tokens left in a model's context window once the given prompts are in it,
+// and reserve tokens are left free for the response (usually ResponseTokenReserve). It can be negative if they don't fit.
+func PromptBudget(model string, reserve int, prompts ...string) int {
+	budget := ContextWindow(model) - reserve
+	for _, prompt := range prompts {
+		budget -= EstimateTokens(prompt)
+	}
+	return budget
+}
+
+var provider Provider = &OllamaProvider{}
+var currentModel string = Models.DeepSeek
+var currentModelMutex sync.RWMutex
+
+// SetProvider changes the backend that all LLM calls are sent to.
+func SetProvider(p Provider) {
+	requireMutex.Lock()
+	defer requireMutex.Unlock()
+	provider = p
+	requiredModels = map[string]bool{}
+}
+
+func GetProvider() Provider {
+	return provider
 }
 
 func RecordLLMUsage(startTime time.Time) {
+	recordModelUsage(GetModel(), startTime)
+}
+
+func recordModelUsage(model string, startTime time.Time) {
 	if !metrics.LOG_LLM_USAGE {
 		return
 	}
-	curModel := ollamawrapper.GetModel()
-	if curModel == "" {
+	if model == "" {
 		log.Println("failed to log model usage; no model name found")
 		return
 	}
 
-	metrics.RecordModelUsage(curModel, startTime)
+	metrics.RecordModelUsage(model, startTime)
 }
 
-func StartServer() (int32, error) {
-	pid, err := ollamawrapper.StartServer()
-	return pid, err
+// IsModelInstalled reports if the model is in the list of installed models.
+// Model names without a tag are treated as ":latest", the same way ollama does.
+func IsModelInstalled(model string, installed []string) bool {
+	name := model
+	if !strings.Contains(name, ":") {
+		name += ":latest"
+	}
+	return slices.Contains(installed, model) || slices.Contains(installed, name)
 }
 
-func SetModel(model string) {
-	ollamawrapper.SetModel(model)
+// EnsureModelIsPulled checks if the model is available in the current provider, and pulls it if not.
+func EnsureModelIsPulled(ctx context.Context, model string, fn func(PullProgress)) error {
+	models, err := provider.ListModels()
+	if err != nil {
+		return errors.Join(errors.New("EnsureModelIsPulled: failed to get local models;"), err)
+	}
+	if IsModelInstalled(model, models) {
+		return nil
+	}
+	return provider.PullModel(ctx, model, fn)
 }
 
-func WakeUp() error {
-	client, err := ollamawrapper.GetClient()
+var requireMutex sync.Mutex
+var requiredModels map[string]bool = map[string]bool{}
+
+// Require gets the current provider ready to serve the given models: it starts the provider's server if it has one
+// (see Lifecycle), and pulls any models that aren't installed yet. Models that were already ensured aren't checked again.
+//
+// Commands call this right before they need the LLM, so that commands that don't use it never start a server or pull anything.
+func Require(ctx context.Context, progress func(model string, p PullProgress), models ...string) error {
+	requireMutex.Lock()
+	defer requireMutex.Unlock()
+
+	if lc, ok := provider.(Lifecycle); ok {
+		if err := lc.Start(); err != nil {
+			return err
+		}
+	}
+
+	missing := []string{}
+	for _, model := range models {
+		if model != "" && !requiredModels[model] && !slices.Contains(missing, model) {
+			missing = append(missing, model)
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+
+	installed, err := provider.ListModels()
 	if err != nil {
-		return err
+		return errors.Join(errors.New("Require: failed to get local models;"), err)
+	}
+	for _, model := range missing {
+		if !IsModelInstalled(model, installed) {
+			err := provider.PullModel(ctx, model, func(p PullProgress) {
+				if progress != nil {
+					progress(model, p)
+				}
+			})
+			if err != nil {
+				return errors.Join(fmt.Errorf("Require: failed to pull model %s;", model), err)
+			}
+		}
+		requiredModels[model] = true
 	}
+	return nil
+}
+
+// Shutdown stops anything that Require started for the current provider (e.g. an ollama server that wasn't already running).
+// It's safe to call more than once.
+func Shutdown() error {
+	if lc, ok := provider.(Lifecycle); ok {
+		return lc.Stop()
+	}
+	return nil
+}
+
+// SetModel sets the model used by calls that don't specify one.
+// When making calls from multiple goroutines, prefer the WithModel variants (e.g. GenerateCompletionJsonWithModel) instead.
+func SetModel(model string) {
+	currentModelMutex.Lock()
+	defer currentModelMutex.Unlock()
+	currentModel = model
+}
 
-	_, err = ollamawrapper.GenerateCompletion(client, "say hi", "hi!")
+func GetModel() string {
+	currentModelMutex.RLock()
+	defer currentModelMutex.RUnlock()
+	return currentModel
+}
+
+func WakeUp(ctx context.Context) error {
+	_, err := provider.Complete(ctx, CompletionRequest{
+		Model:        GetModel(),
+		SystemPrompt: "say hi",
+		Prompt:       "hi!",
+	})
 	return err
 }
 
 var EmptyResponseError = errors.New("GenerateCompletionJson: no data returned by LLM")
 
-func GenerateCompletionJson(systemPrompt string, prompt string, formatSchema json.RawMessage, v any) error {
+func GenerateCompletionJson(ctx context.Context, systemPrompt string, prompt string, formatSchema json.RawMessage, v any) error {
+	return GenerateCompletionJsonWithModel(ctx, GetModel(), systemPrompt, prompt, formatSchema, v)
+}
+
+// GenerateCompletionJsonWithModel is the same as GenerateCompletionJson, but uses the given model instead of the one set by SetModel.
+//
+// Failed calls are retried according to the retry policy (see SetRetryPolicy). If the response isn't valid JSON, or doesn't
+// match the schema, it's sent back to the model along with the error to be fixed (up to RetryPolicy.RepairAttempts times).
+func GenerateCompletionJsonWithModel(ctx context.Context, model string, systemPrompt string, prompt string, formatSchema json.RawMessage, v any) error {
 	start := time.Now()
-	client, err := ollamawrapper.GetClient()
-	if err != nil {
-		return errors.Join(errors.New("GenerateCompletionJson: error getting client;"), err)
+
+	var schema *Schema
+	if len(formatSchema) > 0 {
+		var err error
+		schema, err = ParseSchema(formatSchema)
+		if err != nil {
+			return errors.Join(errors.New("GenerateCompletionJson: invalid format schema;"), err)
+		}
 	}
 
-	response, err := ollamawrapper.GenerateCompletionOptsFormat(client, systemPrompt, prompt, map[string]interface{}{
-		"temperature": 0.0,
-	}, formatSchema)
+	req := CompletionRequest{
+		Model:        model,
+		SystemPrompt: systemPrompt,
+		Prompt:       prompt,
+		Temperature:  0.0,
+	}
+	// reasoning models may think before answering, even when asked for JSON; only the answer is decoded
+	complete := func(ctx context.Context) (Response, error) {
+		raw, err := provider.CompleteJson(ctx, req, formatSchema)
+		if err != nil {
+			return Response{}, err
+		}
+		return splitResponse(raw, false)
+	}
+
+	response, err := withRetry(ctx, model, complete)
 	if err != nil {
 		return errors.Join(errors.New("GenerateCompletionJson: error generating completion;"), err)
 	}
 
-	if response == "" {
-		return EmptyResponseError
+	repairs := GetRetryPolicy().RepairAttempts
+	for {
+		err = decodeJsonResponse(response.Answer, schema, v)
+		if err == nil {
+			break
+		}
+		if repairs <= 0 {
+			log.Printf("\nresponse:\n%s\n", response.Answer)
+			return errors.Join(errors.New("GenerateCompletionJson: invalid JSON in LLM response;"), err)
+		}
+		repairs--
+		metrics.RecordModelRepair(model)
+		req.Prompt = repairPrompt(prompt, response.Answer, err)
+		response, err = withRetry(ctx, model, complete)
+		if err != nil {
+			return errors.Join(errors.New("GenerateCompletionJson: error generating completion;"), err)
+		}
 	}
 
-	err = json.Unmarshal([]byte(response), &v)
-	if err != nil {
-		log.Printf("\nresponse:\n%s\n", response)
-		return errors.Join(errors.New("GenerateCompletionJson: error unmarshalling JSON in LLM response;"), err)
+	recordResponse(model, start, response)
+	return nil
+}
+
+// decodeJsonResponse validates the response against the schema (if there is one), and unmarshals it into v.
+func decodeJsonResponse(response string, schema *Schema, v any) error {
+	if schema != nil {
+		if err := schema.Validate([]byte(response)); err != nil {
+			return err
+		}
 	}
+	return json.Unmarshal([]byte(response), v)
+}
 
-	RecordLLMUsage(start)
-	return nil
+// repairPrompt asks the model to fix an invalid response to the original prompt
+func repairPrompt(prompt string, response string, err error) string {
+	return fmt.Sprintf("%s\n\n---\n\nYour previous response to this was invalid.\n\nPrevious response:\n%s\n\nError: %s\n\nRespond again with only the corrected JSON.", prompt, response, err)
 }
 
 // GenerateSimpleCompletion generates a completion without a JSON format, or anything fancy like that. Just plain ol' text.
-func GenerateSimpleCompletion(systemPrompt string, prompt string) (string, error) {
+//
+// Only the answer is returned; the reasoning of reasoning models (e.g. deepseek-r1's <think> section) is left out.
+// Use GenerateSimpleCompletionStream to get the reasoning too.
+func GenerateSimpleCompletion(ctx context.Context, systemPrompt string, prompt string) (string, error) {
+	return GenerateSimpleCompletionWithModel(ctx, GetModel(), systemPrompt, prompt)
+}
+
+// GenerateSimpleCompletionWithModel is the same as GenerateSimpleCompletion, but uses the given model instead of the one set by SetModel.
+func GenerateSimpleCompletionWithModel(ctx context.Context, model string, systemPrompt string, prompt string) (string, error) {
+	response, err := GenerateSimpleCompletionStream(ctx, model, systemPrompt, prompt, nil)
+	return response.Answer, err
+}
+
+// GenerateChatCompletionWithModel generates the next (assistant) message of a conversation.
+// Like GenerateSimpleCompletion, the reasoning of reasoning models is left out.
+func GenerateChatCompletionWithModel(ctx context.Context, model string, messages []Message) (string, error) {
+	response, err := GenerateChatCompletionStream(ctx, model, messages, nil)
+	return response.Answer, err
+}
+
+// GenerateEmbeddingsWithModel generates an embedding vector for each of the inputs, using the given embedding model.
+func GenerateEmbeddingsWithModel(ctx context.Context, model string, inputs []string) ([][]float32, error) {
 	start := time.Now()
-	client, err := ollamawrapper.GetClient()
-	if err != nil {
-		return "", errors.Join(errors.New("GenerateSimpleCompletion: error getting client;"), err)
-	}
 
-	response, err := ollamawrapper.GenerateCompletionWithOpts(client, systemPrompt, prompt, map[string]interface{}{
-		"temperature": 0.0,
+	embeddings, err := withRetry(ctx, model, func(ctx context.Context) ([][]float32, error) {
+		return provider.Embed(ctx, model, inputs)
 	})
 	if err != nil {
-		return "", errors.Join(errors.New("GenerateSimpleCompletion: error generating completion;"), err)
+		return nil, errors.Join(errors.New("GenerateEmbeddings: error generating embeddings;"), err)
 	}
-	if response == "" {
-		return "", EmptyResponseError
+	if len(embeddings) != len(inputs) {
+		return nil, fmt.Errorf("GenerateEmbeddings: expected %v embeddings, got %v", len(inputs), len(embeddings))
 	}
 
-	RecordLLMUsage(start)
-	return response, nil
+	recordModelUsage(model, start)
+	return embeddings, nil
 }
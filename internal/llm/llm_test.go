@@ -0,0 +1,88 @@
+package llm_test
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/webbben/caius/internal/llm"
+)
+
+// lifecycleProvider is a fake provider with a "server" that needs to be started
+type lifecycleProvider struct {
+	*llm.FakeProvider
+	starts, stops int
+}
+
+func (l *lifecycleProvider) Start() error {
+	l.starts++
+	return nil
+}
+
+func (l *lifecycleProvider) Stop() error {
+	l.stops++
+	return nil
+}
+
+func TestRequire(t *testing.T) {
+	prev := llm.GetProvider()
+	t.Cleanup(func() { llm.SetProvider(prev) })
+
+	provider := &lifecycleProvider{FakeProvider: &llm.FakeProvider{Models: []string{"installed:latest"}}}
+	llm.SetProvider(provider)
+
+	pulled := []string{}
+	progress := func(model string, p llm.PullProgress) {
+		pulled = append(pulled, model)
+	}
+	if err := llm.Require(context.Background(), progress, "installed", "missing:7b", "missing:7b", ""); err != nil {
+		t.Fatal(err)
+	}
+	if provider.starts != 1 {
+		t.Errorf("expected the provider to be started once, got %v", provider.starts)
+	}
+	if !slices.Equal(pulled, []string{"missing:7b"}) {
+		t.Errorf("expected only the missing model to be pulled once, got %v", pulled)
+	}
+
+	// requiring the same models again doesn't pull anything
+	pulled = nil
+	if err := llm.Require(context.Background(), progress, "missing:7b"); err != nil {
+		t.Fatal(err)
+	}
+	if len(pulled) != 0 {
+		t.Errorf("expected no models to be pulled again, got %v", pulled)
+	}
+
+	if err := llm.Shutdown(); err != nil {
+		t.Fatal(err)
+	}
+	if provider.stops != 1 {
+		t.Errorf("expected the provider to be stopped, got %v stops", provider.stops)
+	}
+}
+
+func TestIsModelInstalled(t *testing.T) {
+	installed := []string{"llama3.2:3b", "nomic-embed-text:latest"}
+	cases := map[string]bool{
+		"llama3.2:3b":             true,
+		"nomic-embed-text":        true,
+		"nomic-embed-text:latest": true,
+		"llama3.2":                false,
+		"deepseek-r1:7b":          false,
+	}
+	for model, expected := range cases {
+		if got := llm.IsModelInstalled(model, installed); got != expected {
+			t.Errorf("IsModelInstalled(%q) = %v, expected %v", model, got, expected)
+		}
+	}
+}
+
+func TestPromptBudget(t *testing.T) {
+	window := llm.ContextWindow("some-unknown-model")
+	budget := llm.PromptBudget("some-unknown-model", 100, strings.Repeat("x", 400), strings.Repeat("y", 40))
+	if expected := window - 100 - 100 - 10; budget != expected {
+		t.Errorf("expected a budget of %v tokens, got %v", expected, budget)
+	}
+}
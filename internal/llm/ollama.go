@@ -0,0 +1,252 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+
+	"github.com/ollama/ollama/api"
+	ollamawrapper "github.com/webbben/ollama-wrapper"
+)
+
+// how long to wait for a server we started to start responding
+const ollamaStartupTimeout = 30 * time.Second
+
+// how long to wait for a server we started to shut down, before killing it
+const ollamaShutdownTimeout = 5 * time.Second
+
+// OllamaProvider sends prompts to a local ollama server.
+//
+// If no server is running when Start is called, it starts one ("ollama serve"), and Stop shuts that server down again.
+// A server that was already running is left alone.
+type OllamaProvider struct {
+	mu     sync.Mutex
+	server *exec.Cmd // the server process we started, if any
+	exited chan struct{}
+}
+
+func (o *OllamaProvider) Name() string {
+	return "ollama"
+}
+
+func (o *OllamaProvider) Complete(ctx context.Context, req CompletionRequest) (string, error) {
+	return o.generate(ctx, req, nil, nil)
+}
+
+func (o *OllamaProvider) CompleteJson(ctx context.Context, req CompletionRequest, schema json.RawMessage) (string, error) {
+	return o.generate(ctx, req, schema, nil)
+}
+
+func (o *OllamaProvider) CompleteStream(ctx context.Context, req CompletionRequest, fn StreamFunc) (string, error) {
+	return o.generate(ctx, req, nil, fn)
+}
+
+// the ollama-wrapper generate functions always use its global model, so we use the client directly here.
+// this way each request can specify its own model.
+// If fn is set, the response is streamed to it.
+func (o *OllamaProvider) generate(ctx context.Context, req CompletionRequest, format json.RawMessage, fn StreamFunc) (string, error) {
+	client, err := ollamawrapper.GetClient()
+	if err != nil {
+		return "", errors.Join(errors.New("ollama: error getting client;"), err)
+	}
+
+	stream := fn != nil
+	genReq := &api.GenerateRequest{
+		Model:  req.Model,
+		Prompt: req.Prompt,
+		System: req.SystemPrompt,
+		Stream: &stream,
+		Format: format,
+		Options: map[string]any{
+			"temperature": req.Temperature,
+			"num_ctx":     ContextWindow(req.Model),
+		},
+	}
+
+	response := ""
+	err = client.Generate(ctx, genReq, func(gr api.GenerateResponse) error {
+		response += gr.Response
+		if fn != nil {
+			fn(gr.Response)
+		}
+		return nil
+	})
+	return response, err
+}
+
+func (o *OllamaProvider) Chat(ctx context.Context, req ChatRequest) (string, error) {
+	return o.chat(ctx, req, nil)
+}
+
+func (o *OllamaProvider) ChatStream(ctx context.Context, req ChatRequest, fn StreamFunc) (string, error) {
+	return o.chat(ctx, req, fn)
+}
+
+func (o *OllamaProvider) chat(ctx context.Context, req ChatRequest, fn StreamFunc) (string, error) {
+	client, err := ollamawrapper.GetClient()
+	if err != nil {
+		return "", errors.Join(errors.New("ollama: error getting client;"), err)
+	}
+
+	messages := make([]api.Message, len(req.Messages))
+	for i, m := range req.Messages {
+		messages[i] = api.Message{Role: m.Role, Content: m.Content}
+	}
+	stream := fn != nil
+	chatReq := &api.ChatRequest{
+		Model:    req.Model,
+		Messages: messages,
+		Stream:   &stream,
+		Options: map[string]any{
+			"temperature": req.Temperature,
+			"num_ctx":     ContextWindow(req.Model),
+		},
+	}
+
+	response := ""
+	err = client.Chat(ctx, chatReq, func(cr api.ChatResponse) error {
+		response += cr.Message.Content
+		if fn != nil {
+			fn(cr.Message.Content)
+		}
+		return nil
+	})
+	return response, err
+}
+
+func (o *OllamaProvider) Embed(ctx context.Context, model string, inputs []string) ([][]float32, error) {
+	client, err := ollamawrapper.GetClient()
+	if err != nil {
+		return nil, errors.Join(errors.New("ollama: error getting client;"), err)
+	}
+	resp, err := client.Embed(ctx, &api.EmbedRequest{
+		Model: model,
+		Input: inputs,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return resp.Embeddings, nil
+}
+
+func (o *OllamaProvider) ListModels() ([]string, error) {
+	models, err := ollamawrapper.GetModels()
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, len(models))
+	for i, m := range models {
+		names[i] = m.Name
+	}
+	return names, nil
+}
+
+// ollamawrapper.PullModel can't be cancelled, so we use the client directly here too.
+func (o *OllamaProvider) PullModel(ctx context.Context, model string, progress func(PullProgress)) error {
+	client, err := ollamawrapper.GetClient()
+	if err != nil {
+		return errors.Join(errors.New("ollama: error getting client;"), err)
+	}
+	stream := true
+	return client.Pull(ctx, &api.PullRequest{Model: model, Stream: &stream}, func(pr api.ProgressResponse) error {
+		if progress != nil {
+			progress(PullProgress{
+				Status:    pr.Status,
+				Total:     pr.Total,
+				Completed: pr.Completed,
+			})
+		}
+		return nil
+	})
+}
+
+// Start makes sure an ollama server is running, starting one if needed.
+func (o *OllamaProvider) Start() error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if o.Health() == nil {
+		return nil
+	}
+	if o.server != nil {
+		return errors.New("ollama: server was started, but isn't responding")
+	}
+
+	cmd := exec.Command("ollama", "serve")
+	if err := cmd.Start(); err != nil {
+		return errors.Join(errors.New("ollama: failed to start server (is ollama installed?);"), err)
+	}
+	o.server = cmd
+	o.exited = make(chan struct{})
+	go func() {
+		cmd.Wait()
+		close(o.exited)
+	}()
+
+	deadline := time.Now().Add(ollamaStartupTimeout)
+	for time.Now().Before(deadline) {
+		select {
+		case <-o.exited:
+			o.server = nil
+			return errors.New("ollama: server exited right after starting")
+		case <-time.After(200 * time.Millisecond):
+		}
+		if o.Health() == nil {
+			return nil
+		}
+	}
+	return fmt.Errorf("ollama: server didn't respond within %s of starting", ollamaStartupTimeout)
+}
+
+// Stop shuts down the ollama server, if it was started by Start.
+func (o *OllamaProvider) Stop() error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if o.server == nil {
+		return nil
+	}
+	cmd := o.server
+	o.server = nil
+
+	// Ctrl-C in the terminal also interrupts the server directly, so it may already be gone
+	select {
+	case <-o.exited:
+		return nil
+	default:
+	}
+
+	// ask nicely first; interrupts aren't supported on windows, so fall back to killing it right away
+	if err := cmd.Process.Signal(os.Interrupt); err != nil {
+		if errors.Is(err, os.ErrProcessDone) {
+			return nil
+		}
+		return cmd.Process.Kill()
+	}
+	select {
+	case <-o.exited:
+		return nil
+	case <-time.After(ollamaShutdownTimeout):
+		return cmd.Process.Kill()
+	}
+}
+
+// Started reports if this provider started the server it's talking to (as opposed to using one that was already running).
+func (o *OllamaProvider) Started() bool {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.server != nil
+}
+
+func (o *OllamaProvider) Health() error {
+	client, err := ollamawrapper.GetClient()
+	if err != nil {
+		return err
+	}
+	return client.Heartbeat(context.Background())
+}
@@ -0,0 +1,295 @@
+package llm
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// OpenAIProvider talks to any server that implements the OpenAI chat completions API,
+// such as llama.cpp's server or vLLM.
+type OpenAIProvider struct {
+	BaseURL string // base URL of the API, including the version, e.g. "http://localhost:8080/v1"
+	APIKey  string // optional; sent as a bearer token if set
+	Client  *http.Client
+}
+
+type openAIJsonSchema struct {
+	Name   string          `json:"name"`
+	Schema json.RawMessage `json:"schema"`
+}
+
+type openAIResponseFormat struct {
+	Type       string            `json:"type"`
+	JsonSchema *openAIJsonSchema `json:"json_schema,omitempty"`
+}
+
+type openAIChatRequest struct {
+	Model          string                `json:"model"`
+	Messages       []Message             `json:"messages"`
+	Temperature    float64               `json:"temperature"`
+	Stream         bool                  `json:"stream"`
+	ResponseFormat *openAIResponseFormat `json:"response_format,omitempty"`
+}
+
+type openAIChatResponse struct {
+	Choices []struct {
+		Message      Message `json:"message"`
+		FinishReason string  `json:"finish_reason"`
+	} `json:"choices"`
+}
+
+// a single server-sent event of a streamed chat completion
+type openAIChatChunk struct {
+	Choices []struct {
+		Delta struct {
+			Content string `json:"content"`
+		} `json:"delta"`
+	} `json:"choices"`
+}
+
+type openAIEmbeddingRequest struct {
+	Model string   `json:"model"`
+	Input []string `json:"input"`
+}
+
+type openAIEmbeddingResponse struct {
+	Data []struct {
+		Index     int       `json:"index"`
+		Embedding []float32 `json:"embedding"`
+	} `json:"data"`
+}
+
+type openAIModelList struct {
+	Data []struct {
+		ID string `json:"id"`
+	} `json:"data"`
+}
+
+type openAIError struct {
+	Error struct {
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+func (o *OpenAIProvider) Name() string {
+	return "openai"
+}
+
+func (o *OpenAIProvider) Complete(ctx context.Context, req CompletionRequest) (string, error) {
+	return o.complete(ctx, req, nil)
+}
+
+func (o *OpenAIProvider) CompleteJson(ctx context.Context, req CompletionRequest, schema json.RawMessage) (string, error) {
+	format := &openAIResponseFormat{Type: "json_object"}
+	if len(schema) > 0 {
+		format = &openAIResponseFormat{
+			Type: "json_schema",
+			JsonSchema: &openAIJsonSchema{
+				Name:   "response",
+				Schema: schema,
+			},
+		}
+	}
+	return o.complete(ctx, req, format)
+}
+
+func (o *OpenAIProvider) Chat(ctx context.Context, req ChatRequest) (string, error) {
+	return o.chat(ctx, openAIChatRequest{
+		Model:       req.Model,
+		Messages:    req.Messages,
+		Temperature: req.Temperature,
+	})
+}
+
+func (o *OpenAIProvider) CompleteStream(ctx context.Context, req CompletionRequest, fn StreamFunc) (string, error) {
+	body := completionChatRequest(req, nil)
+	body.Stream = true
+	return o.chatStream(ctx, body, fn)
+}
+
+func (o *OpenAIProvider) ChatStream(ctx context.Context, req ChatRequest, fn StreamFunc) (string, error) {
+	return o.chatStream(ctx, openAIChatRequest{
+		Model:       req.Model,
+		Messages:    req.Messages,
+		Temperature: req.Temperature,
+		Stream:      true,
+	}, fn)
+}
+
+func (o *OpenAIProvider) complete(ctx context.Context, req CompletionRequest, format *openAIResponseFormat) (string, error) {
+	return o.chat(ctx, completionChatRequest(req, format))
+}
+
+// completionChatRequest turns a completion into a chat of a single user message (with the system prompt, if there is one)
+func completionChatRequest(req CompletionRequest, format *openAIResponseFormat) openAIChatRequest {
+	messages := []Message{}
+	if req.SystemPrompt != "" {
+		messages = append(messages, Message{Role: "system", Content: req.SystemPrompt})
+	}
+	messages = append(messages, Message{Role: "user", Content: req.Prompt})
+
+	return openAIChatRequest{
+		Model:          req.Model,
+		Messages:       messages,
+		Temperature:    req.Temperature,
+		ResponseFormat: format,
+	}
+}
+
+func (o *OpenAIProvider) chat(ctx context.Context, body openAIChatRequest) (string, error) {
+	var resp openAIChatResponse
+	err := o.do(ctx, "POST", "/chat/completions", body, &resp)
+	if err != nil {
+		return "", err
+	}
+	if len(resp.Choices) == 0 {
+		return "", nil
+	}
+	return resp.Choices[0].Message.Content, nil
+}
+
+// chatStream reads a streamed chat completion, which is sent as server-sent events ("data: {...}" lines, ending with "data: [DONE]").
+func (o *OpenAIProvider) chatStream(ctx context.Context, body openAIChatRequest, fn StreamFunc) (string, error) {
+	resp, err := o.send(ctx, "POST", "/chat/completions", body)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var response strings.Builder
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		data, ok := strings.CutPrefix(scanner.Text(), "data:")
+		if !ok {
+			continue
+		}
+		data = strings.TrimSpace(data)
+		if data == "[DONE]" {
+			break
+		}
+		var chunk openAIChatChunk
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			return response.String(), errors.Join(errors.New("openai: error unmarshalling streamed response;"), err)
+		}
+		if len(chunk.Choices) == 0 || chunk.Choices[0].Delta.Content == "" {
+			continue
+		}
+		response.WriteString(chunk.Choices[0].Delta.Content)
+		fn(chunk.Choices[0].Delta.Content)
+	}
+	if err := scanner.Err(); err != nil {
+		return response.String(), errors.Join(errors.New("openai: error reading streamed response;"), err)
+	}
+	return response.String(), nil
+}
+
+func (o *OpenAIProvider) Embed(ctx context.Context, model string, inputs []string) ([][]float32, error) {
+	var resp openAIEmbeddingResponse
+	err := o.do(ctx, "POST", "/embeddings", openAIEmbeddingRequest{Model: model, Input: inputs}, &resp)
+	if err != nil {
+		return nil, err
+	}
+	embeddings := make([][]float32, len(inputs))
+	for _, d := range resp.Data {
+		if d.Index < 0 || d.Index >= len(inputs) {
+			return nil, fmt.Errorf("openai: embedding index %v out of range", d.Index)
+		}
+		embeddings[d.Index] = d.Embedding
+	}
+	return embeddings, nil
+}
+
+func (o *OpenAIProvider) ListModels() ([]string, error) {
+	var list openAIModelList
+	err := o.do(context.Background(), "GET", "/models", nil, &list)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, len(list.Data))
+	for i, m := range list.Data {
+		names[i] = m.ID
+	}
+	return names, nil
+}
+
+// PullModel isn't supported; openai-compatible servers serve whichever models they were started with.
+func (o *OpenAIProvider) PullModel(ctx context.Context, model string, progress func(PullProgress)) error {
+	return fmt.Errorf("openai: model %q is not available on %s, and models can't be pulled through this API", model, o.BaseURL)
+}
+
+func (o *OpenAIProvider) Health() error {
+	return o.do(context.Background(), "GET", "/models", nil, nil)
+}
+
+func (o *OpenAIProvider) do(ctx context.Context, method string, path string, reqBody any, respBody any) error {
+	resp, err := o.send(ctx, method, path, reqBody)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	respBytes, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return errors.Join(errors.New("openai: error reading response body;"), err)
+	}
+	if respBody == nil {
+		return nil
+	}
+	err = json.Unmarshal(respBytes, respBody)
+	if err != nil {
+		return errors.Join(errors.New("openai: error unmarshalling response;"), err)
+	}
+	return nil
+}
+
+// send makes a request to the API, and returns the response if it was successful. The caller has to close its body.
+func (o *OpenAIProvider) send(ctx context.Context, method string, path string, reqBody any) (*http.Response, error) {
+	var body io.Reader
+	if reqBody != nil {
+		b, err := json.Marshal(reqBody)
+		if err != nil {
+			return nil, errors.Join(errors.New("openai: error marshalling request;"), err)
+		}
+		body = bytes.NewReader(b)
+	}
+
+	url := strings.TrimSuffix(o.BaseURL, "/") + path
+	req, err := http.NewRequestWithContext(ctx, method, url, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if o.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+o.APIKey)
+	}
+
+	client := o.Client
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Minute}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, errors.Join(fmt.Errorf("openai: error calling %s;", url), err)
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		defer resp.Body.Close()
+		statusErr := &StatusError{Backend: "openai", StatusCode: resp.StatusCode, Status: resp.Status}
+		var apiErr openAIError
+		respBytes, _ := io.ReadAll(resp.Body)
+		if json.Unmarshal(respBytes, &apiErr) == nil {
+			statusErr.Message = apiErr.Error.Message
+		}
+		return nil, statusErr
+	}
+	return resp, nil
+}
@@ -0,0 +1,214 @@
+package llm_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/webbben/caius/internal/llm"
+	"github.com/webbben/caius/internal/project"
+)
+
+type stubChatRequest struct {
+	Model    string `json:"model"`
+	Stream   bool   `json:"stream"`
+	Messages []struct {
+		Role    string `json:"role"`
+		Content string `json:"content"`
+	} `json:"messages"`
+	ResponseFormat *struct {
+		Type       string `json:"type"`
+		JsonSchema struct {
+			Schema json.RawMessage `json:"schema"`
+		} `json:"json_schema"`
+	} `json:"response_format"`
+}
+
+// newStubServer starts a local server that speaks the OpenAI chat completions protocol, and always replies with the given content.
+// Streamed requests get the content word by word, as server-sent events.
+func newStubServer(t *testing.T, content string, onRequest func(stubChatRequest)) *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/chat/completions", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer test-key" {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"error": {"message": "bad key"}}`))
+			return
+		}
+		var req stubChatRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Error(err)
+		}
+		if onRequest != nil {
+			onRequest(req)
+		}
+		if req.Stream {
+			w.Header().Set("Content-Type", "text/event-stream")
+			for _, word := range strings.SplitAfter(content, " ") {
+				chunk, _ := json.Marshal(map[string]any{
+					"choices": []any{map[string]any{"delta": map[string]string{"content": word}}},
+				})
+				fmt.Fprintf(w, "data: %s\n\n", chunk)
+			}
+			fmt.Fprint(w, "data: [DONE]\n\n")
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]any{
+			"choices": []any{
+				map[string]any{
+					"message":       map[string]string{"role": "assistant", "content": content},
+					"finish_reason": "stop",
+				},
+			},
+		})
+	})
+	mux.HandleFunc("/v1/embeddings", func(w http.ResponseWriter, r *http.Request) {
+		// reply out of order, to make sure embeddings are matched to their inputs by index
+		w.Write([]byte(`{"data": [{"index": 1, "embedding": [0, 1]}, {"index": 0, "embedding": [1, 0]}]}`))
+	})
+	mux.HandleFunc("/v1/models", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"data": [{"id": "qwen2.5-coder"}, {"id": "llama3.2:3b"}]}`))
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func useStubProvider(t *testing.T, server *httptest.Server) {
+	prev := llm.GetProvider()
+	llm.SetProvider(&llm.OpenAIProvider{BaseURL: server.URL + "/v1", APIKey: "test-key"})
+	t.Cleanup(func() { llm.SetProvider(prev) })
+}
+
+func TestOpenAIGenerateCompletionJson(t *testing.T) {
+	var got stubChatRequest
+	server := newStubServer(t, `{"file_type": "go", "description": "a web server"}`, func(req stubChatRequest) {
+		got = req
+	})
+	useStubProvider(t, server)
+	llm.SetModel("qwen2.5-coder")
+
+	var resp project.BasicFileAnalysisResponse
+	err := llm.GenerateCompletionJson(context.Background(), "system", "prompt", project.BasicFileAnalysisSchema, &resp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Type != "go" || resp.Description != "a web server" {
+		t.Errorf("unexpected response: %+v", resp)
+	}
+
+	if got.Model != "qwen2.5-coder" {
+		t.Errorf("expected model qwen2.5-coder, got %q", got.Model)
+	}
+	if len(got.Messages) != 2 || got.Messages[0].Role != "system" || got.Messages[1].Content != "prompt" {
+		t.Errorf("unexpected messages: %+v", got.Messages)
+	}
+	if got.ResponseFormat == nil || got.ResponseFormat.Type != "json_schema" {
+		t.Fatalf("expected json_schema response format, got %+v", got.ResponseFormat)
+	}
+	var sentSchema, expectedSchema any
+	json.Unmarshal(got.ResponseFormat.JsonSchema.Schema, &sentSchema)
+	json.Unmarshal(project.BasicFileAnalysisSchema, &expectedSchema)
+	sentJson, _ := json.Marshal(sentSchema)
+	expectedJson, _ := json.Marshal(expectedSchema)
+	if string(sentJson) != string(expectedJson) {
+		t.Errorf("schema was not sent as-is:\n%s", sentJson)
+	}
+}
+
+func TestOpenAIDetectFileTypeSchema(t *testing.T) {
+	server := newStubServer(t, `{"category": "code", "type": "python"}`, nil)
+	useStubProvider(t, server)
+
+	var resp project.DetectFileTypeLLMResponse
+	err := llm.GenerateCompletionJson(context.Background(), "system", "print('hi')", project.DetectFileTypeLLMSchema, &resp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Category != "code" || resp.Type != "python" {
+		t.Errorf("unexpected response: %+v", resp)
+	}
+}
+
+func TestOpenAISimpleCompletionAndModels(t *testing.T) {
+	var got stubChatRequest
+	server := newStubServer(t, "hello there", func(req stubChatRequest) {
+		got = req
+	})
+	useStubProvider(t, server)
+
+	out, err := llm.GenerateSimpleCompletion(context.Background(), "", "hi")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out != "hello there" {
+		t.Errorf("unexpected completion: %q", out)
+	}
+	if got.ResponseFormat != nil {
+		t.Errorf("plain completions should not set a response format")
+	}
+	if len(got.Messages) != 1 {
+		t.Errorf("expected only a user message when system prompt is empty, got %v", len(got.Messages))
+	}
+
+	models, err := llm.GetProvider().ListModels()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(models) != 2 || models[0] != "qwen2.5-coder" {
+		t.Errorf("unexpected models: %v", models)
+	}
+	if err := llm.GetProvider().Health(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestOpenAIErrorResponse(t *testing.T) {
+	server := newStubServer(t, "", nil)
+	prev := llm.GetProvider()
+	llm.SetProvider(&llm.OpenAIProvider{BaseURL: server.URL + "/v1", APIKey: "wrong"})
+	t.Cleanup(func() { llm.SetProvider(prev) })
+
+	_, err := llm.GenerateSimpleCompletion(context.Background(), "", "hi")
+	if err == nil {
+		t.Fatal("expected an error for a rejected API key")
+	}
+}
+
+func TestOpenAIEmbeddings(t *testing.T) {
+	server := newStubServer(t, "", nil)
+	useStubProvider(t, server)
+
+	embeddings, err := llm.GenerateEmbeddingsWithModel(context.Background(), "nomic-embed-text", []string{"first", "second"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(embeddings) != 2 || embeddings[0][0] != 1 || embeddings[1][1] != 1 {
+		t.Errorf("unexpected embeddings: %v", embeddings)
+	}
+}
+
+func TestOpenAIStream(t *testing.T) {
+	var got stubChatRequest
+	server := newStubServer(t, "streamed word by word", func(req stubChatRequest) {
+		got = req
+	})
+	useStubProvider(t, server)
+
+	chunks := []string{}
+	response, err := llm.GenerateChatCompletionStream(context.Background(), "qwen2.5-coder", []llm.Message{{Role: "user", Content: "hi"}}, func(chunk string) {
+		chunks = append(chunks, chunk)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got.Stream {
+		t.Error("expected a streamed request")
+	}
+	if response.Answer != "streamed word by word" || len(chunks) != 4 || strings.Join(chunks, "") != response.Answer {
+		t.Errorf("unexpected response %q from chunks %q", response, chunks)
+	}
+}
@@ -0,0 +1,87 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+// Provider is a backend that serves LLM completions (e.g. a local ollama server).
+//
+// All of the package level functions (GenerateCompletionJson, GenerateSimpleCompletion, etc) go through the current provider,
+// so swapping it out with SetProvider changes where every prompt is sent.
+//
+// Calls that take a context should give up (and return the context's error) as soon as it's cancelled.
+type Provider interface {
+	// Name is a short identifier for the backend, e.g. "ollama"
+	Name() string
+	// Complete generates a plain text completion.
+	Complete(ctx context.Context, req CompletionRequest) (string, error)
+	// CompleteJson generates a completion that conforms to the given JSON schema.
+	CompleteJson(ctx context.Context, req CompletionRequest, schema json.RawMessage) (string, error)
+	// Chat generates the next message of a conversation.
+	Chat(ctx context.Context, req ChatRequest) (string, error)
+	// Embed generates an embedding vector for each of the inputs, using an embedding model.
+	Embed(ctx context.Context, model string, inputs []string) ([][]float32, error)
+	// ListModels lists the names of all models that are available locally.
+	ListModels() ([]string, error)
+	// PullModel downloads a model so that it's available for use.
+	PullModel(ctx context.Context, model string, progress func(PullProgress)) error
+	// Health returns an error if the backend can't be reached.
+	Health() error
+}
+
+// Lifecycle is implemented by providers that run a local server, which needs to be started before use
+// (and shut down again when caius is done with it).
+type Lifecycle interface {
+	Start() error
+	Stop() error
+}
+
+type CompletionRequest struct {
+	Model        string
+	SystemPrompt string
+	Prompt       string
+	Temperature  float64
+}
+
+// Message is a single message of a chat conversation.
+type Message struct {
+	Role    string `json:"role"` // "system", "user" or "assistant"
+	Content string `json:"content"`
+}
+
+type ChatRequest struct {
+	Model       string
+	Messages    []Message
+	Temperature float64
+}
+
+type PullProgress struct {
+	Status    string
+	Total     int64
+	Completed int64
+}
+
+// ProviderOptions are the settings of the providers that need them
+type ProviderOptions struct {
+	OpenAIBaseURL string // base URL of the OpenAI compatible API, e.g. http://localhost:8080/v1
+	OpenAIAPIKey  string
+}
+
+// ProviderByName resolves a provider from its name. An empty name gives the default (ollama).
+func ProviderByName(name string, op ProviderOptions) (Provider, error) {
+	switch name {
+	case "", "ollama":
+		return &OllamaProvider{}, nil
+	case "openai":
+		return &OpenAIProvider{
+			BaseURL: op.OpenAIBaseURL,
+			APIKey:  op.OpenAIAPIKey,
+		}, nil
+	case "fake":
+		return &FakeProvider{}, nil
+	default:
+		return nil, fmt.Errorf("unknown LLM provider %q", name)
+	}
+}
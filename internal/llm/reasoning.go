@@ -0,0 +1,139 @@
+package llm
+
+import (
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/webbben/caius/internal/metrics"
+)
+
+// Response is a response from a model, with the reasoning of reasoning models (e.g. deepseek-r1) separated from the answer.
+type Response struct {
+	Answer string
+	// Reasoning is what the model "thought" before answering (deepseek-r1's <think> section).
+	// It's empty for models that don't reason.
+	Reasoning string
+}
+
+// SplitReasoning separates the reasoning at the start of a response (between <think> and </think>) from the answer after it.
+func SplitReasoning(text string) Response {
+	var reasoning, answer strings.Builder
+	f := ThinkFilter{
+		OnThink:  func(chunk string) { reasoning.WriteString(chunk) },
+		OnAnswer: func(chunk string) { answer.WriteString(chunk) },
+	}
+	f.Write(text)
+	f.Flush()
+	return Response{
+		Answer:    strings.TrimSpace(answer.String()),
+		Reasoning: strings.TrimSpace(reasoning.String()),
+	}
+}
+
+// recordResponse records the usage of a model, including how many (estimated) tokens it spent reasoning and answering
+func recordResponse(model string, startTime time.Time, response Response) {
+	recordModelUsage(model, startTime)
+	metrics.RecordModelTokens(model, EstimateTokens(response.Reasoning), EstimateTokens(response.Answer))
+}
+
+const thinkStartTag = "<think>"
+const thinkEndTag = "</think>"
+
+// ThinkFilter separates the reasoning of a reasoning model (e.g. deepseek-r1), which comes between <think> and </think>
+// at the start of its response, from the actual answer, while the response is being streamed.
+//
+// Feed it each piece of the response with Write (it can be used as a StreamFunc), and call Flush once the response is done.
+// Tags that are split across pieces are handled. Whitespace between the reasoning and the answer is dropped.
+type ThinkFilter struct {
+	OnThinkStart func()             // called when the reasoning starts
+	OnThink      func(chunk string) // called with each piece of the reasoning
+	OnThinkEnd   func()             // called when the reasoning is done
+	OnAnswer     func(chunk string) // called with each piece of the answer
+
+	thinking bool
+	pending  string // the end of the last piece, which may be the start of a tag
+	answered bool   // if any of the answer has been passed on yet
+}
+
+// Write takes the next piece of the response.
+func (t *ThinkFilter) Write(chunk string) {
+	text := t.pending + chunk
+	t.pending = ""
+	for text != "" {
+		if !t.thinking && t.answered {
+			// reasoning only comes before the answer
+			t.emit(text)
+			return
+		}
+		tag := thinkStartTag
+		if t.thinking {
+			tag = thinkEndTag
+		}
+		i := strings.Index(text, tag)
+		if i == -1 {
+			// hold on to anything at the end that could be the start of the tag
+			keep := partialSuffix(text, tag)
+			t.emit(text[:len(text)-keep])
+			t.pending = text[len(text)-keep:]
+			return
+		}
+		if !t.thinking && strings.TrimSpace(text[:i]) != "" {
+			// reasoning only comes before the answer
+			t.emit(text)
+			return
+		}
+		t.emit(text[:i])
+		text = text[i+len(tag):]
+		t.thinking = !t.thinking
+		if t.thinking && t.OnThinkStart != nil {
+			t.OnThinkStart()
+		}
+		if !t.thinking && t.OnThinkEnd != nil {
+			t.OnThinkEnd()
+		}
+	}
+}
+
+// Flush passes on anything that was held back, once the response is done.
+func (t *ThinkFilter) Flush() {
+	text := t.pending
+	t.pending = ""
+	t.emit(text)
+	if t.thinking {
+		// the reasoning was never closed (e.g. the response was cut off)
+		t.thinking = false
+		if t.OnThinkEnd != nil {
+			t.OnThinkEnd()
+		}
+	}
+}
+
+func (t *ThinkFilter) emit(text string) {
+	if t.thinking {
+		if text != "" && t.OnThink != nil {
+			t.OnThink(text)
+		}
+		return
+	}
+	if !t.answered {
+		text = strings.TrimLeftFunc(text, unicode.IsSpace)
+	}
+	if text == "" {
+		return
+	}
+	t.answered = true
+	if t.OnAnswer != nil {
+		t.OnAnswer(text)
+	}
+}
+
+// partialSuffix gives the length of the longest end of s that is the start of tag
+func partialSuffix(s string, tag string) int {
+	for n := min(len(s), len(tag)-1); n > 0; n-- {
+		if strings.HasSuffix(s, tag[:n]) {
+			return n
+		}
+	}
+	return 0
+}
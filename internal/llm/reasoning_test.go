@@ -0,0 +1,130 @@
+package llm_test
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/webbben/caius/internal/llm"
+	"github.com/webbben/caius/internal/metrics"
+)
+
+func TestThinkFilter(t *testing.T) {
+	tests := []struct {
+		name     string
+		chunks   []string
+		thinking string
+		answer   string
+	}{
+		{"no reasoning", []string{"just ", "an answer"}, "", "just an answer"},
+		{"whole tags", []string{"<think>", "hmm, ", "let me see", "</think>", "\n\n", "the answer"}, "hmm, let me see", "the answer"},
+		{"split tags", []string{"<thi", "nk>hmm</th", "ink>\n\nthe ", "answer"}, "hmm", "the answer"},
+		{"one piece", []string{"<think>\nhmm\n</think>\n\nthe answer"}, "\nhmm\n", "the answer"},
+		{"tag in the answer", []string{"use a <think> ", "tag"}, "", "use a <think> tag"},
+		{"almost a tag", []string{"a <thin", "g>"}, "", "a <thing>"},
+		{"cut off", []string{"<think>never ", "finished"}, "never finished", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var thinking, answer strings.Builder
+			starts, ends := 0, 0
+			f := llm.ThinkFilter{
+				OnThinkStart: func() { starts++ },
+				OnThink:      func(chunk string) { thinking.WriteString(chunk) },
+				OnThinkEnd:   func() { ends++ },
+				OnAnswer:     func(chunk string) { answer.WriteString(chunk) },
+			}
+			for _, chunk := range tt.chunks {
+				f.Write(chunk)
+			}
+			f.Flush()
+
+			if thinking.String() != tt.thinking {
+				t.Errorf("expected reasoning %q, got %q", tt.thinking, thinking.String())
+			}
+			if answer.String() != tt.answer {
+				t.Errorf("expected answer %q, got %q", tt.answer, answer.String())
+			}
+			if starts != ends || (tt.thinking != "") != (starts == 1) {
+				t.Errorf("unexpected reasoning start/end calls: %v/%v", starts, ends)
+			}
+		})
+	}
+}
+
+func TestSplitReasoning(t *testing.T) {
+	response := llm.SplitReasoning("<think>\nThe user wants a greeting.\n</think>\n\nHello!\n")
+	if response.Reasoning != "The user wants a greeting." || response.Answer != "Hello!" {
+		t.Errorf("unexpected split: %+v", response)
+	}
+	response = llm.SplitReasoning("  just an answer ")
+	if response.Reasoning != "" || response.Answer != "just an answer" {
+		t.Errorf("unexpected split: %+v", response)
+	}
+}
+
+func TestReasoningIsStripped(t *testing.T) {
+	const model = "reasoning-model"
+	useRetryProvider(t, &llm.FakeProvider{
+		Respond: func(req llm.CompletionRequest, schema json.RawMessage) (string, error) {
+			if schema != nil {
+				return "<think>they want JSON</think>\n{\"name\": \"caius\"}", nil
+			}
+			return "<think>let me think about this for a while</think>\n\nthe answer", nil
+		},
+	}, fastRetryPolicy)
+
+	answer, err := llm.GenerateSimpleCompletionWithModel(context.Background(), model, "", "hi")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if answer != "the answer" {
+		t.Errorf("expected only the answer, got %q", answer)
+	}
+
+	response, err := llm.GenerateSimpleCompletionStream(context.Background(), model, "", "hi", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.Reasoning != "let me think about this for a while" || response.Answer != "the answer" {
+		t.Errorf("unexpected response: %+v", response)
+	}
+
+	var v struct{ Name string }
+	if err := llm.GenerateCompletionJsonWithModel(context.Background(), model, "", "hi", retryTestSchema, &v); err != nil {
+		t.Fatal(err)
+	}
+	if v.Name != "caius" {
+		t.Errorf("expected the JSON after the reasoning to be decoded, got %+v", v)
+	}
+
+	reasoning, answerTokens := metrics.ModelTokenCounts(model)
+	if reasoning != llm.EstimateTokens("let me think about this for a while")*2+llm.EstimateTokens("they want JSON") {
+		t.Errorf("unexpected reasoning token count %v", reasoning)
+	}
+	if answerTokens == 0 {
+		t.Error("expected answer tokens to be recorded")
+	}
+}
+
+func TestOnlyReasoningIsEmpty(t *testing.T) {
+	calls := 0
+	useRetryProvider(t, &llm.FakeProvider{
+		Respond: func(req llm.CompletionRequest, schema json.RawMessage) (string, error) {
+			calls++
+			if calls == 1 {
+				return "<think>this goes on and on", nil
+			}
+			return "<think>short</think>done", nil
+		},
+	}, fastRetryPolicy)
+
+	answer, err := llm.GenerateSimpleCompletionWithModel(context.Background(), "reasoning-cut-off", "", "hi")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if calls != 2 || answer != "done" {
+		t.Errorf("expected a response without an answer to be retried, got %v calls and %q", calls, answer)
+	}
+}
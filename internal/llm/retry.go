@@ -0,0 +1,143 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/ollama/ollama/api"
+	"github.com/webbben/caius/internal/metrics"
+)
+
+// RetryPolicy decides how LLM calls deal with failures.
+type RetryPolicy struct {
+	MaxAttempts    int           // attempts per call, including the first one (1 means calls aren't retried)
+	InitialBackoff time.Duration // wait before the first retry; doubled for each retry after that
+	MaxBackoff     time.Duration // the longest wait between retries
+	Timeout        time.Duration // max time a single attempt can take (0 = no limit)
+	// RepairAttempts is the number of times a JSON response that doesn't unmarshal (or doesn't match its schema)
+	// is sent back to the model, along with what's wrong with it, to be fixed.
+	RepairAttempts int
+}
+
+var DefaultRetryPolicy RetryPolicy = RetryPolicy{
+	MaxAttempts:    3,
+	InitialBackoff: time.Second,
+	MaxBackoff:     30 * time.Second,
+	Timeout:        5 * time.Minute,
+	RepairAttempts: 1,
+}
+
+var retryPolicy RetryPolicy = DefaultRetryPolicy
+var retryPolicyMutex sync.RWMutex
+
+// SetRetryPolicy changes how all LLM calls are retried.
+func SetRetryPolicy(p RetryPolicy) {
+	retryPolicyMutex.Lock()
+	defer retryPolicyMutex.Unlock()
+	retryPolicy = p
+}
+
+func GetRetryPolicy() RetryPolicy {
+	retryPolicyMutex.RLock()
+	defer retryPolicyMutex.RUnlock()
+	return retryPolicy
+}
+
+// StatusError is an error response from an LLM backend's HTTP API.
+type StatusError struct {
+	Backend    string // e.g. "openai"
+	StatusCode int
+	Status     string
+	Message    string
+}
+
+func (e *StatusError) Error() string {
+	if e.Message != "" {
+		return fmt.Sprintf("%s: %s: %s", e.Backend, e.Status, e.Message)
+	}
+	return fmt.Sprintf("%s: %s", e.Backend, e.Status)
+}
+
+// backoff gives how long to wait before the given retry (1 = the first retry)
+func (p RetryPolicy) backoff(retry int) time.Duration {
+	d := p.InitialBackoff
+	for i := 1; i < retry && d < p.MaxBackoff; i++ {
+		d *= 2
+	}
+	if p.MaxBackoff > 0 {
+		d = min(d, p.MaxBackoff)
+	}
+	return d
+}
+
+// isRetryable reports if an error might go away by trying again (e.g. a timeout, an overloaded server, or an empty response),
+// as opposed to errors that will happen every time (e.g. a model that doesn't exist, or a bad request).
+func isRetryable(err error) bool {
+	var streamErr *streamError
+	if errors.Is(err, context.Canceled) || errors.As(err, &streamErr) {
+		return false
+	}
+	statusCode := 0
+	var statusErr *StatusError
+	var ollamaErr api.StatusError
+	if errors.As(err, &statusErr) {
+		statusCode = statusErr.StatusCode
+	} else if errors.As(err, &ollamaErr) {
+		statusCode = ollamaErr.StatusCode
+	}
+	switch {
+	case statusCode == 0:
+		// connection errors, timeouts, empty responses, etc
+		return true
+	case statusCode == http.StatusRequestTimeout || statusCode == http.StatusTooManyRequests:
+		return true
+	case statusCode >= 400 && statusCode < 500:
+		return false
+	}
+	return true
+}
+
+// withRetry runs an LLM call according to the retry policy: each attempt gets its own timeout, and attempts that fail with a
+// retryable error are tried again after a backoff. Retries are recorded in the model's usage metrics.
+// It gives up right away if ctx is cancelled.
+func withRetry[T any](ctx context.Context, model string, call func(ctx context.Context) (T, error)) (T, error) {
+	policy := GetRetryPolicy()
+	attempts := max(policy.MaxAttempts, 1)
+
+	var result T
+	var err error
+	for attempt := 1; attempt <= attempts; attempt++ {
+		if attempt > 1 {
+			metrics.RecordModelRetry(model)
+			select {
+			case <-time.After(policy.backoff(attempt - 1)):
+			case <-ctx.Done():
+				return result, ctx.Err()
+			}
+		}
+
+		attemptCtx, cancel := ctx, context.CancelFunc(func() {})
+		if policy.Timeout > 0 {
+			attemptCtx, cancel = context.WithTimeout(ctx, policy.Timeout)
+		}
+		result, err = call(attemptCtx)
+		cancel()
+		if err == nil {
+			return result, nil
+		}
+		if ctx.Err() != nil {
+			return result, ctx.Err()
+		}
+		if !isRetryable(err) {
+			return result, err
+		}
+	}
+	if attempts > 1 {
+		err = errors.Join(fmt.Errorf("failed after %v attempts;", attempts), err)
+	}
+	return result, err
+}
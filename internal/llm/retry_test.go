@@ -0,0 +1,200 @@
+package llm_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/webbben/caius/internal/llm"
+	"github.com/webbben/caius/internal/metrics"
+)
+
+var retryTestSchema = json.RawMessage(`{
+	"type": "object",
+	"properties": {"name": {"type": "string"}},
+	"required": ["name"]
+}`)
+
+// useRetryProvider sets a fake provider and a fast retry policy for the duration of a test
+func useRetryProvider(t *testing.T, provider llm.Provider, policy llm.RetryPolicy) {
+	t.Helper()
+	prevProvider := llm.GetProvider()
+	prevPolicy := llm.GetRetryPolicy()
+	llm.SetProvider(provider)
+	llm.SetRetryPolicy(policy)
+	t.Cleanup(func() {
+		llm.SetProvider(prevProvider)
+		llm.SetRetryPolicy(prevPolicy)
+	})
+}
+
+var fastRetryPolicy = llm.RetryPolicy{
+	MaxAttempts:    3,
+	InitialBackoff: time.Millisecond,
+	MaxBackoff:     2 * time.Millisecond,
+	RepairAttempts: 1,
+}
+
+func TestRetryTransientErrors(t *testing.T) {
+	const model = "retry-transient"
+	calls := 0
+	useRetryProvider(t, &llm.FakeProvider{
+		Respond: func(req llm.CompletionRequest, schema json.RawMessage) (string, error) {
+			calls++
+			if calls < 3 {
+				return "", &llm.StatusError{Backend: "fake", StatusCode: 503, Status: "503 Service Unavailable"}
+			}
+			return `{"name": "ok"}`, nil
+		},
+	}, fastRetryPolicy)
+
+	var v struct{ Name string }
+	err := llm.GenerateCompletionJsonWithModel(context.Background(), model, "", "hi", retryTestSchema, &v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if calls != 3 || v.Name != "ok" {
+		t.Errorf("expected success on the third call, got %v calls and %+v", calls, v)
+	}
+	if retries, _ := metrics.ModelRetryCounts(model); retries != 2 {
+		t.Errorf("expected 2 retries to be recorded, got %v", retries)
+	}
+}
+
+func TestRetryGivesUp(t *testing.T) {
+	tests := []struct {
+		name          string
+		err           error
+		expectedCalls int
+	}{
+		{"client error", &llm.StatusError{Backend: "fake", StatusCode: 404, Status: "404 Not Found"}, 1},
+		{"rate limited", &llm.StatusError{Backend: "fake", StatusCode: 429, Status: "429 Too Many Requests"}, 3},
+		{"connection error", errors.New("connection refused"), 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			useRetryProvider(t, &llm.FakeProvider{
+				Respond: func(req llm.CompletionRequest, schema json.RawMessage) (string, error) {
+					calls++
+					return "", tt.err
+				},
+			}, fastRetryPolicy)
+
+			_, err := llm.GenerateSimpleCompletionWithModel(context.Background(), "retry-gives-up", "", "hi")
+			if !errors.Is(err, tt.err) {
+				t.Errorf("expected the last error to be returned, got %v", err)
+			}
+			if calls != tt.expectedCalls {
+				t.Errorf("expected %v calls, got %v", tt.expectedCalls, calls)
+			}
+		})
+	}
+}
+
+// slowProvider hangs on its first completion until the call times out
+type slowProvider struct {
+	*llm.FakeProvider
+	calls int
+}
+
+func (s *slowProvider) Complete(ctx context.Context, req llm.CompletionRequest) (string, error) {
+	s.calls++
+	if s.calls == 1 {
+		<-ctx.Done()
+		return "", ctx.Err()
+	}
+	return s.FakeProvider.Complete(ctx, req)
+}
+
+func TestRetryTimeout(t *testing.T) {
+	provider := &slowProvider{FakeProvider: &llm.FakeProvider{}}
+	policy := fastRetryPolicy
+	policy.Timeout = 10 * time.Millisecond
+	useRetryProvider(t, provider, policy)
+
+	response, err := llm.GenerateSimpleCompletionWithModel(context.Background(), "retry-timeout", "", "hi")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if provider.calls != 2 || response == "" {
+		t.Errorf("expected the timed out call to be retried once, got %v calls", provider.calls)
+	}
+}
+
+func TestRetryCancelled(t *testing.T) {
+	calls := 0
+	useRetryProvider(t, &llm.FakeProvider{
+		Respond: func(req llm.CompletionRequest, schema json.RawMessage) (string, error) {
+			calls++
+			return "", errors.New("connection refused")
+		},
+	}, llm.RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Hour})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(10*time.Millisecond, cancel)
+	_, err := llm.GenerateSimpleCompletionWithModel(ctx, "retry-cancelled", "", "hi")
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("expected the call to be cancelled during the backoff, got %v", err)
+	}
+	if calls != 1 {
+		t.Errorf("expected 1 call, got %v", calls)
+	}
+}
+
+func TestRepairInvalidJson(t *testing.T) {
+	const model = "retry-repair"
+	responses := []string{
+		`{"name": "unterminated`,
+		`{"other": "missing name"}`,
+		`{"name": "fixed"}`,
+	}
+	provider := &llm.FakeProvider{
+		Respond: func(req llm.CompletionRequest, schema json.RawMessage) (string, error) {
+			response := responses[0]
+			responses = responses[1:]
+			return response, nil
+		},
+	}
+	policy := fastRetryPolicy
+	policy.RepairAttempts = 2
+	useRetryProvider(t, provider, policy)
+
+	var v struct{ Name string }
+	err := llm.GenerateCompletionJsonWithModel(context.Background(), model, "", "describe it", retryTestSchema, &v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v.Name != "fixed" {
+		t.Errorf("expected the repaired response, got %+v", v)
+	}
+	if _, repairs := metrics.ModelRetryCounts(model); repairs != 2 {
+		t.Errorf("expected 2 repairs to be recorded, got %v", repairs)
+	}
+
+	calls := provider.Calls()
+	if len(calls) != 3 {
+		t.Fatalf("expected 3 calls, got %v", len(calls))
+	}
+	last := calls[2].Prompt
+	if !strings.HasPrefix(last, "describe it") || !strings.Contains(last, `"missing name"`) || !strings.Contains(last, "name: missing required field") {
+		t.Errorf("expected the repair prompt to include the previous response and what's wrong with it, got:\n%s", last)
+	}
+}
+
+func TestRepairGivesUp(t *testing.T) {
+	useRetryProvider(t, &llm.FakeProvider{
+		Respond: func(req llm.CompletionRequest, schema json.RawMessage) (string, error) {
+			return "not json", nil
+		},
+	}, fastRetryPolicy)
+
+	var v struct{ Name string }
+	err := llm.GenerateCompletionJsonWithModel(context.Background(), "retry-repair-fails", "", "hi", retryTestSchema, &v)
+	if err == nil {
+		t.Fatal("expected an error when the response can't be repaired")
+	}
+}
@@ -0,0 +1,397 @@
+package llm
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Schema is the subset of JSON schema that's used to describe (and validate) structured LLM responses.
+type Schema struct {
+	Type       SchemaType         `json:"type,omitempty"`
+	Properties map[string]*Schema `json:"properties,omitempty"`
+	Items      *Schema            `json:"items,omitempty"`
+	Required   []string           `json:"required,omitempty"`
+	Enum       []any              `json:"enum,omitempty"`
+	MinLength  *int               `json:"minLength,omitempty"`
+}
+
+// SchemaType is the "type" of a schema. JSON schema allows either a single type or a list of types (e.g. ["string", "null"]).
+type SchemaType []string
+
+func (t SchemaType) MarshalJSON() ([]byte, error) {
+	if len(t) == 1 {
+		return json.Marshal(t[0])
+	}
+	return json.Marshal([]string(t))
+}
+
+func (t *SchemaType) UnmarshalJSON(b []byte) error {
+	var single string
+	if json.Unmarshal(b, &single) == nil {
+		*t = SchemaType{single}
+		return nil
+	}
+	var list []string
+	if err := json.Unmarshal(b, &list); err != nil {
+		return errors.New("schema type must be a string or a list of strings")
+	}
+	*t = list
+	return nil
+}
+
+// ParseSchema parses a JSON schema
+func ParseSchema(schema json.RawMessage) (*Schema, error) {
+	var s Schema
+	if err := json.Unmarshal(schema, &s); err != nil {
+		return nil, errors.Join(errors.New("ParseSchema: invalid schema;"), err)
+	}
+	return &s, nil
+}
+
+// ValidationErrorKind is the reason a value doesn't match its schema
+type ValidationErrorKind string
+
+const (
+	MissingField ValidationErrorKind = "missing_field" // a required property isn't there
+	WrongType    ValidationErrorKind = "wrong_type"    // the value has a different type than the schema says
+	NotInEnum    ValidationErrorKind = "not_in_enum"   // the value isn't one of the schema's allowed values
+	TooShort     ValidationErrorKind = "too_short"     // a string is shorter than the schema's minLength (e.g. empty)
+)
+
+// ValidationError is a single place where a JSON value doesn't match its schema.
+type ValidationError struct {
+	Kind ValidationErrorKind
+	// Path of the invalid value, e.g. "findings[2].severity". It's empty if the problem is with the whole value.
+	Path    string
+	Message string
+}
+
+func (e *ValidationError) Error() string {
+	if e.Path == "" {
+		return e.Message
+	}
+	return e.Path + ": " + e.Message
+}
+
+// ValidationErrors are all of the problems found when validating a JSON value against a schema.
+type ValidationErrors []*ValidationError
+
+func (errs ValidationErrors) Error() string {
+	messages := make([]string, len(errs))
+	for i, e := range errs {
+		messages[i] = e.Error()
+	}
+	return strings.Join(messages, "; ")
+}
+
+// ValidateJson checks that data is valid JSON that matches the schema.
+// If it doesn't match, the error is a ValidationErrors listing every problem found.
+func ValidateJson(data []byte, schema json.RawMessage) error {
+	s, err := ParseSchema(schema)
+	if err != nil {
+		return err
+	}
+	return s.Validate(data)
+}
+
+// Validate checks that data is valid JSON that matches the schema.
+// If it doesn't match, the error is a ValidationErrors listing every problem found.
+func (s *Schema) Validate(data []byte) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var value any
+	if err := decoder.Decode(&value); err != nil {
+		return err
+	}
+	if decoder.More() {
+		return errors.New("unexpected data after the JSON value")
+	}
+
+	var errs ValidationErrors
+	s.validate(value, "", &errs)
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+func (s *Schema) validate(value any, path string, errs *ValidationErrors) {
+	fail := func(kind ValidationErrorKind, format string, a ...any) {
+		*errs = append(*errs, &ValidationError{Kind: kind, Path: path, Message: fmt.Sprintf(format, a...)})
+	}
+
+	if len(s.Type) > 0 && !slices.ContainsFunc(s.Type, func(t string) bool { return matchesType(value, t) }) {
+		fail(WrongType, "expected %s, got %s", strings.Join(s.Type, " or "), jsonTypeName(value))
+		return
+	}
+	if len(s.Enum) > 0 && !slices.ContainsFunc(s.Enum, func(allowed any) bool { return jsonEqual(value, allowed) }) {
+		allowed := make([]string, len(s.Enum))
+		for i, v := range s.Enum {
+			b, _ := json.Marshal(v)
+			allowed[i] = string(b)
+		}
+		got, _ := json.Marshal(value)
+		fail(NotInEnum, "%s is not one of: %s", got, strings.Join(allowed, ", "))
+	}
+
+	switch v := value.(type) {
+	case string:
+		if s.MinLength != nil && utf8.RuneCountInString(v) < *s.MinLength {
+			if v == "" {
+				fail(TooShort, "must not be empty")
+			} else {
+				fail(TooShort, "must be at least %v characters long", *s.MinLength)
+			}
+		}
+	case map[string]any:
+		for _, name := range s.Required {
+			if _, ok := v[name]; !ok {
+				*errs = append(*errs, &ValidationError{Kind: MissingField, Path: joinPath(path, name), Message: "missing required field"})
+			}
+		}
+		names := make([]string, 0, len(s.Properties))
+		for name := range s.Properties {
+			names = append(names, name)
+		}
+		slices.Sort(names)
+		for _, name := range names {
+			if fieldValue, ok := v[name]; ok {
+				s.Properties[name].validate(fieldValue, joinPath(path, name), errs)
+			}
+		}
+	case []any:
+		if s.Items != nil {
+			for i, item := range v {
+				s.Items.validate(item, fmt.Sprintf("%s[%v]", path, i), errs)
+			}
+		}
+	}
+}
+
+func joinPath(path string, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+// matchesType reports if a decoded JSON value (decoded with UseNumber) is of the given JSON schema type
+func matchesType(value any, t string) bool {
+	switch v := value.(type) {
+	case nil:
+		return t == "null"
+	case bool:
+		return t == "boolean"
+	case string:
+		return t == "string"
+	case json.Number:
+		if t == "number" {
+			return true
+		}
+		if t != "integer" {
+			return false
+		}
+		// 1.0 is an integer too, as far as JSON schema is concerned
+		f, err := strconv.ParseFloat(v.String(), 64)
+		return err == nil && f == math.Trunc(f)
+	case map[string]any:
+		return t == "object"
+	case []any:
+		return t == "array"
+	}
+	return false
+}
+
+func jsonTypeName(value any) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case json.Number:
+		return "number"
+	case map[string]any:
+		return "object"
+	case []any:
+		return "array"
+	}
+	return fmt.Sprintf("%T", value)
+}
+
+// jsonEqual compares a decoded JSON value with an enum value from a schema
+func jsonEqual(value any, allowed any) bool {
+	if n, ok := value.(json.Number); ok {
+		f, err := n.Float64()
+		if err != nil {
+			return false
+		}
+		switch a := allowed.(type) {
+		case float64:
+			return f == a
+		case int:
+			return f == float64(a)
+		}
+		return false
+	}
+	return reflect.DeepEqual(value, allowed)
+}
+
+// SchemaOf generates the JSON schema of v's type, so that the schema of a structured response can't drift from the struct
+// it's unmarshalled into.
+//
+// Properties are named after their json tags, and are required unless their json tag has omitempty.
+// Fields with a json tag of "-" are skipped. More constraints can be added with a jsonschema tag:
+//
+//	jsonschema:"-"              leave the field out of the schema (e.g. fields that aren't filled in by the LLM)
+//	jsonschema:"optional"       don't require the field
+//	jsonschema:"minLength=1"    require a string to be at least this long
+//	jsonschema:"enum=a|b|c"     only allow these values
+//
+// Options are separated by commas, e.g. jsonschema:"optional,enum=a|b".
+func SchemaOf(v any) (json.RawMessage, error) {
+	s, err := schemaOfType(reflect.TypeOf(v))
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(s)
+}
+
+// MustSchemaOf is the same as SchemaOf, but panics if the schema can't be generated. It's meant for package level schema variables.
+func MustSchemaOf(v any) json.RawMessage {
+	schema, err := SchemaOf(v)
+	if err != nil {
+		panic(err)
+	}
+	return schema
+}
+
+func schemaOfType(t reflect.Type) (*Schema, error) {
+	if t == nil {
+		return nil, errors.New("SchemaOf: can't generate a schema for nil")
+	}
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return &Schema{Type: SchemaType{"string"}}, nil
+	case reflect.Bool:
+		return &Schema{Type: SchemaType{"boolean"}}, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &Schema{Type: SchemaType{"integer"}}, nil
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: SchemaType{"number"}}, nil
+	case reflect.Interface:
+		return &Schema{}, nil
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			// []byte is marshalled as a base64 string
+			return &Schema{Type: SchemaType{"string"}}, nil
+		}
+		items, err := schemaOfType(t.Elem())
+		if err != nil {
+			return nil, err
+		}
+		return &Schema{Type: SchemaType{"array"}, Items: items}, nil
+	case reflect.Map:
+		return &Schema{Type: SchemaType{"object"}}, nil
+	case reflect.Struct:
+		s := &Schema{Type: SchemaType{"object"}, Properties: map[string]*Schema{}}
+		if err := addStructFields(s, t); err != nil {
+			return nil, err
+		}
+		return s, nil
+	}
+	return nil, fmt.Errorf("SchemaOf: unsupported type %s", t)
+}
+
+// addStructFields adds the fields of a struct to an object schema (including the fields of embedded structs, like encoding/json does)
+func addStructFields(s *Schema, t reflect.Type) error {
+	for i := range t.NumField() {
+		field := t.Field(i)
+		jsonTag := field.Tag.Get("json")
+		name, jsonOptions, _ := strings.Cut(jsonTag, ",")
+		if name == "-" && jsonOptions == "" {
+			continue
+		}
+		options := strings.Split(field.Tag.Get("jsonschema"), ",")
+		if slices.Contains(options, "-") {
+			continue
+		}
+
+		fieldType := field.Type
+		if fieldType.Kind() == reflect.Pointer {
+			fieldType = fieldType.Elem()
+		}
+		if field.Anonymous && name == "" && fieldType.Kind() == reflect.Struct {
+			if err := addStructFields(s, fieldType); err != nil {
+				return err
+			}
+			continue
+		}
+		if !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		fieldSchema, err := schemaOfType(field.Type)
+		if err != nil {
+			return fmt.Errorf("%w (field %s)", err, field.Name)
+		}
+		required := !slices.Contains(strings.Split(jsonOptions, ","), "omitempty")
+		for _, option := range options {
+			key, value, _ := strings.Cut(option, "=")
+			switch key {
+			case "":
+			case "optional":
+				required = false
+			case "minLength":
+				n, err := strconv.Atoi(value)
+				if err != nil {
+					return fmt.Errorf("SchemaOf: invalid minLength %q (field %s)", value, field.Name)
+				}
+				fieldSchema.MinLength = &n
+			case "enum":
+				for _, e := range strings.Split(value, "|") {
+					enumValue, err := enumValueOf(fieldSchema, e)
+					if err != nil {
+						return fmt.Errorf("SchemaOf: invalid enum value %q (field %s)", e, field.Name)
+					}
+					fieldSchema.Enum = append(fieldSchema.Enum, enumValue)
+				}
+			default:
+				return fmt.Errorf("SchemaOf: unknown jsonschema option %q (field %s)", option, field.Name)
+			}
+		}
+
+		s.Properties[name] = fieldSchema
+		if required {
+			s.Required = append(s.Required, name)
+		}
+	}
+	return nil
+}
+
+// enumValueOf converts an enum value from a struct tag to the type of its field
+func enumValueOf(s *Schema, value string) (any, error) {
+	if slices.Contains(s.Type, "string") {
+		return value, nil
+	}
+	var v any
+	err := json.Unmarshal([]byte(value), &v)
+	return v, err
+}
@@ -0,0 +1,170 @@
+package llm_test
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/webbben/caius/internal/llm"
+	"github.com/webbben/caius/internal/project"
+)
+
+var validateTestSchema = json.RawMessage(`{
+	"type": "object",
+	"properties": {
+		"name": {"type": "string", "minLength": 1},
+		"count": {"type": "integer"},
+		"ratio": {"type": ["number", "null"]},
+		"level": {"type": "string", "enum": ["low", "high"]},
+		"tags": {"type": "array", "items": {"type": "string"}},
+		"items": {
+			"type": "array",
+			"items": {
+				"type": "object",
+				"properties": {"line": {"type": "integer"}},
+				"required": ["line"]
+			}
+		}
+	},
+	"required": ["name", "count"]
+}`)
+
+func TestValidateJson(t *testing.T) {
+	type problem struct {
+		kind llm.ValidationErrorKind
+		path string
+	}
+	tests := []struct {
+		name     string
+		data     string
+		problems []problem
+	}{
+		{"valid", `{"name": "x", "count": 2, "ratio": null, "level": "low", "tags": ["a"], "items": [{"line": 1}]}`, nil},
+		{"integer written as a float", `{"name": "x", "count": 2.0}`, nil},
+		{"missing required", `{"name": "x"}`, []problem{{llm.MissingField, "count"}}},
+		{"empty string", `{"name": "", "count": 1}`, []problem{{llm.TooShort, "name"}}},
+		{"wrong types", `{"name": 5, "count": 1.5, "ratio": "high"}`, []problem{
+			{llm.WrongType, "count"}, {llm.WrongType, "name"}, {llm.WrongType, "ratio"},
+		}},
+		{"not in enum", `{"name": "x", "count": 1, "level": "LOW"}`, []problem{{llm.NotInEnum, "level"}}},
+		{"nested", `{"name": "x", "count": 1, "tags": ["a", 2], "items": [{"line": 1}, {}]}`, []problem{
+			{llm.MissingField, "items[1].line"}, {llm.WrongType, "tags[1]"},
+		}},
+		{"not an object", `["name"]`, []problem{{llm.WrongType, ""}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := llm.ValidateJson([]byte(tt.data), validateTestSchema)
+			if tt.problems == nil {
+				if err != nil {
+					t.Errorf("expected no errors, got %v", err)
+				}
+				return
+			}
+			var errs llm.ValidationErrors
+			if !errors.As(err, &errs) {
+				t.Fatalf("expected ValidationErrors, got %v", err)
+			}
+			if len(errs) != len(tt.problems) {
+				t.Fatalf("expected %v problems, got %v", len(tt.problems), errs)
+			}
+			for i, p := range tt.problems {
+				if errs[i].Kind != p.kind || errs[i].Path != p.path {
+					t.Errorf("problem %v: expected %s at %q, got %s at %q (%v)", i, p.kind, p.path, errs[i].Kind, errs[i].Path, errs[i])
+				}
+			}
+		})
+	}
+
+	if err := llm.ValidateJson([]byte(`{"name": "x"`), validateTestSchema); err == nil {
+		t.Error("expected an error for invalid JSON")
+	}
+	if err := llm.ValidateJson([]byte(`{}`), json.RawMessage(`{"type": 5}`)); err == nil {
+		t.Error("expected an error for an invalid schema")
+	}
+}
+
+type schemaTestBase struct {
+	ID int `json:"id"`
+}
+
+type schemaTestResponse struct {
+	schemaTestBase
+	Name     string            `json:"name" jsonschema:"minLength=1"`
+	Level    string            `json:"level" jsonschema:"enum=low|high"`
+	Priority int               `json:"priority" jsonschema:"optional,enum=1|2|3"`
+	Notes    *string           `json:"notes,omitempty"`
+	Tags     []string          `json:"tags"`
+	Extra    map[string]string `json:"extra"`
+	Internal bool              `jsonschema:"-"`
+	Ignored  bool              `json:"-"`
+	private  bool
+}
+
+func TestSchemaOf(t *testing.T) {
+	schema, err := llm.SchemaOf(schemaTestResponse{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got, expected any
+	json.Unmarshal(schema, &got)
+	json.Unmarshal([]byte(`{
+		"type": "object",
+		"properties": {
+			"id": {"type": "integer"},
+			"name": {"type": "string", "minLength": 1},
+			"level": {"type": "string", "enum": ["low", "high"]},
+			"priority": {"type": "integer", "enum": [1, 2, 3]},
+			"notes": {"type": "string"},
+			"tags": {"type": "array", "items": {"type": "string"}},
+			"extra": {"type": "object"}
+		},
+		"required": ["id", "name", "level", "tags", "extra"]
+	}`), &expected)
+	gotJson, _ := json.Marshal(got)
+	expectedJson, _ := json.Marshal(expected)
+	if string(gotJson) != string(expectedJson) {
+		t.Errorf("unexpected schema:\n%s\nexpected:\n%s", gotJson, expectedJson)
+	}
+
+	if err := llm.ValidateJson([]byte(`{"id": 1, "name": "x", "level": "high", "priority": 2, "tags": [], "extra": {}}`), schema); err != nil {
+		t.Errorf("expected a valid response, got %v", err)
+	}
+	if err := llm.ValidateJson([]byte(`{"id": 1, "name": "x", "level": "high", "priority": 4, "tags": [], "extra": {}}`), schema); err == nil {
+		t.Error("expected an error for a priority that isn't in the enum")
+	}
+
+	if _, err := llm.SchemaOf(struct {
+		C chan int `json:"c"`
+	}{}); err == nil {
+		t.Error("expected an error for an unsupported type")
+	}
+	if _, err := llm.SchemaOf(struct {
+		S string `json:"s" jsonschema:"bogus"`
+	}{}); err == nil {
+		t.Error("expected an error for an unknown option")
+	}
+}
+
+func TestBasicFileAnalysisSchema(t *testing.T) {
+	// a response the LLM would give validates, and a response that leaves out the description doesn't
+	response, _ := json.Marshal(struct {
+		Type        string `json:"file_type"`
+		Description string `json:"description"`
+	}{"go", "a go file"})
+	if err := llm.ValidateJson(response, project.BasicFileAnalysisSchema); err != nil {
+		t.Error(err)
+	}
+	if err := llm.ValidateJson([]byte(`{"file_type": "go", "description": ""}`), project.BasicFileAnalysisSchema); err == nil {
+		t.Error("expected an error for an empty description")
+	}
+
+	// fields that aren't filled in by the LLM aren't part of the schema
+	schema, err := llm.ParseSchema(project.BasicFileAnalysisSchema)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(schema.Properties) != 2 || schema.Properties["file_type"] == nil || schema.Properties["description"] == nil {
+		t.Errorf("unexpected properties: %v", schema.Properties)
+	}
+}
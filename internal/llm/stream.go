@@ -0,0 +1,151 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// StreamFunc receives a response piece by piece, as it's generated.
+type StreamFunc func(chunk string)
+
+// Streamer is implemented by providers that can stream responses as they're generated.
+//
+// Providers that don't implement it still work with the streaming functions (e.g. GenerateSimpleCompletionStream);
+// the whole response is just delivered in one piece once it's done.
+type Streamer interface {
+	// CompleteStream generates a plain text completion, calling fn with each piece of it. It returns the whole response.
+	CompleteStream(ctx context.Context, req CompletionRequest, fn StreamFunc) (string, error)
+	// ChatStream generates the next message of a conversation, calling fn with each piece of it. It returns the whole message.
+	ChatStream(ctx context.Context, req ChatRequest, fn StreamFunc) (string, error)
+}
+
+// streamError is an error that happened after part of the response was already streamed.
+// These aren't retried, since the part that was streamed can't be taken back.
+type streamError struct {
+	err error
+}
+
+func (e *streamError) Error() string {
+	return e.err.Error()
+}
+
+func (e *streamError) Unwrap() error {
+	return e.err
+}
+
+// streamAttempt runs a single (streaming) attempt of a call, marking errors that happen after anything was streamed.
+func streamAttempt(fn StreamFunc, call func(fn StreamFunc) (string, error)) (string, error) {
+	streamed := false
+	response, err := call(func(chunk string) {
+		if chunk == "" {
+			return
+		}
+		streamed = true
+		fn(chunk)
+	})
+	if err != nil && streamed {
+		return response, &streamError{err}
+	}
+	return response, err
+}
+
+func completeStream(ctx context.Context, req CompletionRequest, fn StreamFunc) (string, error) {
+	if fn == nil {
+		return provider.Complete(ctx, req)
+	}
+	return streamAttempt(fn, func(fn StreamFunc) (string, error) {
+		if s, ok := provider.(Streamer); ok {
+			return s.CompleteStream(ctx, req, fn)
+		}
+		response, err := provider.Complete(ctx, req)
+		if err == nil {
+			fn(response)
+		}
+		return response, err
+	})
+}
+
+func chatStream(ctx context.Context, req ChatRequest, fn StreamFunc) (string, error) {
+	if fn == nil {
+		return provider.Chat(ctx, req)
+	}
+	return streamAttempt(fn, func(fn StreamFunc) (string, error) {
+		if s, ok := provider.(Streamer); ok {
+			return s.ChatStream(ctx, req, fn)
+		}
+		response, err := provider.Chat(ctx, req)
+		if err == nil {
+			fn(response)
+		}
+		return response, err
+	})
+}
+
+// GenerateSimpleCompletionStream is the same as GenerateSimpleCompletionWithModel, but calls fn with each piece of the response
+// as it's generated, and returns the reasoning of reasoning models along with the answer once it's done.
+// fn gets the raw response, reasoning included (see ThinkFilter); it can be nil, if only the reasoning is wanted.
+//
+// Failed calls are only retried if nothing was streamed yet.
+func GenerateSimpleCompletionStream(ctx context.Context, model string, systemPrompt string, prompt string, fn StreamFunc) (Response, error) {
+	start := time.Now()
+
+	response, err := withRetry(ctx, model, func(ctx context.Context) (Response, error) {
+		raw, err := completeStream(ctx, CompletionRequest{
+			Model:        model,
+			SystemPrompt: systemPrompt,
+			Prompt:       prompt,
+			Temperature:  0.0,
+		}, fn)
+		if err != nil {
+			return Response{}, err
+		}
+		return splitResponse(raw, fn != nil)
+	})
+	if err != nil {
+		return Response{}, errors.Join(errors.New("GenerateSimpleCompletion: error generating completion;"), err)
+	}
+
+	recordResponse(model, start, response)
+	return response, nil
+}
+
+// GenerateChatCompletionStream is the same as GenerateChatCompletionWithModel, but calls fn with each piece of the message
+// as it's generated, and returns the reasoning of reasoning models along with the answer once it's done.
+// fn gets the raw message, reasoning included (see ThinkFilter); it can be nil, if only the reasoning is wanted.
+//
+// Failed calls are only retried if nothing was streamed yet.
+func GenerateChatCompletionStream(ctx context.Context, model string, messages []Message, fn StreamFunc) (Response, error) {
+	start := time.Now()
+
+	response, err := withRetry(ctx, model, func(ctx context.Context) (Response, error) {
+		raw, err := chatStream(ctx, ChatRequest{
+			Model:       model,
+			Messages:    messages,
+			Temperature: 0.0,
+		}, fn)
+		if err != nil {
+			return Response{}, err
+		}
+		return splitResponse(raw, fn != nil)
+	})
+	if err != nil {
+		return Response{}, errors.Join(errors.New("GenerateChatCompletion: error generating completion;"), err)
+	}
+
+	recordResponse(model, start, response)
+	return response, nil
+}
+
+// splitResponse separates the reasoning of a response from its answer. A response without an answer (e.g. the model only
+// reasoned, and was cut off) counts as empty; it's only retried if none of it was streamed.
+func splitResponse(raw string, streamed bool) (Response, error) {
+	response := SplitReasoning(raw)
+	if response.Answer == "" {
+		if streamed && raw != "" {
+			return response, &streamError{EmptyResponseError}
+		}
+		return response, EmptyResponseError
+	}
+	return response, nil
+}
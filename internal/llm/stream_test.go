@@ -0,0 +1,58 @@
+package llm_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/webbben/caius/internal/llm"
+)
+
+func TestGenerateSimpleCompletionStream(t *testing.T) {
+	useRetryProvider(t, &llm.FakeProvider{
+		Respond: func(req llm.CompletionRequest, schema json.RawMessage) (string, error) {
+			return "a streamed response", nil
+		},
+	}, fastRetryPolicy)
+
+	chunks := []string{}
+	response, err := llm.GenerateSimpleCompletionStream(context.Background(), "stream", "", "hi", func(chunk string) {
+		chunks = append(chunks, chunk)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(chunks) != 3 || strings.Join(chunks, "") != response.Answer || response.Answer != "a streamed response" {
+		t.Errorf("unexpected response %q from chunks %q", response, chunks)
+	}
+}
+
+// brokenStreamProvider streams part of a response, and then fails
+type brokenStreamProvider struct {
+	*llm.FakeProvider
+	calls int
+}
+
+func (b *brokenStreamProvider) CompleteStream(ctx context.Context, req llm.CompletionRequest, fn llm.StreamFunc) (string, error) {
+	b.calls++
+	fn("partial ")
+	return "partial ", errors.New("connection reset")
+}
+
+func TestStreamNotRetriedAfterOutput(t *testing.T) {
+	provider := &brokenStreamProvider{FakeProvider: &llm.FakeProvider{}}
+	useRetryProvider(t, provider, fastRetryPolicy)
+
+	output := ""
+	_, err := llm.GenerateSimpleCompletionStream(context.Background(), "stream-broken", "", "hi", func(chunk string) {
+		output += chunk
+	})
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	if provider.calls != 1 || output != "partial " {
+		t.Errorf("expected a single attempt, got %v attempts with output %q", provider.calls, output)
+	}
+}
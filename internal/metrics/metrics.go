@@ -2,6 +2,7 @@ package metrics
 
 import (
 	"fmt"
+	"sync"
 	"time"
 )
 
@@ -14,12 +15,25 @@ type modelUsage struct {
 	minCallDuration   time.Duration
 	maxCallDuration   time.Duration
 	init              bool
+	retryCount        int // calls that were retried after an error
+	repairCount       int // responses that the model was asked to fix
+	reasoningTokens   int // (estimated) tokens the model spent reasoning before answering, e.g. deepseek-r1's <think> section
+	answerTokens      int // (estimated) tokens of the answers themselves
 }
 
 func (m modelUsage) String() string {
 	s := fmt.Sprintf("call count: %v", m.callCount)
-	ave := m.totalCallDuration.Milliseconds() / int64(m.callCount)
-	s += fmt.Sprintf("\nAve/Min/Max call time: %v ms / %v ms / %v ms", ave, m.minCallDuration.Milliseconds(), m.maxCallDuration.Milliseconds())
+	if m.callCount > 0 {
+		ave := m.totalCallDuration.Milliseconds() / int64(m.callCount)
+		s += fmt.Sprintf("\nAve/Min/Max call time: %v ms / %v ms / %v ms", ave, m.minCallDuration.Milliseconds(), m.maxCallDuration.Milliseconds())
+	}
+	if m.retryCount > 0 || m.repairCount > 0 {
+		s += fmt.Sprintf("\nretries: %v, repaired responses: %v", m.retryCount, m.repairCount)
+	}
+	if m.reasoningTokens > 0 {
+		share := m.reasoningTokens * 100 / (m.reasoningTokens + m.answerTokens)
+		s += fmt.Sprintf("\nestimated tokens: %v reasoning / %v answer (%v%% reasoning)", m.reasoningTokens, m.answerTokens, share)
+	}
 	return s
 }
 
@@ -42,16 +56,69 @@ func (m *modelUsage) RecordUsage(startTime time.Time) {
 }
 
 var modelUsageMap map[string]*modelUsage = map[string]*modelUsage{}
+var modelUsageMutex sync.Mutex
 
 func RecordModelUsage(modelName string, startTime time.Time) {
+	modelUsageMutex.Lock()
+	defer modelUsageMutex.Unlock()
+
+	getModelUsage(modelName).RecordUsage(startTime)
+}
+
+func getModelUsage(modelName string) *modelUsage {
 	if _, ok := modelUsageMap[modelName]; !ok {
 		modelUsageMap[modelName] = &modelUsage{}
 	}
+	return modelUsageMap[modelName]
+}
 
-	modelUsageMap[modelName].RecordUsage(startTime)
+// RecordModelRetry counts a call to the model that failed and was tried again
+func RecordModelRetry(modelName string) {
+	modelUsageMutex.Lock()
+	defer modelUsageMutex.Unlock()
+	getModelUsage(modelName).retryCount++
+}
+
+// RecordModelRepair counts a response from the model that was invalid, and was sent back to the model to be fixed
+func RecordModelRepair(modelName string) {
+	modelUsageMutex.Lock()
+	defer modelUsageMutex.Unlock()
+	getModelUsage(modelName).repairCount++
+}
+
+// ModelRetryCounts gives the number of retries and repairs recorded for a model
+func ModelRetryCounts(modelName string) (retries int, repairs int) {
+	modelUsageMutex.Lock()
+	defer modelUsageMutex.Unlock()
+	if usage, ok := modelUsageMap[modelName]; ok {
+		return usage.retryCount, usage.repairCount
+	}
+	return 0, 0
+}
+
+// RecordModelTokens counts the (estimated) tokens of a response, split into the model's reasoning and its actual answer
+func RecordModelTokens(modelName string, reasoningTokens int, answerTokens int) {
+	modelUsageMutex.Lock()
+	defer modelUsageMutex.Unlock()
+	usage := getModelUsage(modelName)
+	usage.reasoningTokens += reasoningTokens
+	usage.answerTokens += answerTokens
+}
+
+// ModelTokenCounts gives the (estimated) reasoning and answer tokens recorded for a model
+func ModelTokenCounts(modelName string) (reasoning int, answer int) {
+	modelUsageMutex.Lock()
+	defer modelUsageMutex.Unlock()
+	if usage, ok := modelUsageMap[modelName]; ok {
+		return usage.reasoningTokens, usage.answerTokens
+	}
+	return 0, 0
 }
 
 func ShowAllModelUsageMetrics() {
+	modelUsageMutex.Lock()
+	defer modelUsageMutex.Unlock()
+
 	for modelName, usage := range modelUsageMap {
 		fmt.Println(modelName)
 		fmt.Printf("%s\n", usage)
@@ -59,5 +126,8 @@ func ShowAllModelUsageMetrics() {
 }
 
 func ResetModelUsageStats() {
+	modelUsageMutex.Lock()
+	defer modelUsageMutex.Unlock()
+
 	modelUsageMap = map[string]*modelUsage{}
 }
@@ -3,6 +3,7 @@ package metrics
 import (
 	"fmt"
 	"log"
+	"sync"
 	"time"
 )
 
@@ -56,8 +57,12 @@ func (s speedRecord) CalculateTimeEstimate(count int) time.Duration {
 }
 
 var speedRecordMap map[string]*speedRecord = map[string]*speedRecord{}
+var speedRecordMutex sync.Mutex
 
 func AddSpeedRecord(functionName string, startTime time.Time, ctx FileContext) {
+	speedRecordMutex.Lock()
+	defer speedRecordMutex.Unlock()
+
 	if _, ok := speedRecordMap[functionName]; !ok {
 		speedRecordMap[functionName] = &speedRecord{}
 	}
@@ -67,6 +72,9 @@ func AddSpeedRecord(functionName string, startTime time.Time, ctx FileContext) {
 
 // Just for viewing data - use AddSpeedRecord for saving new data
 func SpeedRecord(functionName string) speedRecord {
+	speedRecordMutex.Lock()
+	defer speedRecordMutex.Unlock()
+
 	record, exists := speedRecordMap[functionName]
 	if exists {
 		return *record
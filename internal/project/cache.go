@@ -0,0 +1,90 @@
+package project
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/webbben/caius/internal/cache"
+	"github.com/webbben/caius/internal/config"
+	"github.com/webbben/caius/prompts"
+)
+
+var analysisCache *cache.Cache
+
+// SetAnalysisCache sets the cache that AnalyzeFileBasic uses to skip files it has already analyzed. nil disables caching.
+func SetAnalysisCache(c *cache.Cache) {
+	analysisCache = c
+}
+
+// PromptVersion identifies the current version of the prompts used in file analysis.
+// Changing any of these prompts invalidates previously cached analyses.
+func PromptVersion() string {
+	allPrompts := prompts.P_ANALYZE_FILE_01 + prompts.P_ANALYZE_FILE_TYPE_01 + prompts.P_ANALYZE_FILE_CHUNK_01 + prompts.P_ANALYZE_FILE_CHUNKS_01
+	return cache.HashContent([]byte(allPrompts))[:12]
+}
+
+// analysisCacheKey identifies an analysis by the file's path in the project, its content, and the models and prompts it was made with.
+// The path is included since it's stored in the cache entry, and the file name goes into the prompts.
+func analysisCacheKey(relPath string, contentHash string) string {
+	return cache.Key(contentHash, filepath.ToSlash(relPath), config.BASIC_FILE_ANALYSIS_MODEL, config.DETECT_FILE_TYPE_MODEL, PromptVersion())
+}
+
+// projectRelPath gives the path of a file relative to the project root, or its absolute path if it's outside of the project.
+func projectRelPath(root string, filePath string) string {
+	absPath, err := filepath.Abs(filePath)
+	if err != nil {
+		absPath = filePath
+	}
+	relPath, err := filepath.Rel(root, absPath)
+	if err != nil || relPath == ".." || strings.HasPrefix(relPath, ".."+string(filepath.Separator)) {
+		return absPath
+	}
+	return relPath
+}
+
+func getCachedAnalysis(filePath string, fileContent []byte) (BasicFileAnalysisResponse, bool) {
+	if analysisCache == nil {
+		return BasicFileAnalysisResponse{}, false
+	}
+	var response BasicFileAnalysisResponse
+	key := analysisCacheKey(projectRelPath(analysisCache.Root, filePath), cache.HashContent(fileContent))
+	found, err := analysisCache.Get(key, &response)
+	if err != nil {
+		log.Println("failed to read from analysis cache:", err)
+		return BasicFileAnalysisResponse{}, false
+	}
+	return response, found
+}
+
+func putCachedAnalysis(filePath string, fileContent []byte, response BasicFileAnalysisResponse) {
+	if analysisCache == nil {
+		return
+	}
+	absPath, err := filepath.Abs(filePath)
+	if err != nil {
+		absPath = filePath
+	}
+	contentHash := cache.HashContent(fileContent)
+	err = analysisCache.Put(cache.Entry{
+		Key:           analysisCacheKey(projectRelPath(analysisCache.Root, absPath), contentHash),
+		FilePath:      absPath,
+		ContentHash:   contentHash,
+		Model:         config.BASIC_FILE_ANALYSIS_MODEL,
+		PromptVersion: PromptVersion(),
+	}, response)
+	if err != nil {
+		log.Println("failed to write to analysis cache:", err)
+	}
+}
+
+// IsCacheEntryStale reports if a cached analysis can no longer be used: either the file has changed (or is gone),
+// or the analysis was made with different models or prompts than are currently configured.
+func IsCacheEntryStale(c *cache.Cache, entry cache.Entry) bool {
+	fileContent, err := os.ReadFile(entry.FilePath)
+	if err != nil {
+		return true
+	}
+	return analysisCacheKey(projectRelPath(c.Root, entry.FilePath), cache.HashContent(fileContent)) != entry.Key
+}
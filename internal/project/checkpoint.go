@@ -0,0 +1,168 @@
+package project
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/webbben/caius/internal/cache"
+)
+
+// Checkpoint is a journal of the files that have been analyzed so far in a directory analysis, so that an analysis that failed
+// or was interrupted can be resumed without redoing them.
+//
+// Each analyzed file is appended to the journal as a single JSON line as soon as it's done, so the journal is never more than
+// one line behind, even if caius is killed.
+type Checkpoint struct {
+	path string
+	root string // absolute path of the project root
+
+	mu      sync.Mutex
+	f       *os.File
+	entries map[string]checkpointEntry // by absolute file path
+}
+
+type checkpointEntry struct {
+	Path string `json:"path"` // absolute path of the file
+	// Key identifies the file content, models and prompts the result was generated with (same as the analysis cache key),
+	// so results are only reused if the file hasn't changed and the configuration is the same.
+	Key        string                    `json:"key"`
+	Result     BasicFileAnalysisResponse `json:"result"`
+	AnalyzedAt time.Time                 `json:"analyzed_at"`
+}
+
+// CheckpointPath gives the path of the checkpoint journal of a project's directory analysis
+func CheckpointPath(root string) string {
+	return filepath.Join(root, ".caius", "checkpoint.jsonl")
+}
+
+// OpenCheckpoint opens the checkpoint journal of a project. If resume is true, the files recorded in an existing journal
+// are kept (see Lookup); otherwise the journal is started over.
+func OpenCheckpoint(root string, resume bool) (*Checkpoint, error) {
+	root, err := filepath.Abs(root)
+	if err != nil {
+		return nil, err
+	}
+	cp := &Checkpoint{
+		path:    CheckpointPath(root),
+		root:    root,
+		entries: map[string]checkpointEntry{},
+	}
+	err = os.MkdirAll(filepath.Dir(cp.path), 0755)
+	if err != nil {
+		return nil, errors.Join(errors.New("checkpoint: failed to create .caius directory;"), err)
+	}
+
+	flags := os.O_CREATE | os.O_WRONLY | os.O_APPEND
+	if resume {
+		if err := cp.load(); err != nil {
+			return nil, err
+		}
+	} else {
+		flags |= os.O_TRUNC
+	}
+	cp.f, err = os.OpenFile(cp.path, flags, 0644)
+	if err != nil {
+		return nil, errors.Join(errors.New("checkpoint: failed to open journal;"), err)
+	}
+	return cp, nil
+}
+
+// load reads the entries of an existing journal. A line that can't be parsed (e.g. one that was cut off by a crash) is skipped.
+func (cp *Checkpoint) load() error {
+	f, err := os.Open(cp.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return errors.Join(errors.New("checkpoint: failed to read journal;"), err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var entry checkpointEntry
+		if json.Unmarshal(scanner.Bytes(), &entry) != nil || entry.Path == "" {
+			continue
+		}
+		cp.entries[entry.Path] = entry
+	}
+	return scanner.Err()
+}
+
+// Len gives the number of files recorded in the journal
+func (cp *Checkpoint) Len() int {
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+	return len(cp.entries)
+}
+
+// Lookup gives the recorded result of a file, if it was analyzed before and hasn't changed since.
+func (cp *Checkpoint) Lookup(filePath string) (BasicFileAnalysisResponse, bool) {
+	cp.mu.Lock()
+	entry, found := cp.entries[filePath]
+	cp.mu.Unlock()
+	if !found {
+		return BasicFileAnalysisResponse{}, false
+	}
+	key, err := checkpointKey(cp.root, filePath)
+	if err != nil || key != entry.Key {
+		return BasicFileAnalysisResponse{}, false
+	}
+	return entry.Result, true
+}
+
+// Record appends the result of a file to the journal.
+func (cp *Checkpoint) Record(filePath string, result BasicFileAnalysisResponse) error {
+	key, err := checkpointKey(cp.root, filePath)
+	if err != nil {
+		return err
+	}
+	entry := checkpointEntry{
+		Path:       filePath,
+		Key:        key,
+		Result:     result,
+		AnalyzedAt: time.Now(),
+	}
+	b, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+	cp.entries[filePath] = entry
+	_, err = cp.f.Write(append(b, '\n'))
+	if err != nil {
+		return errors.Join(errors.New("checkpoint: failed to write journal;"), err)
+	}
+	return nil
+}
+
+// Close closes the journal, keeping it on disk so the analysis can be resumed.
+func (cp *Checkpoint) Close() error {
+	return cp.f.Close()
+}
+
+// Remove closes and deletes the journal, once the analysis it's for has finished.
+func (cp *Checkpoint) Remove() error {
+	cp.f.Close()
+	err := os.Remove(cp.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+func checkpointKey(root string, filePath string) (string, error) {
+	content, err := os.ReadFile(filePath)
+	if err != nil {
+		return "", err
+	}
+	return analysisCacheKey(projectRelPath(root, filePath), cache.HashContent(content)), nil
+}
@@ -0,0 +1,86 @@
+package project
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/webbben/caius/internal/config"
+	"github.com/webbben/caius/internal/files"
+	"github.com/webbben/caius/internal/llm"
+	"github.com/webbben/caius/internal/metrics"
+	"github.com/webbben/caius/internal/utils"
+	"github.com/webbben/caius/prompts"
+)
+
+// contentTokenBudget gives the number of tokens of file content that fit into a single prompt for the model
+func contentTokenBudget(model string, sysPrompt string, header string) int {
+	budget := llm.PromptBudget(model, llm.ResponseTokenReserve, sysPrompt, header)
+	// always allow at least a little bit of content, even with tiny context windows
+	return max(budget, 256)
+}
+
+// analyzeFileContent runs the LLM analysis of a file's content.
+// If the file is too large for the model's context window, it's split into chunks which are summarized individually,
+// and then the chunk summaries are combined into the final analysis (map-reduce).
+func analyzeFileContent(ctx context.Context, header string, fileContent string, fileCtx metrics.FileContext) (BasicFileAnalysisResponse, error) {
+	model := config.BASIC_FILE_ANALYSIS_MODEL
+	var responseJson BasicFileAnalysisResponse
+
+	budget := contentTokenBudget(model, prompts.P_ANALYZE_FILE_01, header)
+	if llm.EstimateTokens(fileContent) <= budget {
+		prompt := fmt.Sprintf("%s\n\n(file content below)\n\n%s", header, fileContent)
+		err := llm.GenerateCompletionJsonWithModel(ctx, model, prompts.P_ANALYZE_FILE_01, prompt, BasicFileAnalysisSchema, &responseJson)
+		return responseJson, err
+	}
+
+	// map: summarize each chunk of the file
+	summaries, err := summarizeChunks(ctx, header, fileContent, fileCtx)
+	if err != nil {
+		return responseJson, err
+	}
+
+	// reduce: if the summaries still don't fit, keep summarizing them until they do
+	reduceBudget := contentTokenBudget(model, prompts.P_ANALYZE_FILE_CHUNKS_01, header)
+	for llm.EstimateTokens(summaries) > reduceBudget {
+		reduced, err := summarizeChunks(ctx, header+"\n(content below is summaries of sections of the file)", summaries, fileCtx)
+		if err != nil {
+			return responseJson, err
+		}
+		if len(reduced) >= len(summaries) {
+			// summaries aren't getting any smaller, so just cut them off
+			summaries = files.TruncateText(reduced, reduceBudget*4)
+			break
+		}
+		summaries = reduced
+	}
+
+	prompt := fmt.Sprintf("%s\n\n(summaries of each section of the file below)\n\n%s", header, summaries)
+	err = llm.GenerateCompletionJsonWithModel(ctx, model, prompts.P_ANALYZE_FILE_CHUNKS_01, prompt, BasicFileAnalysisSchema, &responseJson)
+	return responseJson, err
+}
+
+// summarizeChunks splits content into chunks that fit into the context window, and summarizes each one.
+// The summaries are returned together, each labelled with its line range.
+func summarizeChunks(ctx context.Context, header string, content string, fileCtx metrics.FileContext) (string, error) {
+	model := config.BASIC_FILE_ANALYSIS_MODEL
+	budget := contentTokenBudget(model, prompts.P_ANALYZE_FILE_CHUNK_01, header)
+	chunks := files.ChunkText(content, budget*4)
+
+	summaries := []string{}
+	for i, chunk := range chunks {
+		start := time.Now()
+		prompt := fmt.Sprintf("%s\nSection: %v of %v (lines %v-%v)\n\n(section content below)\n\n%s", header, i+1, len(chunks), chunk.StartLine, chunk.EndLine, chunk.Text)
+
+		var resp DescribeProjectResponse
+		err := llm.GenerateCompletionJsonWithModel(ctx, model, prompts.P_ANALYZE_FILE_CHUNK_01, prompt, DescribeProjectSchema, &resp)
+		if err != nil {
+			return "", utils.WrapError(fmt.Sprintf("error summarizing lines %v-%v", chunk.StartLine, chunk.EndLine), err)
+		}
+		summaries = append(summaries, fmt.Sprintf("Lines %v-%v: %s", chunk.StartLine, chunk.EndLine, strings.TrimSpace(resp.Description)))
+		metrics.AddSpeedRecord("AnalyzeFileChunk", start, fileCtx)
+	}
+
+	return strings.Join(summaries, "\n"), nil
+}
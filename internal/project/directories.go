@@ -0,0 +1,251 @@
+package project
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/webbben/caius/internal/config"
+	"github.com/webbben/caius/internal/files"
+	"github.com/webbben/caius/internal/llm"
+	"github.com/webbben/caius/internal/utils"
+	"github.com/webbben/caius/prompts"
+)
+
+// DirectorySummary is an LLM generated summary of a directory, built from the descriptions of its files and subdirectories.
+type DirectorySummary struct {
+	Path        string `json:"path" yaml:"path"` // path of the directory, relative to (and including) the project root's name
+	Description string `json:"description" yaml:"description"`
+	FileCount   int    `json:"file_count" yaml:"file_count"` // number of analyzed files under this directory (including subdirectories)
+}
+
+type ProjectMapBudget struct {
+	MaxLines  int // max number of lines in the project map. 0 means no limit.
+	MaxTokens int // max (estimated) number of tokens in the project map. 0 means no limit.
+}
+
+// dirNode is a directory in the tree of analyzed files
+type dirNode struct {
+	path      string
+	files     []FileData
+	children  []*dirNode
+	fileCount int
+	summary   string
+}
+
+// displayPath gives the path as it's shown to the LLM; relative to the root, but prefixed with the root directory's name
+func displayPath(root string, path string) string {
+	trimmedPath := strings.TrimPrefix(path, root)
+	return filepath.Join(filepath.Base(root), trimmedPath)
+}
+
+func fileMapLine(root string, fd FileData) string {
+	return fmt.Sprintf("%s (%s) - %s", displayPath(root, fd.FullPath), fd.Type, fd.Description)
+}
+
+func dirMapLine(root string, d *dirNode) string {
+	return fmt.Sprintf("%s/ (directory, %v files) - %s", displayPath(root, d.path), d.fileCount, d.summary)
+}
+
+func (b ProjectMapBudget) fits(lines []string) bool {
+	if b.MaxLines > 0 && len(lines) > b.MaxLines {
+		return false
+	}
+	if b.MaxTokens > 0 && llm.EstimateTokens(strings.Join(lines, "\n")) > b.MaxTokens {
+		return false
+	}
+	return true
+}
+
+// buildDirectoryTree arranges all LLM processed files into a tree of their directories, starting from root.
+func buildDirectoryTree(root string, fileDataList []FileData) *dirNode {
+	fileDataByPath := map[string]FileData{}
+	paths := []string{}
+	for _, fd := range fileDataList {
+		if fd.SkipLLMProcessing {
+			continue
+		}
+		fileDataByPath[fd.FullPath] = fd
+		paths = append(paths, fd.FullPath)
+	}
+
+	nodes := map[string]*dirNode{root: {path: root}}
+	var getNode func(dir string) *dirNode
+	getNode = func(dir string) *dirNode {
+		if node, exists := nodes[dir]; exists {
+			return node
+		}
+		node := &dirNode{path: dir}
+		nodes[dir] = node
+		parent := getNode(filepath.Dir(dir))
+		parent.children = append(parent.children, node)
+		return node
+	}
+
+	for dir, dirFiles := range files.GroupFilesByDirectory(paths) {
+		node := getNode(dir)
+		for _, path := range dirFiles {
+			node.files = append(node.files, fileDataByPath[path])
+		}
+	}
+
+	// map iteration order is random, so sort everything to keep the project map deterministic
+	var finish func(n *dirNode) int
+	finish = func(n *dirNode) int {
+		sort.Slice(n.files, func(i, j int) bool { return n.files[i].FullPath < n.files[j].FullPath })
+		sort.Slice(n.children, func(i, j int) bool { return n.children[i].path < n.children[j].path })
+		n.fileCount = len(n.files)
+		for _, child := range n.children {
+			n.fileCount += finish(child)
+		}
+		return n.fileCount
+	}
+	finish(nodes[root])
+
+	return nodes[root]
+}
+
+// renderProjectMap lists the files of a directory, followed by its subdirectories.
+// subdirectories that are in the expanded set have all their contents listed; otherwise only their summary is shown.
+func renderProjectMap(root string, n *dirNode, expanded func(*dirNode) bool) []string {
+	lines := []string{}
+	for _, fd := range n.files {
+		lines = append(lines, fileMapLine(root, fd))
+	}
+	for _, child := range n.children {
+		if expanded(child) {
+			lines = append(lines, renderProjectMap(root, child, expanded)...)
+		} else {
+			lines = append(lines, dirMapLine(root, child))
+		}
+	}
+	return lines
+}
+
+// summarizeDirectories generates a summary for every directory below the root, starting from the deepest directories.
+// Parent directories are summarized using their files and the summaries of their subdirectories, so the LLM never has to read
+// more than one directory's worth of lines at a time.
+func summarizeDirectories(ctx context.Context, root string, n *dirNode) ([]DirectorySummary, error) {
+	summaries := []DirectorySummary{}
+	for _, child := range n.children {
+		childSummaries, err := summarizeDirectories(ctx, root, child)
+		if err != nil {
+			return nil, err
+		}
+		summaries = append(summaries, childSummaries...)
+	}
+
+	// the root directory is described by DescribeProject
+	if n.path == root {
+		return summaries, nil
+	}
+
+	if len(n.files) == 1 && len(n.children) == 0 {
+		// nothing to summarize; a single file describes its directory well enough
+		n.summary = n.files[0].Description
+	} else {
+		dirMap := renderProjectMap(root, n, func(*dirNode) bool { return false })
+		utils.Terminal.Lowkey("summarizing " + displayPath(root, n.path) + "/ ...")
+		var resp DescribeProjectResponse
+		err := llm.GenerateCompletionJsonWithModel(ctx, config.DIRECTORY_SUMMARY_MODEL, prompts.P_SUMMARIZE_DIRECTORY_01, strings.Join(dirMap, "\n"), DescribeProjectSchema, &resp)
+		if err != nil {
+			return nil, utils.WrapError("error summarizing directory "+n.path, err)
+		}
+		n.summary = strings.TrimSpace(resp.Description)
+	}
+
+	summaries = append(summaries, DirectorySummary{
+		Path:        displayPath(root, n.path),
+		Description: n.summary,
+		FileCount:   n.fileCount,
+	})
+	return summaries, nil
+}
+
+// compressProjectMap builds a project map that fits into the given budget.
+// Starting from the root, directories are expanded (breadth first) into their full contents for as long as the budget allows;
+// the rest are represented by their summaries. summarizeDirectories must have been run on the tree first.
+func compressProjectMap(root string, tree *dirNode, budget ProjectMapBudget) []string {
+	expandedSet := map[*dirNode]bool{}
+	expanded := func(n *dirNode) bool { return expandedSet[n] }
+
+	lines := renderProjectMap(root, tree, expanded)
+	if !budget.fits(lines) {
+		// even with nothing expanded, the root's own files and the summaries of its subdirectories are too much
+		return truncateRootFiles(root, tree, budget)
+	}
+	queue := append([]*dirNode{}, tree.children...)
+	for len(queue) > 0 {
+		n := queue[0]
+		queue = queue[1:]
+
+		expandedSet[n] = true
+		candidate := renderProjectMap(root, tree, expanded)
+		if !budget.fits(candidate) {
+			expandedSet[n] = false
+			continue
+		}
+		lines = candidate
+		queue = append(queue, n.children...)
+	}
+	return lines
+}
+
+// truncateRootFiles builds the smallest project map: as many of the root's own files as fit into the budget, followed by
+// a line that counts the rest, and the summaries of the root's subdirectories. If even that doesn't fit, it's cut off at the budget.
+func truncateRootFiles(root string, tree *dirNode, budget ProjectMapBudget) []string {
+	dirLines := []string{}
+	for _, child := range tree.children {
+		dirLines = append(dirLines, dirMapLine(root, child))
+	}
+	render := func(keep int) []string {
+		lines := []string{}
+		for _, fd := range tree.files[:keep] {
+			lines = append(lines, fileMapLine(root, fd))
+		}
+		if more := len(tree.files) - keep; more > 0 {
+			lines = append(lines, fmt.Sprintf("(%v more files)", more))
+		}
+		return append(lines, dirLines...)
+	}
+
+	// the more files are kept, the larger the map; find the most that fit
+	keep := sort.Search(len(tree.files)+1, func(n int) bool { return !budget.fits(render(n)) }) - 1
+	if keep >= 0 {
+		return render(keep)
+	}
+	return truncateLines(render(0), budget)
+}
+
+// truncateLines cuts lines off at the end until they fit into the budget, and replaces them with a line that counts them
+func truncateLines(lines []string, budget ProjectMapBudget) []string {
+	cut := func(n int) []string {
+		if n == len(lines) {
+			return lines
+		}
+		return append(lines[:n:n], fmt.Sprintf("(%v more lines)", len(lines)-n))
+	}
+	keep := sort.Search(len(lines)+1, func(n int) bool { return !budget.fits(cut(n)) }) - 1
+	return cut(max(keep, 0))
+}
+
+// BuildProjectMap creates the text given to DescribeProject: a list of every analyzed file and its description.
+// If that list doesn't fit in the budget, directories are summarized bottom-up, and the deeper parts of the project are
+// represented by directory summaries instead of individual files.
+func BuildProjectMap(ctx context.Context, root string, fileDataList []FileData, budget ProjectMapBudget) (string, []DirectorySummary, error) {
+	tree := buildDirectoryTree(root, fileDataList)
+
+	lines := renderProjectMap(root, tree, func(*dirNode) bool { return true })
+	if budget.fits(lines) {
+		return strings.Join(lines, "\n"), []DirectorySummary{}, nil
+	}
+
+	summaries, err := summarizeDirectories(ctx, root, tree)
+	if err != nil {
+		return "", nil, err
+	}
+	lines = compressProjectMap(root, tree, budget)
+	return strings.Join(lines, "\n"), summaries, nil
+}
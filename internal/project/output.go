@@ -0,0 +1,121 @@
+package project
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ProjectAnalysis is the full result of AnalyzeDirectory.
+type ProjectAnalysis struct {
+	Name                  string             `json:"name" yaml:"name"`
+	Root                  string             `json:"root" yaml:"root"`
+	Description           string             `json:"description" yaml:"description"`
+	ProjectMap            string             `json:"project_map" yaml:"project_map"` // the map of files (and directory summaries) that the description was generated from
+	Files                 []FileData         `json:"files" yaml:"files"`
+	Directories           []DirectorySummary `json:"directories" yaml:"directories"`
+	LLMProcessedFileCount int                `json:"llm_processed_file_count" yaml:"llm_processed_file_count"`
+	LLMProcessedBytes     int64              `json:"llm_processed_bytes" yaml:"llm_processed_bytes"`
+	CreatedAt             time.Time          `json:"created_at" yaml:"created_at"`
+	// Partial is set if the analysis stopped before it finished (because it failed or was interrupted).
+	// Files that weren't reached yet are missing, and the project map and description may be empty.
+	Partial  bool          `json:"partial,omitempty" yaml:"partial,omitempty"`
+	Failures []FileFailure `json:"failures,omitempty" yaml:"failures,omitempty"` // files that couldn't be analyzed
+}
+
+// FileFailure is a file that couldn't be analyzed, and why.
+type FileFailure struct {
+	Path  string `json:"path" yaml:"path"` // relative to (and including) the project root's name
+	Error string `json:"error" yaml:"error"`
+}
+
+// supported formats for exporting a ProjectAnalysis
+var OutputFormats []string = []string{"text", "json", "markdown", "yaml"}
+
+// ValidateOutputFormat returns an error if the format isn't one of the OutputFormats
+func ValidateOutputFormat(format string) error {
+	switch format {
+	case "", "text", "json", "markdown", "md", "yaml", "yml":
+		return nil
+	default:
+		return fmt.Errorf("unknown output format %q (expected one of: %s)", format, strings.Join(OutputFormats, ", "))
+	}
+}
+
+// Format renders the project analysis in one of the OutputFormats.
+func (p ProjectAnalysis) Format(format string) ([]byte, error) {
+	switch format {
+	case "", "text":
+		return []byte(p.Description + "\n"), nil
+	case "json":
+		b, err := json.MarshalIndent(p, "", "  ")
+		if err != nil {
+			return nil, err
+		}
+		return append(b, '\n'), nil
+	case "markdown", "md":
+		return []byte(p.Markdown()), nil
+	case "yaml", "yml":
+		return yaml.Marshal(p)
+	default:
+		return nil, ValidateOutputFormat(format)
+	}
+}
+
+// Markdown renders the project analysis as a markdown document, e.g. for committing as a PROJECT_MAP.md
+func (p ProjectAnalysis) Markdown() string {
+	var sb strings.Builder
+
+	fmt.Fprintf(&sb, "# %s\n\n", p.Name)
+	fmt.Fprintf(&sb, "%s\n\n", strings.TrimSpace(p.Description))
+
+	if len(p.Directories) > 0 {
+		sb.WriteString("## Directories\n\n")
+		sb.WriteString("| Directory | Files | Summary |\n")
+		sb.WriteString("| --- | --- | --- |\n")
+		for _, dir := range p.Directories {
+			fmt.Fprintf(&sb, "| `%s/` | %v | %s |\n", dir.Path, dir.FileCount, markdownTableCell(dir.Description))
+		}
+		sb.WriteString("\n")
+	}
+
+	sb.WriteString("## Files\n")
+
+	// group the files under headings for their directory
+	byDir := map[string][]FileData{}
+	dirs := []string{}
+	for _, fd := range p.Files {
+		dir := filepath.Dir(fd.Path)
+		if _, exists := byDir[dir]; !exists {
+			dirs = append(dirs, dir)
+		}
+		byDir[dir] = append(byDir[dir], fd)
+	}
+	slices.Sort(dirs)
+
+	for _, dir := range dirs {
+		fmt.Fprintf(&sb, "\n### `%s/`\n\n", dir)
+		for _, fd := range byDir[dir] {
+			line := fmt.Sprintf("- `%s`", fd.Filename)
+			if fd.Type != "" {
+				line += fmt.Sprintf(" (%s)", fd.Type)
+			}
+			if fd.Description != "" && fd.Description != fd.Type {
+				line += " - " + strings.TrimSpace(fd.Description)
+			}
+			sb.WriteString(line + "\n")
+		}
+	}
+
+	return sb.String()
+}
+
+func markdownTableCell(s string) string {
+	s = strings.ReplaceAll(s, "|", "\\|")
+	return strings.Join(strings.Fields(s), " ")
+}
@@ -1,6 +1,7 @@
 package project
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -8,6 +9,7 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/webbben/caius/internal/config"
@@ -19,66 +21,43 @@ import (
 )
 
 type FileData struct {
-	Filename          string
-	Type              string // The type of data in this file
-	Description       string // Description of what this file contains
-	FullPath          string
-	SkipLLMProcessing bool // Indicates if LLM should not bother analyzing file content
-	SizeBytes         int64
+	Filename          string `json:"filename" yaml:"filename"`
+	Path              string `json:"path" yaml:"path"`               // Path relative to (and including) the project root's name
+	Type              string `json:"type" yaml:"type"`               // The type of data in this file
+	Description       string `json:"description" yaml:"description"` // Description of what this file contains
+	FullPath          string `json:"full_path" yaml:"full_path"`
+	SkipLLMProcessing bool   `json:"skip_llm_processing" yaml:"skip_llm_processing"` // Indicates if LLM should not bother analyzing file content
+	SizeBytes         int64  `json:"size_bytes" yaml:"size_bytes"`
 }
 
 type BasicFileAnalysisResponse struct {
-	SKIP              bool   // if true, this file data will be discarded and not used anywhere
-	Type              string `json:"file_type"`
-	Description       string `json:"description"`
-	SkipLLMProcessing bool   `json:"skip_llm_processing"`
-	SizeBytes         int64  `json:"size_bytes"`
+	SKIP              bool   `jsonschema:"-"` // if true, this file data will be discarded and not used anywhere
+	Type              string `json:"file_type" jsonschema:"optional"`
+	Description       string `json:"description" jsonschema:"minLength=1"`
+	SkipLLMProcessing bool   `json:"skip_llm_processing" jsonschema:"-"`
+	SizeBytes         int64  `json:"size_bytes" jsonschema:"-"`
 }
 
 type DetectFileTypeLLMResponse struct {
-	Category string `json:"category"`
-	Type     string `json:"type"`
+	Category string `json:"category" jsonschema:"optional"`
+	Type     string `json:"type" jsonschema:"optional"`
 }
 
-var DetectFileTypeLLMSchema json.RawMessage = json.RawMessage(`{
-	"type": "object",
-	"properties": {
-		"category": {
-			"type": "string"
-		},
-		"type": {
-			"type": "string"
-		}
-	},
-	"required": ["category", "type"]
-}`)
-
-var BasicFileAnalysisSchema json.RawMessage = json.RawMessage(`{
-	"type": "object",
-	"properties": {
-		"file_type": {
-			"type": "string"
-		},
-		"description": {
-			"type": "string"
-		}
-	},
-	"required": ["file_type", "description"]
-}`)
+var DetectFileTypeLLMSchema json.RawMessage = llm.MustSchemaOf(DetectFileTypeLLMResponse{})
+
+var BasicFileAnalysisSchema json.RawMessage = llm.MustSchemaOf(BasicFileAnalysisResponse{})
 
 type DescribeProjectResponse struct {
-	Description string `json:"description"`
+	Description string `json:"description" jsonschema:"minLength=1"`
 }
 
-var DescribeProjectSchema json.RawMessage = json.RawMessage(`{
-	"type": "object",
-	"properties": {
-		"description": {
-			"type": "string"
-		}
-	},
-	"required": ["description"]
-}`)
+var DescribeProjectSchema json.RawMessage = llm.MustSchemaOf(DescribeProjectResponse{})
+
+// ProjectFilesOptions decides which files in a project are included in AnalyzeDirectory
+var ProjectFilesOptions files.GetProjectFilesOptions = files.GetProjectFilesOptions{
+	SkipDotfiles: true,
+	SkipIgnored:  true,
+}
 
 // GetProcessableFileInfo counts the number of files (and their size) for files that are text based and processed by LLMs.
 // Mainly used for calculating processing time estimates.
@@ -108,7 +87,7 @@ func GetProcessableFileInfo(fileList []string) (int, int64, error) {
 	return fileCount, b, nil
 }
 
-func DetectFileType(filename string, fileContent []byte, ctx *metrics.FileContext) (string, error) {
+func DetectFileType(ctx context.Context, filename string, fileContent []byte, fileCtx *metrics.FileContext) (string, error) {
 	// check file name, in case it has a specific type (e.g. readme files)
 	filetype, matchFound := files.FileTypeResolver(filename)
 	if matchFound {
@@ -135,7 +114,7 @@ func DetectFileType(filename string, fileContent []byte, ctx *metrics.FileContex
 
 	// failed to determine filetype by name, extension, content, etc. Last resort: use LLM
 	// we should avoid LLM calls whenever possible, since it is relatively expensive in terms of processing time
-	fileTypeResp, err := DetectFileTypeLLM(fileContent, ctx)
+	fileTypeResp, err := DetectFileTypeLLM(ctx, fileContent, fileCtx)
 	if err != nil {
 		return "", err
 	}
@@ -150,10 +129,9 @@ func DetectFileType(filename string, fileContent []byte, ctx *metrics.FileContex
 	return "", nil
 }
 
-func DetectFileTypeLLM(fileData []byte, ctx *metrics.FileContext) (DetectFileTypeLLMResponse, error) {
+func DetectFileTypeLLM(ctx context.Context, fileData []byte, fileCtx *metrics.FileContext) (DetectFileTypeLLMResponse, error) {
 	start := time.Now()
 	var responseJson DetectFileTypeLLMResponse
-	llm.SetModel(config.DETECT_FILE_TYPE_MODEL)
 
 	sysPrompt := prompts.P_ANALYZE_FILE_TYPE_01
 	sampleData := fileData
@@ -162,21 +140,21 @@ func DetectFileTypeLLM(fileData []byte, ctx *metrics.FileContext) (DetectFileTyp
 	}
 	prompt := string(sampleData)
 
-	err := llm.GenerateCompletionJson(sysPrompt, prompt, DetectFileTypeLLMSchema, &responseJson)
+	err := llm.GenerateCompletionJsonWithModel(ctx, config.DETECT_FILE_TYPE_MODEL, sysPrompt, prompt, DetectFileTypeLLMSchema, &responseJson)
 	if err != nil {
 		return DetectFileTypeLLMResponse{}, utils.WrapError("detectFileTypeLLM: error while generating completion", err)
 	}
 
 	responseJson.Type, _ = files.FileTypeResolver(responseJson.Type)
 
-	metrics.AddSpeedRecord("DetectFileTypeLLM", start, *ctx)
+	metrics.AddSpeedRecord("DetectFileTypeLLM", start, *fileCtx)
 	return responseJson, nil
 }
 
-func AnalyzeFileBasic(filePath string, fileName string) (BasicFileAnalysisResponse, error) {
+func AnalyzeFileBasic(ctx context.Context, filePath string, fileName string) (BasicFileAnalysisResponse, error) {
 	start := time.Now()
-	ctx := &metrics.FileContext{}
-	ctx.Filepath = filePath
+	fileCtx := &metrics.FileContext{}
+	fileCtx.Filepath = filePath
 
 	if files.IgnoreFiles(fileName) {
 		return BasicFileAnalysisResponse{
@@ -212,7 +190,7 @@ func AnalyzeFileBasic(filePath string, fileName string) (BasicFileAnalysisRespon
 		// empty file - ignore
 		return BasicFileAnalysisResponse{SKIP: true}, nil
 	}
-	ctx.FileBytes = fileInfo.Size()
+	fileCtx.FileBytes = fileInfo.Size()
 
 	fileContent, err := os.ReadFile(filePath)
 	if err != nil {
@@ -233,8 +211,13 @@ func AnalyzeFileBasic(filePath string, fileName string) (BasicFileAnalysisRespon
 		}, nil
 	}
 
+	// skip the LLM entirely if this exact file content has already been analyzed
+	if cached, found := getCachedAnalysis(filePath, fileContent); found {
+		return cached, nil
+	}
+
 	// detect file type
-	filetype, err := DetectFileType(fileName, fileContent, ctx)
+	filetype, err := DetectFileType(ctx, fileName, fileContent, fileCtx)
 	if err != nil {
 		return BasicFileAnalysisResponse{}, utils.WrapError("error while detecting filetype in AnalyzeFileBasic:", err)
 	}
@@ -244,15 +227,14 @@ func AnalyzeFileBasic(filePath string, fileName string) (BasicFileAnalysisRespon
 	if filetype != "" {
 		header = fmt.Sprintf("%s\nFile type: %s", header, filetype)
 	}
-	prompt := fmt.Sprintf("%s\n\n(file content below)\n\n%s", header, string(fileContent))
-
-	var responseJson BasicFileAnalysisResponse
-	llm.SetModel(config.BASIC_FILE_ANALYSIS_MODEL)
-	sysPrompt := prompts.P_ANALYZE_FILE_01
-	err = llm.GenerateCompletionJson(sysPrompt, prompt, BasicFileAnalysisSchema, &responseJson)
+	// large files are automatically split into chunks, if they don't fit in the model's context window
+	responseJson, err := analyzeFileContent(ctx, header, string(fileContent), *fileCtx)
 	if err != nil {
+		if ctx.Err() != nil {
+			return BasicFileAnalysisResponse{}, ctx.Err()
+		}
 		log.Println("filePath:", filePath)
-		if err == llm.EmptyResponseError {
+		if errors.Is(err, llm.EmptyResponseError) {
 			log.Println(err)
 			log.Println("skipping file")
 			return BasicFileAnalysisResponse{SKIP: true}, nil
@@ -284,74 +266,90 @@ func AnalyzeFileBasic(filePath string, fileName string) (BasicFileAnalysisRespon
 
 	responseJson.Description = strings.TrimSpace(desc)
 
-	metrics.AddSpeedRecord("AnalyzeFileBasic", start, *ctx)
+	putCachedAnalysis(filePath, fileContent, responseJson)
+
+	metrics.AddSpeedRecord("AnalyzeFileBasic", start, *fileCtx)
 	return responseJson, nil
 }
 
-func AnalyzeDirectory(root string) (string, error) {
+// AnalyzeOptions decides how AnalyzeDirectory deals with previous runs, and with files that fail.
+type AnalyzeOptions struct {
+	Resume    bool // skip files that were already analyzed by a previous (failed or interrupted) run, as recorded in its checkpoint
+	KeepGoing bool // don't stop at files that fail to analyze; list them in ProjectAnalysis.Failures instead
+}
+
+// AnalyzeDirectory analyzes every file under root, and then describes the project as a whole.
+//
+// Each analyzed file is recorded in a checkpoint journal (see Checkpoint) as soon as it's done, so if the analysis fails or
+// ctx is cancelled, it can be resumed later with op.Resume. In that case, the files that were analyzed so far are also returned
+// as a partial analysis (see ProjectAnalysis.Partial), along with the error. The journal is removed once an analysis finishes
+// without any failed files.
+func AnalyzeDirectory(ctx context.Context, root string, op AnalyzeOptions) (ProjectAnalysis, error) {
 	start := time.Now()
-	fileList, err := files.GetProjectFiles(root, files.GetProjectFilesOptions{SkipDotfiles: true})
+	fileList, err := files.GetProjectFiles(root, ProjectFilesOptions)
 	if err != nil {
-		return "", err
+		return ProjectAnalysis{}, err
 	}
 
-	var totalBytesProcessed int64 = 0
-	llmProcessedFileCount := 0
-
-	fileDataList := make([]FileData, 0)
-
 	// get number of LLM processable files, for calculating time estimate
 	llmProcessableFileCount, _, err := GetProcessableFileInfo(fileList)
 	if err != nil {
-		return "", utils.WrapError("error while calculating processable file info;", err)
+		return ProjectAnalysis{}, utils.WrapError("error while calculating processable file info;", err)
 	}
 
-	for i, file := range fileList {
-		// show progress
-		// percentage of files processed
-		percent := float64(i) / float64(len(fileList)) * 100
-
-		// show time estimate
-		utils.Terminal.ClearScreen()
-		if i > 0 {
-			remainingCount := llmProcessableFileCount - i
-			remainingTime := metrics.SpeedRecord("AnalyzeFileBasic").CalculateTimeEstimate(remainingCount)
-			estimateString := ""
-			if remainingTime > 0 {
-				estimateString = fmt.Sprintf("(%.0f%% ~ %s)", percent, remainingTime)
-			}
-			fmt.Printf("Processing: %v/%v %s", i+1, len(fileList), utils.Terminal.LowkeyS(estimateString))
-		} else {
-			fmt.Printf("Processing: %v/%v", i, len(fileList))
-		}
-		utils.Terminal.Lowkey("\n" + file)
+	checkpoint, err := OpenCheckpoint(root, op.Resume)
+	if err != nil {
+		return ProjectAnalysis{}, err
+	}
 
-		filename := filepath.Base(file)
-		fileData := FileData{
-			Filename: filename,
-			FullPath: file,
-		}
+	analysis := ProjectAnalysis{
+		Name:  filepath.Base(root),
+		Root:  root,
+		Files: make([]FileData, 0),
+	}
+	// partial gives what we have so far, for when the analysis stops part way through
+	partial := func(err error) (ProjectAnalysis, error) {
+		checkpoint.Close()
+		analysis.Partial = true
+		analysis.CreatedAt = time.Now()
+		return analysis, err
+	}
 
-		// LLM analysis of file
-		fileAnalysisResponse, err := AnalyzeFileBasic(file, filename)
-		if err != nil {
-			return "", err
+	// LLM analysis of files
+	results, err := analyzeFiles(ctx, fileList, llmProcessableFileCount, checkpoint, op.KeepGoing)
+
+	for i, file := range fileList {
+		result := results[i]
+		if result.err != nil {
+			analysis.Failures = append(analysis.Failures, FileFailure{
+				Path:  displayPath(root, file),
+				Error: result.err.Error(),
+			})
+			continue
 		}
-		if fileAnalysisResponse.SKIP {
+		if !result.done || result.response.SKIP {
 			continue
 		}
 
-		fileData.Type = fileAnalysisResponse.Type
-		fileData.Description = fileAnalysisResponse.Description
-		fileData.SkipLLMProcessing = fileAnalysisResponse.SkipLLMProcessing
-		fileData.SizeBytes = fileAnalysisResponse.SizeBytes
-		fileDataList = append(fileDataList, fileData)
+		fileData := FileData{
+			Filename:          filepath.Base(file),
+			Path:              displayPath(root, file),
+			FullPath:          file,
+			Type:              result.response.Type,
+			Description:       result.response.Description,
+			SkipLLMProcessing: result.response.SkipLLMProcessing,
+			SizeBytes:         result.response.SizeBytes,
+		}
+		analysis.Files = append(analysis.Files, fileData)
 
 		if !fileData.SkipLLMProcessing {
-			llmProcessedFileCount++
-			totalBytesProcessed += fileData.SizeBytes
+			analysis.LLMProcessedFileCount++
+			analysis.LLMProcessedBytes += fileData.SizeBytes
 		}
 	}
+	if err != nil {
+		return partial(err)
+	}
 
 	utils.Terminal.ClearScreen()
 
@@ -363,38 +361,163 @@ func AnalyzeDirectory(root string) (string, error) {
 	//   - file type
 	//   - brief description
 
-	projectMap := ""
-
-	for _, filedata := range fileDataList {
-		if filedata.SkipLLMProcessing {
-			continue
+	projectMap, directorySummaries, err := BuildProjectMap(ctx, root, analysis.Files, ProjectMapBudget{
+		MaxLines:  config.PROJECT_MAP_MAX_LINES,
+		MaxTokens: config.PROJECT_MAP_MAX_TOKENS,
+	})
+	if err != nil {
+		if ctx.Err() != nil {
+			return partial(ctx.Err())
 		}
-		trimmedPath := strings.TrimPrefix(filedata.FullPath, root)
-		trimmedPath = filepath.Join(filepath.Base(root), trimmedPath)
-		projectMap = fmt.Sprintf("%s\n%s (%s) - %s", projectMap, trimmedPath, filedata.Type, filedata.Description)
+		return partial(errors.Join(errors.New("error building project map"), err))
 	}
-
-	projectMap = strings.TrimSpace(projectMap)
+	analysis.ProjectMap = projectMap
+	analysis.Directories = directorySummaries
 
 	// get AI description of entire directory, based on combined file analyses
-	projectDesc, err := DescribeProject(projectMap)
+	projectDesc, err := DescribeProject(ctx, projectMap)
 	if err != nil {
-		return "", errors.Join(errors.New("error generating project description"), err)
+		if ctx.Err() != nil {
+			return partial(ctx.Err())
+		}
+		return partial(errors.Join(errors.New("error generating project description"), err))
 	}
+	analysis.Description = projectDesc
 
-	fmt.Println(projectDesc)
+	// keep the checkpoint if any files failed, so that resuming only retries those
+	if len(analysis.Failures) == 0 {
+		err = checkpoint.Remove()
+	} else {
+		err = checkpoint.Close()
+	}
+	if err != nil {
+		log.Println("failed to clean up analysis checkpoint:", err)
+	}
 
 	metrics.AddSpeedRecord("AnalyzeDirectory", start, metrics.FileContext{})
 
-	return "", nil
+	analysis.CreatedAt = time.Now()
+	return analysis, nil
+}
+
+// fileResult is the outcome of analyzing a single file in analyzeFiles
+type fileResult struct {
+	response BasicFileAnalysisResponse
+	done     bool  // the file was analyzed successfully (now, or in a previous run)
+	err      error // the file failed to analyze (not set for files that were stopped by cancelling)
+}
+
+// analyzeFiles runs AnalyzeFileBasic on every file, using a pool of config.ANALYZE_DIRECTORY_JOBS workers.
+// Results are returned in the same order as fileList, regardless of the order in which they finished.
+//
+// Files that are in the checkpoint (if there is one) are skipped, and files that are analyzed are recorded in it.
+// If any file fails, no new files are started and the first error is returned, unless keepGoing is set; then the failures are
+// only recorded in the results. If ctx is cancelled, no new files are started either, and the context's error is returned once
+// the files in progress have stopped.
+func analyzeFiles(ctx context.Context, fileList []string, llmProcessableFileCount int, checkpoint *Checkpoint, keepGoing bool) ([]fileResult, error) {
+	jobs := max(config.ANALYZE_DIRECTORY_JOBS, 1)
+
+	results := make([]fileResult, len(fileList))
+
+	indexes := make(chan int)
+	finished := make(chan int)
+	stop := make(chan struct{})
+
+	// feed file indexes to the workers until all files are handed out, or we are told to stop
+	go func() {
+		defer close(indexes)
+		for i := range fileList {
+			select {
+			case indexes <- i:
+			case <-stop:
+				return
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for range jobs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				results[i] = analyzeFileWithCheckpoint(ctx, fileList[i], checkpoint)
+				finished <- i
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(finished)
+	}()
+
+	var firstErr error
+	completed := 0
+	for i := range finished {
+		if results[i].err != nil {
+			// files that fail because we were cancelled aren't failures; they just weren't analyzed yet
+			if ctx.Err() != nil {
+				results[i].err = nil
+				continue
+			}
+			if !keepGoing && firstErr == nil {
+				firstErr = results[i].err
+				close(stop)
+			}
+		}
+		completed++
+		showAnalyzeProgress(completed, len(fileList), llmProcessableFileCount, jobs, fileList[i])
+	}
+
+	if firstErr != nil {
+		return results, firstErr
+	}
+	return results, ctx.Err()
+}
+
+// analyzeFileWithCheckpoint gives the result of the file from the checkpoint if it's there; otherwise it analyzes the file and
+// records the result in the checkpoint.
+func analyzeFileWithCheckpoint(ctx context.Context, file string, checkpoint *Checkpoint) fileResult {
+	if checkpoint != nil {
+		if response, found := checkpoint.Lookup(file); found {
+			return fileResult{response: response, done: true}
+		}
+	}
+	response, err := AnalyzeFileBasic(ctx, file, filepath.Base(file))
+	if err != nil {
+		return fileResult{err: err}
+	}
+	if checkpoint != nil {
+		if err := checkpoint.Record(file, response); err != nil {
+			log.Println("failed to write analysis checkpoint:", err)
+		}
+	}
+	return fileResult{response: response, done: true}
+}
+
+func showAnalyzeProgress(completed int, total int, llmProcessableFileCount int, jobs int, lastFile string) {
+	// percentage of files processed
+	percent := float64(completed) / float64(total) * 100
+
+	// show time estimate; with multiple workers, files are processed roughly <jobs> at a time
+	utils.Terminal.ClearScreen()
+	remainingCount := max(llmProcessableFileCount-completed, 0)
+	remainingTime := metrics.SpeedRecord("AnalyzeFileBasic").CalculateTimeEstimate(remainingCount) / time.Duration(jobs)
+	estimateString := ""
+	if remainingTime > 0 {
+		estimateString = fmt.Sprintf("(%.0f%% ~ %s)", percent, remainingTime.Round(time.Second))
+	}
+	fmt.Printf("Processing: %v/%v %s", completed, total, utils.Terminal.LowkeyS(estimateString))
+	utils.Terminal.Lowkey("\n" + lastFile)
 }
 
-func DescribeProject(projectMapString string) (string, error) {
+func DescribeProject(ctx context.Context, projectMapString string) (string, error) {
 	utils.Terminal.Lowkey("project map:")
 	utils.Terminal.Lowkey(projectMapString)
 	var resp DescribeProjectResponse
-	llm.SetModel(llm.Models.DeepSeek)
-	err := llm.GenerateCompletionJson(prompts.P_ANALYZE_FILE_MAP_01, projectMapString, DescribeProjectSchema, &resp)
+	err := llm.GenerateCompletionJsonWithModel(ctx, config.DIRECTORY_SUMMARY_MODEL, prompts.P_ANALYZE_FILE_MAP_01, projectMapString, DescribeProjectSchema, &resp)
 	if err != nil {
 		return "", err
 	}
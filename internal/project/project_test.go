@@ -1,18 +1,59 @@
 package project
 
 import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"os"
+	"path/filepath"
 	"slices"
 	"strings"
 	"testing"
 	"time"
 
+	"github.com/webbben/caius/internal/cache"
+	"github.com/webbben/caius/internal/config"
 	"github.com/webbben/caius/internal/llm"
 	"github.com/webbben/caius/internal/metrics"
+	"github.com/webbben/caius/prompts"
 )
 
+// By default, tests run against a deterministic fake LLM provider so that they don't need a live ollama server.
+// To test the real models, run with CAIUS_LLM_PROVIDER=ollama
+func TestMain(m *testing.M) {
+	provider, err := llm.ProviderByName(os.Getenv("CAIUS_LLM_PROVIDER"), llm.ProviderOptions{
+		OpenAIBaseURL: cmp.Or(os.Getenv("CAIUS_OPENAI_BASE_URL"), config.LLM_OPENAI_BASE_URL),
+		OpenAIAPIKey:  os.Getenv("CAIUS_OPENAI_API_KEY"),
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	if os.Getenv("CAIUS_LLM_PROVIDER") == "" {
+		provider = newFakeProvider()
+	}
+	llm.SetProvider(provider)
+	os.Exit(m.Run())
+}
+
+func newFakeProvider() *llm.FakeProvider {
+	return &llm.FakeProvider{
+		Respond: func(req llm.CompletionRequest, schema json.RawMessage) (string, error) {
+			switch req.SystemPrompt {
+			case prompts.P_ANALYZE_FILE_TYPE_01:
+				return `{"category": "code", "type": "javascript"}`, nil
+			case prompts.P_ANALYZE_FILE_01:
+				return `{"file_type": "javascript", "description": "This file contains javascript code."}`, nil
+			case prompts.P_ANALYZE_FILE_MAP_01:
+				return `{"description": "A javascript project."}`, nil
+			}
+			return "", fmt.Errorf("fake provider: unexpected system prompt: %s", req.SystemPrompt)
+		},
+	}
+}
+
 func resetLog() {
 	os.Remove(".log")
 }
@@ -165,7 +206,7 @@ func TestAnalyzeFileBasic(t *testing.T) {
 		i++
 		writeLog(testCase.CaseName)
 
-		response, err := AnalyzeFileBasic(fmt.Sprintf("tests/analyzeFile/%s", testCase.FileName), testCase.MockFilename)
+		response, err := AnalyzeFileBasic(context.Background(), fmt.Sprintf("tests/analyzeFile/%s", testCase.FileName), testCase.MockFilename)
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "failed to analyze file: %q", err)
 		}
@@ -214,7 +255,7 @@ func TestDescribeProject(t *testing.T) {
 
 		projectMap := loadFileText(fmt.Sprintf("tests/describeProject/%s", testCase.FileName))
 
-		response, err := DescribeProject(projectMap)
+		response, err := DescribeProject(context.Background(), projectMap)
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "failed to describe project: %q", err)
 		}
@@ -255,7 +296,7 @@ func TestDetectFileTypeLLM(t *testing.T) {
 
 		fileData := loadFileText(fmt.Sprintf("tests/analyzeFile/%s", testCase.FileName))
 
-		response, err := DetectFileTypeLLM([]byte(fileData), &metrics.FileContext{})
+		response, err := DetectFileTypeLLM(context.Background(), []byte(fileData), &metrics.FileContext{})
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "failed to detect file type: %q", err)
 		}
@@ -286,3 +327,617 @@ func TestDetectFileTypeLLM(t *testing.T) {
 
 	writeLog(fmt.Sprintf("pass: %v/%v\n", pass, i))
 }
+
+func TestDetectFileTypeFallback(t *testing.T) {
+	if os.Getenv("CAIUS_LLM_PROVIDER") != "" {
+		t.Skip("only runs against the fake provider")
+	}
+	prevProvider := llm.GetProvider()
+	t.Cleanup(func() { llm.SetProvider(prevProvider) })
+
+	// an empty type falls back to the category, and an empty category to no type at all, without asking again
+	for response, expected := range map[string]string{
+		`{"category": "config", "type": ""}`: "config",
+		`{"category": "", "type": ""}`:       "",
+	} {
+		fake := &llm.FakeProvider{
+			Respond: func(req llm.CompletionRequest, schema json.RawMessage) (string, error) {
+				return response, nil
+			},
+		}
+		llm.SetProvider(fake)
+		filetype, err := DetectFileType(context.Background(), "mystery", []byte("some=thing\n"), &metrics.FileContext{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if filetype != expected {
+			t.Errorf("%s: expected file type %q, got %q", response, expected, filetype)
+		}
+		if len(fake.Calls()) != 1 {
+			t.Errorf("%s: expected 1 LLM call, got %v", response, len(fake.Calls()))
+		}
+	}
+}
+
+func TestAnalyzeDirectory(t *testing.T) {
+	if os.Getenv("CAIUS_LLM_PROVIDER") != "" {
+		t.Skip("only runs against the fake provider")
+	}
+	fake := newFakeProvider()
+	prevProvider := llm.GetProvider()
+	llm.SetProvider(fake)
+	t.Cleanup(func() { llm.SetProvider(prevProvider) })
+
+	root := t.TempDir()
+	for _, testCase := range testAnalyzeFileBasicTestCases {
+		content := loadFileText(fmt.Sprintf("tests/analyzeFile/%s", testCase.FileName))
+		err := os.WriteFile(filepath.Join(root, testCase.MockFilename), []byte(content), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	analysis, err := AnalyzeDirectory(context.Background(), root, AnalyzeOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if analysis.Description != "A javascript project." {
+		t.Errorf("unexpected project description: %q", analysis.Description)
+	}
+	if len(analysis.Files) != len(testAnalyzeFileBasicTestCases) {
+		t.Errorf("expected %v files in analysis, got %v", len(testAnalyzeFileBasicTestCases), len(analysis.Files))
+	}
+
+	// one analysis per file, plus the project description
+	expectedCalls := len(testAnalyzeFileBasicTestCases) + 1
+	if len(fake.Calls()) != expectedCalls {
+		t.Errorf("expected %v LLM calls, got %v", expectedCalls, len(fake.Calls()))
+	}
+}
+
+func TestAnalyzeFileBasicCache(t *testing.T) {
+	if os.Getenv("CAIUS_LLM_PROVIDER") != "" {
+		t.Skip("only runs against the fake provider")
+	}
+	fake := newFakeProvider()
+	prevProvider := llm.GetProvider()
+	llm.SetProvider(fake)
+	t.Cleanup(func() { llm.SetProvider(prevProvider) })
+
+	root := t.TempDir()
+	c, err := cache.Open(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	SetAnalysisCache(c)
+	t.Cleanup(func() { SetAnalysisCache(nil) })
+
+	path := filepath.Join(root, "login.js")
+	err = os.WriteFile(path, []byte(loadFileText("tests/analyzeFile/javascript01.txt")), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	first, err := AnalyzeFileBasic(context.Background(), path, "login.js")
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := AnalyzeFileBasic(context.Background(), path, "login.js")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fake.Calls()) != 1 {
+		t.Errorf("expected the second analysis to come from the cache, but got %v LLM calls", len(fake.Calls()))
+	}
+	if first != second {
+		t.Errorf("cached response differs: %+v vs %+v", first, second)
+	}
+
+	// the same file in another directory gets its own entry, with its own path
+	otherPath := filepath.Join(root, "old", "login.js")
+	if err := os.MkdirAll(filepath.Dir(otherPath), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(otherPath, []byte(loadFileText("tests/analyzeFile/javascript01.txt")), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := AnalyzeFileBasic(context.Background(), otherPath, "login.js"); err != nil {
+		t.Fatal(err)
+	}
+	if len(fake.Calls()) != 2 {
+		t.Errorf("expected a file with the same name and content in another directory not to share a cache entry, got %v LLM calls", len(fake.Calls()))
+	}
+	if err := os.Remove(otherPath); err != nil {
+		t.Fatal(err)
+	}
+	if removed, err := c.Prune(func(entry cache.Entry) bool { return IsCacheEntryStale(c, entry) }); err != nil || removed != 1 {
+		t.Errorf("expected the deleted file's entry to be pruned, got %v removed (err %v)", removed, err)
+	}
+
+	// changing the file should invalidate its cache entry
+	err = os.WriteFile(path, []byte("console.log('changed')"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries, _ := c.List()
+	if len(entries) != 1 || !IsCacheEntryStale(c, entries[0]) {
+		t.Errorf("expected the cache entry to be stale after the file changed")
+	}
+}
+
+func TestAnalyzeFilesParallel(t *testing.T) {
+	if os.Getenv("CAIUS_LLM_PROVIDER") != "" {
+		t.Skip("only runs against the fake provider")
+	}
+	prevProvider := llm.GetProvider()
+	// describe each file by its name, so we can check the results come back in the right order
+	llm.SetProvider(&llm.FakeProvider{
+		Respond: func(req llm.CompletionRequest, schema json.RawMessage) (string, error) {
+			header, _, _ := strings.Cut(req.Prompt, "\n")
+			name := strings.TrimPrefix(header, "File name: ")
+			return fmt.Sprintf(`{"file_type": "go", "description": "%s"}`, name), nil
+		},
+	})
+	prevJobs := config.ANALYZE_DIRECTORY_JOBS
+	config.ANALYZE_DIRECTORY_JOBS = 4
+	t.Cleanup(func() {
+		llm.SetProvider(prevProvider)
+		config.ANALYZE_DIRECTORY_JOBS = prevJobs
+	})
+
+	root := t.TempDir()
+	fileList := []string{}
+	for i := range 20 {
+		path := filepath.Join(root, fmt.Sprintf("file%02d.go", i))
+		err := os.WriteFile(path, []byte("package main\n"), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fileList = append(fileList, path)
+	}
+
+	results, err := analyzeFiles(context.Background(), fileList, len(fileList), nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, result := range results {
+		expected := filepath.Base(fileList[i])
+		if !result.done || result.response.Description != expected {
+			t.Errorf("result %v: expected description %q, got %q", i, expected, result.response.Description)
+		}
+	}
+}
+
+func TestAnalyzeDirectoryResume(t *testing.T) {
+	if os.Getenv("CAIUS_LLM_PROVIDER") != "" {
+		t.Skip("only runs against the fake provider")
+	}
+	// file03.go fails to analyze until it's fixed
+	broken := true
+	calls := []string{}
+	prevProvider := llm.GetProvider()
+	llm.SetProvider(&llm.FakeProvider{
+		Respond: func(req llm.CompletionRequest, schema json.RawMessage) (string, error) {
+			header, _, _ := strings.Cut(req.Prompt, "\n")
+			name := strings.TrimPrefix(header, "File name: ")
+			calls = append(calls, name)
+			if name == "file03.go" && broken {
+				return "", errors.New("model crashed")
+			}
+			return `{"file_type": "go", "description": "a go file"}`, nil
+		},
+	})
+	prevJobs := config.ANALYZE_DIRECTORY_JOBS
+	config.ANALYZE_DIRECTORY_JOBS = 1
+	prevPolicy := llm.GetRetryPolicy()
+	llm.SetRetryPolicy(llm.RetryPolicy{MaxAttempts: 1})
+	t.Cleanup(func() {
+		llm.SetProvider(prevProvider)
+		config.ANALYZE_DIRECTORY_JOBS = prevJobs
+		llm.SetRetryPolicy(prevPolicy)
+	})
+
+	root := t.TempDir()
+	for i := range 6 {
+		err := os.WriteFile(filepath.Join(root, fmt.Sprintf("file%02d.go", i)), []byte(fmt.Sprintf("package main // %v\n", i)), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// stops at the broken file, but keeps what was done before it
+	analysis, err := AnalyzeDirectory(context.Background(), root, AnalyzeOptions{})
+	if err == nil {
+		t.Fatal("expected an error from the broken file")
+	}
+	// a file that was already handed out when the error came back may still finish
+	analyzed := len(analysis.Files)
+	if !analysis.Partial || analyzed < 3 || analyzed > 4 {
+		t.Errorf("expected a partial analysis with the files before the broken one, got partial=%v with %v files", analysis.Partial, analyzed)
+	}
+
+	// keeps going past the broken file when asked to, without redoing the files that were already done
+	calls = nil
+	analysis, err = AnalyzeDirectory(context.Background(), root, AnalyzeOptions{Resume: true, KeepGoing: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the remaining files (starting with the broken one), plus the project description
+	if len(calls) != 6-analyzed+1 || calls[0] != "file03.go" || slices.Contains(calls, "file00.go") {
+		t.Errorf("expected only the remaining files to be analyzed, got %v", calls)
+	}
+	if len(analysis.Failures) != 1 || !strings.HasSuffix(analysis.Failures[0].Path, "file03.go") {
+		t.Errorf("expected file03.go to be reported as failed, got %+v", analysis.Failures)
+	}
+	if len(analysis.Files) != 5 || analysis.Partial {
+		t.Errorf("expected a complete analysis of the other 5 files, got partial=%v with %v files", analysis.Partial, len(analysis.Files))
+	}
+	if _, err := os.Stat(CheckpointPath(root)); err != nil {
+		t.Errorf("expected the checkpoint to be kept while there are failed files; %v", err)
+	}
+
+	// resuming again only retries the failed file, and cleans up the checkpoint once everything is done
+	broken = false
+	calls = nil
+	analysis, err = AnalyzeDirectory(context.Background(), root, AnalyzeOptions{Resume: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(calls) != 2 || calls[0] != "file03.go" {
+		t.Errorf("expected only file03.go and the project description to be generated, got %v", calls)
+	}
+	if len(analysis.Files) != 6 || len(analysis.Failures) != 0 {
+		t.Errorf("expected all 6 files without failures, got %v files and %+v", len(analysis.Files), analysis.Failures)
+	}
+	if _, err := os.Stat(CheckpointPath(root)); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected the checkpoint to be removed after a complete analysis; %v", err)
+	}
+
+	// without resume, everything is analyzed again
+	calls = nil
+	if _, err := AnalyzeDirectory(context.Background(), root, AnalyzeOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if len(calls) != 7 {
+		t.Errorf("expected all 6 files and the project description to be generated, got %v", calls)
+	}
+}
+
+func TestAnalyzeDirectoryCancel(t *testing.T) {
+	if os.Getenv("CAIUS_LLM_PROVIDER") != "" {
+		t.Skip("only runs against the fake provider")
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// cancel (like Ctrl-C would) while the third file is being analyzed
+	calls := 0
+	prevProvider := llm.GetProvider()
+	llm.SetProvider(&llm.FakeProvider{
+		Respond: func(req llm.CompletionRequest, schema json.RawMessage) (string, error) {
+			calls++
+			if calls == 3 {
+				cancel()
+				return "", context.Canceled
+			}
+			if schema != nil && strings.Contains(string(schema), "file_type") {
+				return `{"file_type": "go", "description": "a go file"}`, nil
+			}
+			return `{"description": "a go project"}`, nil
+		},
+	})
+	prevJobs := config.ANALYZE_DIRECTORY_JOBS
+	config.ANALYZE_DIRECTORY_JOBS = 1
+	t.Cleanup(func() {
+		llm.SetProvider(prevProvider)
+		config.ANALYZE_DIRECTORY_JOBS = prevJobs
+	})
+
+	root := t.TempDir()
+	for i := range 10 {
+		err := os.WriteFile(filepath.Join(root, fmt.Sprintf("file%02d.go", i)), []byte("package main\n"), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	analysis, err := AnalyzeDirectory(ctx, root, AnalyzeOptions{})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected a context.Canceled error, got %v", err)
+	}
+	if !analysis.Partial {
+		t.Errorf("expected the analysis to be marked as partial")
+	}
+	if len(analysis.Files) != 2 || analysis.Files[0].Filename != "file00.go" || analysis.Files[1].Filename != "file01.go" {
+		t.Errorf("expected the two files analyzed before cancelling, got %+v", analysis.Files)
+	}
+	if analysis.Description != "" {
+		t.Errorf("expected no project description, got %q", analysis.Description)
+	}
+	if calls != 3 {
+		t.Errorf("expected no more LLM calls after cancelling, got %v", calls)
+	}
+
+	// resuming picks up where it left off
+	ctx = context.Background()
+	analysis, err = AnalyzeDirectory(ctx, root, AnalyzeOptions{Resume: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(analysis.Files) != 10 || analysis.Partial {
+		t.Errorf("expected a complete analysis of 10 files, got partial=%v with %v files", analysis.Partial, len(analysis.Files))
+	}
+	// 8 remaining files, plus the project description
+	if calls != 3+8+1 {
+		t.Errorf("expected 9 more LLM calls after resuming, got %v", calls-3)
+	}
+}
+
+func TestBuildProjectMap(t *testing.T) {
+	fake := &llm.FakeProvider{
+		Respond: func(req llm.CompletionRequest, schema json.RawMessage) (string, error) {
+			return `{"description": "a directory of go code."}`, nil
+		},
+	}
+	prevProvider := llm.GetProvider()
+	llm.SetProvider(fake)
+	t.Cleanup(func() { llm.SetProvider(prevProvider) })
+
+	root := "/project"
+	fileDataList := []FileData{}
+	for _, path := range []string{"main.go", "cmd/root.go", "internal/a/a.go", "internal/a/a_util.go", "internal/b/b.go", "internal/b/deep/c.go", "internal/b/deep/d.go"} {
+		fileDataList = append(fileDataList, FileData{
+			Filename:    filepath.Base(path),
+			FullPath:    filepath.Join(root, path),
+			Type:        "golang code",
+			Description: "some go code",
+		})
+	}
+
+	// everything fits; no summaries needed
+	projectMap, summaries, err := BuildProjectMap(context.Background(), root, fileDataList, ProjectMapBudget{MaxLines: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(summaries) != 0 || len(strings.Split(projectMap, "\n")) != len(fileDataList) {
+		t.Errorf("expected the full file list without summaries, got:\n%s", projectMap)
+	}
+	if len(fake.Calls()) != 0 {
+		t.Errorf("expected no LLM calls, got %v", len(fake.Calls()))
+	}
+
+	// too many lines; directories should be compressed
+	projectMap, summaries, err = BuildProjectMap(context.Background(), root, fileDataList, ProjectMapBudget{MaxLines: 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(projectMap, "\n")
+	if len(lines) > 4 {
+		t.Errorf("project map exceeds budget:\n%s", projectMap)
+	}
+	if !strings.HasPrefix(lines[0], "project/main.go") {
+		t.Errorf("expected root files to always be listed first, got:\n%s", projectMap)
+	}
+	// cmd, internal, internal/a, internal/b, internal/b/deep
+	if len(summaries) != 5 {
+		t.Errorf("expected 5 directory summaries, got %+v", summaries)
+	}
+	// cmd only has a single file, so it doesn't need the LLM
+	if len(fake.Calls()) != 4 {
+		t.Errorf("expected 4 LLM calls, got %v", len(fake.Calls()))
+	}
+	for _, summary := range summaries {
+		if summary.Path == "project/internal" && summary.FileCount != 5 {
+			t.Errorf("expected internal to contain 5 files, got %v", summary.FileCount)
+		}
+	}
+}
+
+func TestBuildProjectMapFlatRoot(t *testing.T) {
+	fake := &llm.FakeProvider{
+		Respond: func(req llm.CompletionRequest, schema json.RawMessage) (string, error) {
+			return `{"description": "a directory of scripts."}`, nil
+		},
+	}
+	prevProvider := llm.GetProvider()
+	llm.SetProvider(fake)
+	t.Cleanup(func() { llm.SetProvider(prevProvider) })
+
+	// most files are in the root, so compressing subdirectories can't make the map fit
+	root := "/project"
+	fileDataList := []FileData{}
+	for i := range 50 {
+		fileDataList = append(fileDataList, FileData{FullPath: filepath.Join(root, fmt.Sprintf("script_%02d.sh", i)), Type: "shell script", Description: "a script"})
+	}
+	for _, path := range []string{"lib/a.sh", "lib/b.sh"} {
+		fileDataList = append(fileDataList, FileData{FullPath: filepath.Join(root, path), Type: "shell script", Description: "a library"})
+	}
+
+	projectMap, _, err := BuildProjectMap(context.Background(), root, fileDataList, ProjectMapBudget{MaxLines: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(projectMap, "\n")
+	if len(lines) != 10 {
+		t.Errorf("expected the project map to fill the budget of 10 lines, got:\n%s", projectMap)
+	}
+	if lines[8] != "(42 more files)" || !strings.HasPrefix(lines[9], "project/lib/ (directory, 2 files)") {
+		t.Errorf("expected 8 root files, a count of the rest, and the lib summary, got:\n%s", projectMap)
+	}
+
+	budget := ProjectMapBudget{MaxTokens: 100}
+	projectMap, _, err = BuildProjectMap(context.Background(), root, fileDataList, budget)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tokens := llm.EstimateTokens(projectMap); tokens > budget.MaxTokens {
+		t.Errorf("expected at most %v tokens, got %v:\n%s", budget.MaxTokens, tokens, projectMap)
+	}
+	if !strings.Contains(projectMap, "more files)") {
+		t.Errorf("expected the rest of the root files to be counted, got:\n%s", projectMap)
+	}
+
+	// too small for even the directory summaries
+	projectMap, _, err = BuildProjectMap(context.Background(), root, fileDataList, ProjectMapBudget{MaxLines: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if projectMap != "(2 more lines)" {
+		t.Errorf("expected the map to be cut off, got:\n%s", projectMap)
+	}
+}
+
+func TestProjectAnalysisFormat(t *testing.T) {
+	analysis := ProjectAnalysis{
+		Name:        "todoApp",
+		Description: "A react todo list app.",
+		Files: []FileData{
+			{Filename: "App.js", Path: "todoApp/src/App.js", Type: "javascript code", Description: "The main component."},
+			{Filename: "index.html", Path: "todoApp/public/index.html", Type: "HTML", Description: "The main page."},
+		},
+		Directories: []DirectorySummary{
+			{Path: "todoApp/src", Description: "React | components", FileCount: 1},
+		},
+	}
+
+	out, err := analysis.Format("json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded ProjectAnalysis
+	if err := json.Unmarshal(out, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Description != analysis.Description || len(decoded.Files) != 2 || decoded.Files[0].Path != "todoApp/src/App.js" {
+		t.Errorf("json round trip lost data: %+v", decoded)
+	}
+
+	out, err = analysis.Format("yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(out), "path: todoApp/src/App.js") {
+		t.Errorf("unexpected yaml output:\n%s", out)
+	}
+
+	out, err = analysis.Format("markdown")
+	if err != nil {
+		t.Fatal(err)
+	}
+	md := string(out)
+	for _, expected := range []string{"# todoApp", "### `todoApp/public/`", "- `App.js` (javascript code) - The main component.", "React \\| components"} {
+		if !strings.Contains(md, expected) {
+			t.Errorf("markdown output is missing %q:\n%s", expected, md)
+		}
+	}
+
+	if _, err := analysis.Format("xml"); err == nil {
+		t.Error("expected an error for an unknown format")
+	}
+}
+
+func TestAnalyzeFileBasicChunked(t *testing.T) {
+	if os.Getenv("CAIUS_LLM_PROVIDER") != "" {
+		t.Skip("only runs against the fake provider")
+	}
+	fake := &llm.FakeProvider{
+		Respond: func(req llm.CompletionRequest, schema json.RawMessage) (string, error) {
+			switch req.SystemPrompt {
+			case prompts.P_ANALYZE_FILE_CHUNK_01:
+				return `{"description": "some functions."}`, nil
+			case prompts.P_ANALYZE_FILE_CHUNKS_01:
+				return `{"file_type": "javascript", "description": "This file contains a large javascript module."}`, nil
+			}
+			return "", fmt.Errorf("fake provider: unexpected system prompt: %s", req.SystemPrompt)
+		},
+	}
+	prevProvider := llm.GetProvider()
+	llm.SetProvider(fake)
+	prevWindow, hadWindow := llm.ModelContextWindows[config.BASIC_FILE_ANALYSIS_MODEL]
+	llm.ModelContextWindows[config.BASIC_FILE_ANALYSIS_MODEL] = 1500
+	t.Cleanup(func() {
+		llm.SetProvider(prevProvider)
+		if hadWindow {
+			llm.ModelContextWindows[config.BASIC_FILE_ANALYSIS_MODEL] = prevWindow
+		} else {
+			delete(llm.ModelContextWindows, config.BASIC_FILE_ANALYSIS_MODEL)
+		}
+	})
+
+	// ~8KB of javascript functions; too big for the context window set above
+	var sb strings.Builder
+	for i := range 60 {
+		fmt.Fprintf(&sb, "function handler%v(event) {\n\tconsole.log('handling event', event.type);\n\treturn event.target;\n}\n\n", i)
+	}
+	path := filepath.Join(t.TempDir(), "handlers.js")
+	if err := os.WriteFile(path, []byte(sb.String()), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	response, err := AnalyzeFileBasic(context.Background(), path, "handlers.js")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.Description != "a large javascript module." {
+		t.Errorf("unexpected description: %q", response.Description)
+	}
+
+	calls := fake.Calls()
+	if len(calls) < 3 {
+		t.Fatalf("expected the file to be split into multiple chunks, got %v LLM calls", len(calls))
+	}
+	for _, call := range calls[:len(calls)-1] {
+		if call.SystemPrompt != prompts.P_ANALYZE_FILE_CHUNK_01 {
+			t.Errorf("expected chunk summaries before the final analysis")
+		}
+	}
+	if calls[len(calls)-1].SystemPrompt != prompts.P_ANALYZE_FILE_CHUNKS_01 {
+		t.Errorf("expected the final call to combine the chunk summaries")
+	}
+}
+
+func TestSaveLoadAnalysis(t *testing.T) {
+	root := t.TempDir()
+	if _, err := LoadAnalysis(root); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("expected ErrNotExist before saving, got %v", err)
+	}
+
+	analysis := ProjectAnalysis{
+		Name:        "app",
+		Root:        root,
+		Description: "A web app.",
+		Files:       []FileData{{Filename: "main.go", Path: "app/main.go", Type: "go"}},
+	}
+	if err := SaveAnalysis(root, analysis); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadAnalysis(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Description != analysis.Description || len(loaded.Files) != 1 || loaded.Files[0].Path != "app/main.go" {
+		t.Errorf("loaded analysis doesn't match saved one: %+v", loaded)
+	}
+
+	// a partial analysis doesn't replace the complete one, and is removed by the next complete one
+	partial := ProjectAnalysis{Name: "app", Root: root, Partial: true}
+	if err := SaveAnalysis(root, partial); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err = LoadAnalysis(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Partial || loaded.Description != analysis.Description {
+		t.Errorf("expected the complete analysis to be kept, got %+v", loaded)
+	}
+	if _, err := os.Stat(PartialAnalysisPath(root)); err != nil {
+		t.Errorf("expected the partial analysis to be saved; %v", err)
+	}
+	if err := SaveAnalysis(root, analysis); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(PartialAnalysisPath(root)); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected the partial analysis to be removed, got %v", err)
+	}
+}
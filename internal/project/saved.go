@@ -0,0 +1,66 @@
+package project
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+)
+
+// AnalysisPath gives the path the analysis of a project is saved to, so that other commands (e.g. ask) can use it later
+func AnalysisPath(root string) string {
+	return filepath.Join(root, ".caius", "analysis.json")
+}
+
+// PartialAnalysisPath gives the path a partial analysis (see ProjectAnalysis.Partial) is saved to.
+// It's kept apart from AnalysisPath, so that a failed or interrupted run doesn't replace the last complete analysis.
+func PartialAnalysisPath(root string) string {
+	return filepath.Join(root, ".caius", "analysis.partial.json")
+}
+
+// SaveAnalysis saves the analysis of a project into the project's .caius directory.
+// Partial analyses are saved to PartialAnalysisPath; once a complete analysis is saved, the partial one is removed.
+func SaveAnalysis(root string, analysis ProjectAnalysis) error {
+	path := AnalysisPath(root)
+	if analysis.Partial {
+		path = PartialAnalysisPath(root)
+	}
+	err := os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		return errors.Join(errors.New("SaveAnalysis: failed to create .caius directory;"), err)
+	}
+	b, err := json.MarshalIndent(analysis, "", "  ")
+	if err != nil {
+		return errors.Join(errors.New("SaveAnalysis: failed to marshal analysis;"), err)
+	}
+	// write to a temp file first, so that an interrupted write doesn't leave a broken analysis behind
+	tmp := path + ".tmp"
+	err = os.WriteFile(tmp, b, 0644)
+	if err != nil {
+		return errors.Join(errors.New("SaveAnalysis: failed to write analysis;"), err)
+	}
+	err = os.Rename(tmp, path)
+	if err != nil || analysis.Partial {
+		return err
+	}
+	err = os.Remove(PartialAnalysisPath(root))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// LoadAnalysis loads the last complete analysis of a project. If the project hasn't been analyzed yet, the error wraps os.ErrNotExist.
+// Analyses saved by older versions may still be partial, so callers should check Partial.
+func LoadAnalysis(root string) (ProjectAnalysis, error) {
+	var analysis ProjectAnalysis
+	b, err := os.ReadFile(AnalysisPath(root))
+	if err != nil {
+		return analysis, err
+	}
+	err = json.Unmarshal(b, &analysis)
+	if err != nil {
+		return analysis, errors.Join(errors.New("LoadAnalysis: failed to parse saved analysis;"), err)
+	}
+	return analysis, nil
+}
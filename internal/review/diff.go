@@ -0,0 +1,443 @@
+package review
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/webbben/caius/internal/config"
+	"github.com/webbben/caius/internal/files"
+	"github.com/webbben/caius/internal/metrics"
+	"github.com/webbben/caius/internal/project"
+	"github.com/webbben/caius/internal/utils"
+	"github.com/webbben/caius/prompts"
+)
+
+// DiffOptions selects which changes to review.
+type DiffOptions struct {
+	Base   string // if set, review the changes of HEAD since it branched off from Base (git diff Base...HEAD)
+	Staged bool   // review only the staged changes (git diff --cached)
+	// otherwise, all uncommitted changes in the working tree are reviewed (git diff HEAD), including untracked files
+	// that aren't ignored
+}
+
+// the hash of git's empty tree, which the working tree is compared with when there are no commits yet
+const emptyTree = "4b825dc642cb6eb9a060e54bf8d69288fbee4904"
+
+// DiffLine is a single line of a diff hunk.
+type DiffLine struct {
+	Kind    byte // ' ' for context, '+' for added, '-' for removed
+	Text    string
+	OldLine int // line number in the old file; 0 for added lines
+	NewLine int // line number in the new file; 0 for removed lines
+}
+
+// Hunk is a single section of changes to a file.
+type Hunk struct {
+	OldStart int
+	OldLines int
+	NewStart int
+	NewLines int
+	Header   string // text after the @@ line ranges, usually the enclosing function
+	Lines    []DiffLine
+}
+
+// NewRange gives the first and last line of the hunk in the new file.
+// For hunks that only remove lines, this is the line just before the removal (at least 1).
+func (h Hunk) NewRange() (int, int) {
+	if h.NewLines == 0 {
+		return max(h.NewStart, 1), max(h.NewStart, 1)
+	}
+	return h.NewStart, h.NewStart + h.NewLines - 1
+}
+
+// FileDiff is the diff of a single file.
+type FileDiff struct {
+	OldPath string // empty for new files
+	NewPath string // empty for deleted files
+	Binary  bool
+	Hunks   []Hunk
+}
+
+func (f FileDiff) Deleted() bool {
+	return f.NewPath == ""
+}
+
+// gitDiffArgs gives the arguments for the git diff command matching the options.
+// hasHead is false in a repository without any commits yet.
+func gitDiffArgs(op DiffOptions, hasHead bool) []string {
+	args := []string{"diff", "--no-color", "--no-ext-diff", "--no-renames", "-U3"}
+	switch {
+	case op.Base != "":
+		args = append(args, op.Base+"...HEAD")
+	case op.Staged:
+		args = append(args, "--cached")
+	case !hasHead:
+		args = append(args, emptyTree)
+	default:
+		args = append(args, "HEAD")
+	}
+	return args
+}
+
+func runGit(dir string, args ...string) ([]byte, error) {
+	cmd := exec.Command("git", append([]string{"-C", dir}, args...)...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("git %s: %w: %s", strings.Join(args, " "), err, strings.TrimSpace(stderr.String()))
+	}
+	return out, nil
+}
+
+// GitRoot gives the root directory of the git repository that dir is in.
+func GitRoot(dir string) (string, error) {
+	out, err := runGit(dir, "rev-parse", "--show-toplevel")
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// GitDiff runs git diff in the given repository, and returns the parsed diff.
+// When reviewing all uncommitted changes, untracked files that aren't ignored are included as new files.
+func GitDiff(repoDir string, op DiffOptions) ([]FileDiff, error) {
+	_, err := runGit(repoDir, "rev-parse", "--verify", "--quiet", "HEAD")
+	hasHead := err == nil
+
+	out, err := runGit(repoDir, gitDiffArgs(op, hasHead)...)
+	if err != nil {
+		return nil, err
+	}
+	fileDiffs, err := ParseDiff(string(out))
+	if err != nil || op.Base != "" || op.Staged {
+		return fileDiffs, err
+	}
+
+	untracked, err := untrackedFileDiffs(repoDir)
+	if err != nil {
+		return nil, err
+	}
+	return append(fileDiffs, untracked...), nil
+}
+
+// untrackedFileDiffs gives the diffs of the untracked files in the working tree (except ignored ones), which git diff leaves out
+func untrackedFileDiffs(repoDir string) ([]FileDiff, error) {
+	out, err := runGit(repoDir, "ls-files", "--others", "--exclude-standard", "-z")
+	if err != nil {
+		return nil, err
+	}
+	fileDiffs := []FileDiff{}
+	for _, path := range strings.Split(string(out), "\x00") {
+		if path == "" {
+			continue
+		}
+		content, err := os.ReadFile(filepath.Join(repoDir, path))
+		if err != nil {
+			return nil, err
+		}
+		fileDiffs = append(fileDiffs, newFileDiff(path, content))
+	}
+	return fileDiffs, nil
+}
+
+// newFileDiff gives the diff of a new file: a single hunk that adds all of its lines
+func newFileDiff(path string, content []byte) FileDiff {
+	fileDiff := FileDiff{NewPath: path}
+	if files.IsProbablyBinaryData(content) {
+		fileDiff.Binary = true
+		return fileDiff
+	}
+	if len(content) == 0 {
+		return fileDiff
+	}
+	lines := strings.Split(strings.TrimSuffix(string(content), "\n"), "\n")
+	hunk := Hunk{OldStart: 0, OldLines: 0, NewStart: 1, NewLines: len(lines)}
+	for i, line := range lines {
+		hunk.Lines = append(hunk.Lines, DiffLine{Kind: '+', Text: line, NewLine: i + 1})
+	}
+	fileDiff.Hunks = []Hunk{hunk}
+	return fileDiff
+}
+
+// newFileContent gets the content of a file on the "new" side of the diff
+func newFileContent(repoDir string, path string, op DiffOptions) ([]byte, error) {
+	switch {
+	case op.Base != "":
+		return runGit(repoDir, "show", "HEAD:"+path)
+	case op.Staged:
+		return runGit(repoDir, "show", ":"+path)
+	}
+	return os.ReadFile(filepath.Join(repoDir, path))
+}
+
+// unquotePath handles the quoting git does for paths with special characters, and strips the a/ or b/ prefix
+func unquotePath(path string) string {
+	path = strings.TrimSpace(path)
+	if strings.HasPrefix(path, `"`) {
+		if unquoted, err := strconv.Unquote(path); err == nil {
+			path = unquoted
+		}
+	}
+	if path == "/dev/null" {
+		return ""
+	}
+	if strings.HasPrefix(path, "a/") || strings.HasPrefix(path, "b/") {
+		return path[2:]
+	}
+	return path
+}
+
+// parseRange parses a hunk range like "12,3" or "12"
+func parseRange(s string) (int, int, error) {
+	start, count, found := strings.Cut(s, ",")
+	startN, err := strconv.Atoi(start)
+	if err != nil {
+		return 0, 0, err
+	}
+	countN := 1
+	if found {
+		countN, err = strconv.Atoi(count)
+		if err != nil {
+			return 0, 0, err
+		}
+	}
+	return startN, countN, nil
+}
+
+// parseHunkHeader parses a line like "@@ -12,3 +12,4 @@ func main() {"
+func parseHunkHeader(line string) (Hunk, error) {
+	parts := strings.SplitN(line, "@@", 3)
+	if len(parts) < 3 {
+		return Hunk{}, fmt.Errorf("invalid hunk header: %q", line)
+	}
+	ranges := strings.Fields(parts[1])
+	if len(ranges) != 2 || !strings.HasPrefix(ranges[0], "-") || !strings.HasPrefix(ranges[1], "+") {
+		return Hunk{}, fmt.Errorf("invalid hunk header: %q", line)
+	}
+	oldStart, oldLines, err := parseRange(ranges[0][1:])
+	if err != nil {
+		return Hunk{}, fmt.Errorf("invalid hunk header: %q", line)
+	}
+	newStart, newLines, err := parseRange(ranges[1][1:])
+	if err != nil {
+		return Hunk{}, fmt.Errorf("invalid hunk header: %q", line)
+	}
+	return Hunk{
+		OldStart: oldStart,
+		OldLines: oldLines,
+		NewStart: newStart,
+		NewLines: newLines,
+		Header:   strings.TrimSpace(parts[2]),
+	}, nil
+}
+
+// ParseDiff parses the output of git diff (unified format) into its files and hunks.
+func ParseDiff(diff string) ([]FileDiff, error) {
+	fileDiffs := []FileDiff{}
+	var current *FileDiff
+	var hunk *Hunk
+	oldLine, newLine := 0, 0
+	oldLeft, newLeft := 0, 0 // lines left to read in the current hunk
+
+	finishHunk := func() {
+		if hunk != nil && current != nil {
+			current.Hunks = append(current.Hunks, *hunk)
+		}
+		hunk = nil
+	}
+	finishFile := func() {
+		finishHunk()
+		if current != nil {
+			fileDiffs = append(fileDiffs, *current)
+		}
+		current = nil
+	}
+
+	for _, line := range strings.Split(diff, "\n") {
+		// lines of a hunk
+		if hunk != nil && (oldLeft > 0 || newLeft > 0) {
+			if line == "" {
+				// some tools strip the trailing space of empty context lines
+				line = " "
+			}
+			kind := line[0]
+			text := line[1:]
+			switch kind {
+			case ' ':
+				oldLine++
+				newLine++
+				oldLeft--
+				newLeft--
+				hunk.Lines = append(hunk.Lines, DiffLine{Kind: kind, Text: text, OldLine: oldLine, NewLine: newLine})
+			case '-':
+				oldLine++
+				oldLeft--
+				hunk.Lines = append(hunk.Lines, DiffLine{Kind: kind, Text: text, OldLine: oldLine})
+			case '+':
+				newLine++
+				newLeft--
+				hunk.Lines = append(hunk.Lines, DiffLine{Kind: kind, Text: text, NewLine: newLine})
+			case '\\':
+				// "\ No newline at end of file"
+			default:
+				return nil, fmt.Errorf("unexpected line in hunk: %q", line)
+			}
+			continue
+		}
+		if strings.HasPrefix(line, `\`) {
+			continue
+		}
+
+		switch {
+		case strings.HasPrefix(line, "diff --git "):
+			finishFile()
+			current = &FileDiff{}
+			// paths from the diff line are only a fallback, for diffs without ---/+++ lines (e.g. binary files)
+			paths := strings.TrimPrefix(line, "diff --git ")
+			if i := strings.Index(paths, " b/"); i != -1 {
+				current.OldPath = unquotePath(paths[:i])
+				current.NewPath = unquotePath(paths[i+1:])
+			}
+		case current == nil:
+			// anything before the first file diff isn't part of the diff
+		case strings.HasPrefix(line, "new file mode"):
+			current.OldPath = ""
+		case strings.HasPrefix(line, "deleted file mode"):
+			current.NewPath = ""
+		case strings.HasPrefix(line, "Binary files "):
+			current.Binary = true
+		case strings.HasPrefix(line, "--- "):
+			current.OldPath = unquotePath(strings.TrimPrefix(line, "--- "))
+		case strings.HasPrefix(line, "+++ "):
+			current.NewPath = unquotePath(strings.TrimPrefix(line, "+++ "))
+		case strings.HasPrefix(line, "@@ "):
+			finishHunk()
+			h, err := parseHunkHeader(line)
+			if err != nil {
+				return nil, err
+			}
+			hunk = &h
+			oldLine, newLine = h.OldStart-1, h.NewStart-1
+			oldLeft, newLeft = h.OldLines, h.NewLines
+		}
+	}
+	finishFile()
+
+	if len(fileDiffs) == 0 && strings.TrimSpace(diff) != "" {
+		return nil, errors.New("no file diffs found in diff output")
+	}
+	return fileDiffs, nil
+}
+
+// renderHunk shows a hunk the way the LLM sees it: every line of the new file is prefixed with its line number,
+// and changed lines are marked with + or -. Unchanged lines around the hunk are added from the new file for context.
+func renderHunk(h Hunk, newLines []string, contextLines int) string {
+	var sb strings.Builder
+	writeContext := func(from int, to int) {
+		for n := max(from, 1); n <= min(to, len(newLines)); n++ {
+			fmt.Fprintf(&sb, "%4d |   %s\n", n, newLines[n-1])
+		}
+	}
+
+	first, last := h.NewRange()
+	if h.NewLines == 0 {
+		// nothing left of the hunk in the new file; show the lines around where it was
+		writeContext(first-contextLines, first)
+		last = first
+	} else {
+		writeContext(first-contextLines, first-1)
+	}
+	for _, line := range h.Lines {
+		switch line.Kind {
+		case '+':
+			fmt.Fprintf(&sb, "%4d | + %s\n", line.NewLine, line.Text)
+		case '-':
+			fmt.Fprintf(&sb, "     | - %s\n", line.Text)
+		default:
+			fmt.Fprintf(&sb, "%4d |   %s\n", line.NewLine, line.Text)
+		}
+	}
+	writeContext(last+1, last+contextLines)
+	return sb.String()
+}
+
+// ReviewDiff has the LLM review the changes in a git repository, hunk by hunk.
+// Findings are given with their line numbers in the new version of each file; deleted and binary files are skipped.
+func ReviewDiff(ctx context.Context, repoDir string, op DiffOptions, focus string) ([]FileReview, error) {
+	root, err := GitRoot(repoDir)
+	if err != nil {
+		return nil, utils.WrapError("review: not a git repository", err)
+	}
+	fileDiffs, err := GitDiff(root, op)
+	if err != nil {
+		return nil, utils.WrapError("review: error getting diff", err)
+	}
+
+	reviews := []FileReview{}
+	for _, fileDiff := range fileDiffs {
+		if fileDiff.Deleted() || fileDiff.Binary || len(fileDiff.Hunks) == 0 {
+			continue
+		}
+		review, err := reviewFileDiff(ctx, root, fileDiff, op, focus)
+		if err != nil {
+			return nil, err
+		}
+		reviews = append(reviews, review)
+	}
+	return reviews, nil
+}
+
+func reviewFileDiff(ctx context.Context, root string, fileDiff FileDiff, op DiffOptions, focus string) (FileReview, error) {
+	start := time.Now()
+	path := fileDiff.NewPath
+	fileCtx := &metrics.FileContext{Filepath: path}
+
+	content, err := newFileContent(root, path, op)
+	if err != nil {
+		return FileReview{}, utils.WrapError("review: error reading new version of "+path, err)
+	}
+	fileCtx.FileBytes = int64(len(content))
+	newLines := strings.Split(strings.TrimSuffix(string(content), "\n"), "\n")
+
+	fileName := filepath.Base(path)
+	language, err := project.DetectFileType(ctx, fileName, content, fileCtx)
+	if err != nil {
+		return FileReview{}, utils.WrapError("review: error detecting file type", err)
+	}
+	header := fmt.Sprintf("File name: %s", path)
+	if language != "" {
+		header = fmt.Sprintf("%s\nFile type: %s", header, language)
+	}
+
+	review := FileReview{
+		File:     path,
+		Language: language,
+		Focus:    focus,
+		Findings: []Finding{},
+	}
+	for _, hunk := range fileDiff.Hunks {
+		hunkHeader := header
+		if hunk.Header != "" {
+			hunkHeader = fmt.Sprintf("%s\nChanged section: %s", header, hunk.Header)
+		}
+		first, last := hunk.NewRange()
+		findings, err := reviewSections(ctx, prompts.P_REVIEW_DIFF_01, hunkHeader, focus, renderHunk(hunk, newLines, config.REVIEW_DIFF_CONTEXT_LINES), first, last)
+		if err != nil {
+			return FileReview{}, utils.WrapError(fmt.Sprintf("review: error reviewing %s (lines %v-%v)", path, first, last), err)
+		}
+		review.Findings = append(review.Findings, findings...)
+	}
+	SortFindings(review.Findings)
+
+	metrics.AddSpeedRecord("ReviewDiff", start, *fileCtx)
+	return review, nil
+}
@@ -0,0 +1,226 @@
+package review
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/webbben/caius/internal/llm"
+	"github.com/webbben/caius/prompts"
+)
+
+func git(t *testing.T, dir string, args ...string) {
+	t.Helper()
+	cmd := exec.Command("git", append([]string{"-C", dir, "-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)...)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("git %s: %v\n%s", strings.Join(args, " "), err, out)
+	}
+}
+
+func writeFile(t *testing.T, path string, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestParseDiff(t *testing.T) {
+	diff := `diff --git a/main.go b/main.go
+index 1111111..2222222 100644
+--- a/main.go
++++ b/main.go
+@@ -1,4 +1,5 @@ package main
+ package main
+-
++import "os"
++
+ func main() {
+ }
+@@ -10 +11,0 @@ func other() {
+-	// removed
+diff --git a/new.txt b/new.txt
+new file mode 100644
+index 0000000..3333333
+--- /dev/null
++++ b/new.txt
+@@ -0,0 +1 @@
++hello
+\ No newline at end of file
+diff --git a/old.txt b/old.txt
+deleted file mode 100644
+index 4444444..0000000
+--- a/old.txt
++++ /dev/null
+@@ -1 +0,0 @@
+-bye
+diff --git a/image.png b/image.png
+index 5555555..6666666 100644
+Binary files a/image.png and b/image.png differ
+`
+	fileDiffs, err := ParseDiff(diff)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fileDiffs) != 4 {
+		t.Fatalf("expected 4 file diffs, got %v", len(fileDiffs))
+	}
+
+	main := fileDiffs[0]
+	if main.OldPath != "main.go" || main.NewPath != "main.go" || len(main.Hunks) != 2 {
+		t.Fatalf("unexpected main.go diff: %+v", main)
+	}
+	expected := []DiffLine{
+		{Kind: ' ', Text: "package main", OldLine: 1, NewLine: 1},
+		{Kind: '-', Text: "", OldLine: 2},
+		{Kind: '+', Text: `import "os"`, NewLine: 2},
+		{Kind: '+', Text: "", NewLine: 3},
+		{Kind: ' ', Text: "func main() {", OldLine: 3, NewLine: 4},
+		{Kind: ' ', Text: "}", OldLine: 4, NewLine: 5},
+	}
+	if len(main.Hunks[0].Lines) != len(expected) {
+		t.Fatalf("expected %v lines in first hunk, got %+v", len(expected), main.Hunks[0].Lines)
+	}
+	for i, line := range main.Hunks[0].Lines {
+		if line != expected[i] {
+			t.Errorf("line %v: expected %+v, got %+v", i, expected[i], line)
+		}
+	}
+	if main.Hunks[0].Header != "package main" {
+		t.Errorf("unexpected hunk header %q", main.Hunks[0].Header)
+	}
+	if first, last := main.Hunks[1].NewRange(); first != 11 || last != 11 {
+		t.Errorf("expected removal hunk range 11-11, got %v-%v", first, last)
+	}
+
+	if fileDiffs[1].OldPath != "" || fileDiffs[1].NewPath != "new.txt" || len(fileDiffs[1].Hunks[0].Lines) != 1 {
+		t.Errorf("unexpected new file diff: %+v", fileDiffs[1])
+	}
+	if !fileDiffs[2].Deleted() || fileDiffs[2].OldPath != "old.txt" {
+		t.Errorf("unexpected deleted file diff: %+v", fileDiffs[2])
+	}
+	if !fileDiffs[3].Binary || fileDiffs[3].NewPath != "image.png" {
+		t.Errorf("unexpected binary file diff: %+v", fileDiffs[3])
+	}
+}
+
+func TestReviewDiff(t *testing.T) {
+	prev := llm.GetProvider()
+	t.Cleanup(func() { llm.SetProvider(prev) })
+
+	var diffPrompts []string
+	llm.SetProvider(&llm.FakeProvider{
+		Respond: func(req llm.CompletionRequest, schema json.RawMessage) (string, error) {
+			if req.SystemPrompt != prompts.P_REVIEW_DIFF_01 {
+				return `{"category": "code", "type": "go"}`, nil
+			}
+			diffPrompts = append(diffPrompts, req.Prompt)
+			// one finding inside the changed lines, and one in the context, which should be moved into the hunk
+			return `{"findings": [
+				{"start_line": 21, "end_line": 21, "severity": "high", "category": "bug", "message": "changed line", "suggestion": ""},
+				{"start_line": 1, "end_line": 1, "severity": "low", "category": "style", "message": "context line", "suggestion": ""}
+			]}`, nil
+		},
+	})
+
+	repo := t.TempDir()
+	git(t, repo, "init", "-q", "-b", "main")
+	lines := []string{}
+	for i := 1; i <= 40; i++ {
+		lines = append(lines, "// line "+strings.Repeat("x", i%5))
+	}
+	writeFile(t, filepath.Join(repo, "main.go"), strings.Join(lines, "\n")+"\n")
+	writeFile(t, filepath.Join(repo, "gone.go"), "package main\n")
+	git(t, repo, "add", "-A")
+	git(t, repo, "commit", "-q", "-m", "initial")
+
+	// change line 20 and add a line after it, delete a file, and stage a new one
+	lines[19] = "x := compute()"
+	lines = append(lines[:20], append([]string{"use(x)"}, lines[20:]...)...)
+	writeFile(t, filepath.Join(repo, "main.go"), strings.Join(lines, "\n")+"\n")
+	os.Remove(filepath.Join(repo, "gone.go"))
+	writeFile(t, filepath.Join(repo, "staged.go"), "package main\n\nvar y = 1\n")
+	git(t, repo, "add", "staged.go")
+	writeFile(t, filepath.Join(repo, "untracked.go"), "package main\n")
+
+	// all uncommitted changes
+	reviews, err := ReviewDiff(context.Background(), repo, DiffOptions{}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reviews) != 3 || reviews[0].File != "main.go" || reviews[1].File != "staged.go" || reviews[2].File != "untracked.go" {
+		t.Fatalf("expected reviews of main.go, staged.go and untracked.go, got %+v", reviews)
+	}
+	if !strings.Contains(diffPrompts[0], "  20 | + x := compute()") || !strings.Contains(diffPrompts[0], "     | - // line") {
+		t.Errorf("expected changed lines marked in prompt:\n%s", diffPrompts[0])
+	}
+	if !strings.Contains(diffPrompts[0], "   7 |   // line") || strings.Contains(diffPrompts[0], "   6 |") {
+		t.Errorf("expected 10 lines of context before the hunk:\n%s", diffPrompts[0])
+	}
+
+	// the hunk covers lines 17-24 of the new file (3 lines of diff context around the change)
+	findings := reviews[0].Findings
+	if len(findings) != 2 || findings[0].StartLine != 17 || findings[1].StartLine != 21 {
+		t.Errorf("expected findings on lines 17 and 21, got %+v", findings)
+	}
+
+	// only staged changes
+	reviews, err = ReviewDiff(context.Background(), repo, DiffOptions{Staged: true}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reviews) != 1 || reviews[0].File != "staged.go" {
+		t.Fatalf("expected only staged.go to be reviewed, got %+v", reviews)
+	}
+	if reviews[0].Findings[0].StartLine != 1 || reviews[0].Findings[1].StartLine != 3 {
+		t.Errorf("expected findings clamped to lines 1-3, got %+v", reviews[0].Findings)
+	}
+
+	// changes on a branch
+	git(t, repo, "checkout", "-q", "-b", "feature")
+	git(t, repo, "commit", "-q", "-m", "add staged.go")
+	reviews, err = ReviewDiff(context.Background(), repo, DiffOptions{Base: "main"}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reviews) != 1 || reviews[0].File != "staged.go" {
+		t.Fatalf("expected only the committed staged.go to be reviewed, got %+v", reviews)
+	}
+}
+
+func TestGitDiffNoCommits(t *testing.T) {
+	repo := t.TempDir()
+	git(t, repo, "init", "-q", "-b", "main")
+	writeFile(t, filepath.Join(repo, "staged.go"), "package main\n\nvar x = 1\n")
+	writeFile(t, filepath.Join(repo, "untracked.go"), "package main\n")
+	writeFile(t, filepath.Join(repo, "debug.log"), "ignored\n")
+	writeFile(t, filepath.Join(repo, ".git", "info", "exclude"), "*.log\n")
+	git(t, repo, "add", "staged.go")
+
+	fileDiffs, err := GitDiff(repo, DiffOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fileDiffs) != 2 || fileDiffs[0].NewPath != "staged.go" || fileDiffs[1].NewPath != "untracked.go" {
+		t.Fatalf("expected diffs of staged.go and untracked.go, got %+v", fileDiffs)
+	}
+	for _, fileDiff := range fileDiffs {
+		if fileDiff.OldPath != "" || len(fileDiff.Hunks) != 1 || fileDiff.Hunks[0].NewStart != 1 {
+			t.Errorf("expected %s to be a new file, got %+v", fileDiff.NewPath, fileDiff)
+		}
+	}
+	if lines := fileDiffs[0].Hunks[0].Lines; len(lines) != 3 || lines[2].Text != "var x = 1" || lines[2].NewLine != 3 {
+		t.Errorf("unexpected lines of staged.go: %+v", lines)
+	}
+
+	fileDiffs, err = GitDiff(repo, DiffOptions{Staged: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fileDiffs) != 1 || fileDiffs[0].NewPath != "staged.go" {
+		t.Errorf("expected only staged.go to be staged, got %+v", fileDiffs)
+	}
+}
@@ -0,0 +1,174 @@
+package review
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/webbben/caius/internal/config"
+	"github.com/webbben/caius/internal/files"
+	"github.com/webbben/caius/internal/llm"
+	"github.com/webbben/caius/internal/metrics"
+	"github.com/webbben/caius/internal/project"
+	"github.com/webbben/caius/internal/utils"
+	"github.com/webbben/caius/prompts"
+)
+
+// Finding is a single issue found during a code review.
+type Finding struct {
+	StartLine  int    `json:"start_line"`
+	EndLine    int    `json:"end_line"`
+	Severity   string `json:"severity" jsonschema:"enum=info|low|medium|high|critical"`
+	Category   string `json:"category" jsonschema:"enum=bug|security|performance|maintainability|readability|style|other"`
+	Message    string `json:"message"`
+	Suggestion string `json:"suggestion"`
+}
+
+// Severities, from least to most severe
+var Severities []string = []string{"info", "low", "medium", "high", "critical"}
+
+var Categories []string = []string{"bug", "security", "performance", "maintainability", "readability", "style", "other"}
+
+type ReviewResponse struct {
+	Findings []Finding `json:"findings"`
+}
+
+var ReviewSchema json.RawMessage = llm.MustSchemaOf(ReviewResponse{})
+
+// FileReview is the result of reviewing a single file.
+type FileReview struct {
+	File     string    `json:"file"`
+	Language string    `json:"language"`
+	Focus    string    `json:"focus,omitempty"`
+	Findings []Finding `json:"findings"`
+}
+
+// SeverityRank gives the position of a severity in Severities (higher is more severe), or -1 if it's unknown.
+func SeverityRank(severity string) int {
+	for i, s := range Severities {
+		if s == severity {
+			return i
+		}
+	}
+	return -1
+}
+
+// numberLines prefixes each line with its line number, so the LLM can refer to them.
+func numberLines(content string, firstLine int) string {
+	lines := strings.Split(strings.TrimSuffix(content, "\n"), "\n")
+	var sb strings.Builder
+	for i, line := range lines {
+		fmt.Fprintf(&sb, "%4d | %s\n", firstLine+i, line)
+	}
+	return sb.String()
+}
+
+func reviewPrompt(header string, focus string, body string) string {
+	if focus != "" {
+		header = fmt.Sprintf("%s\nReview focus: %s (only report findings related to this)", header, focus)
+	}
+	return fmt.Sprintf("%s\n\n(content below)\n\n%s", header, body)
+}
+
+// ReviewFile has the LLM review a single file, optionally focusing on a specific area (e.g. "security").
+func ReviewFile(ctx context.Context, path string, focus string) (FileReview, error) {
+	start := time.Now()
+	fileCtx := &metrics.FileContext{Filepath: path}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return FileReview{}, errors.Join(errors.New("review: error reading file "+path), err)
+	}
+	fileCtx.FileBytes = int64(len(content))
+	if files.IsProbablyBinaryData(content) {
+		return FileReview{}, fmt.Errorf("review: %s appears to be a binary file", path)
+	}
+
+	fileName := filepath.Base(path)
+	language, err := project.DetectFileType(ctx, fileName, content, fileCtx)
+	if err != nil {
+		return FileReview{}, utils.WrapError("review: error detecting file type", err)
+	}
+
+	header := fmt.Sprintf("File name: %s", fileName)
+	if language != "" {
+		header = fmt.Sprintf("%s\nFile type: %s", header, language)
+	}
+
+	lineCount := strings.Count(strings.TrimSuffix(string(content), "\n"), "\n") + 1
+	findings, err := reviewSections(ctx, prompts.P_REVIEW_FILE_01, header, focus, numberLines(string(content), 1), 1, lineCount)
+	if err != nil {
+		return FileReview{}, err
+	}
+	SortFindings(findings)
+
+	metrics.AddSpeedRecord("ReviewFile", start, *fileCtx)
+	return FileReview{
+		File:     path,
+		Language: language,
+		Focus:    focus,
+		Findings: findings,
+	}, nil
+}
+
+// reviewSections sends line-numbered content to the LLM for review.
+// Content that is too large for the model's context window is reviewed in sections.
+// Findings are kept within firstLine and lastLine.
+func reviewSections(ctx context.Context, sysPrompt string, header string, focus string, numbered string, firstLine int, lastLine int) ([]Finding, error) {
+	model := config.CODE_REVIEW_MODEL
+	budget := llm.PromptBudget(model, llm.ResponseTokenReserve, sysPrompt, header)
+	chunks := files.ChunkText(numbered, max(budget, 256)*4)
+
+	findings := []Finding{}
+	for i, chunk := range chunks {
+		sectionHeader := header
+		if len(chunks) > 1 {
+			sectionHeader = fmt.Sprintf("%s\nSection: %v of %v", header, i+1, len(chunks))
+		}
+		prompt := reviewPrompt(sectionHeader, focus, chunk.Text)
+
+		var resp ReviewResponse
+		err := llm.GenerateCompletionJsonWithModel(ctx, model, sysPrompt, prompt, ReviewSchema, &resp)
+		if err != nil {
+			return nil, utils.WrapError(fmt.Sprintf("error reviewing section %v of %v", i+1, len(chunks)), err)
+		}
+		findings = append(findings, cleanFindings(resp.Findings, firstLine, lastLine)...)
+	}
+	return findings, nil
+}
+
+// cleanFindings drops empty findings, and makes sure line numbers are within the expected range.
+// Severities and categories don't need cleaning, since the schema only allows the known ones.
+func cleanFindings(findings []Finding, firstLine int, lastLine int) []Finding {
+	cleaned := []Finding{}
+	for _, f := range findings {
+		f.Message = strings.TrimSpace(f.Message)
+		f.Suggestion = strings.TrimSpace(f.Suggestion)
+		if f.Message == "" {
+			continue
+		}
+		f.StartLine = min(max(f.StartLine, firstLine), lastLine)
+		if f.EndLine < f.StartLine {
+			f.EndLine = f.StartLine
+		}
+		f.EndLine = min(f.EndLine, lastLine)
+		cleaned = append(cleaned, f)
+	}
+	return cleaned
+}
+
+// SortFindings orders findings by line number, and then by severity (most severe first).
+func SortFindings(findings []Finding) {
+	sort.SliceStable(findings, func(i, j int) bool {
+		if findings[i].StartLine != findings[j].StartLine {
+			return findings[i].StartLine < findings[j].StartLine
+		}
+		return SeverityRank(findings[i].Severity) > SeverityRank(findings[j].Severity)
+	})
+}
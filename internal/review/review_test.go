@@ -0,0 +1,123 @@
+package review
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/webbben/caius/internal/llm"
+	"github.com/webbben/caius/prompts"
+)
+
+func TestReviewFile(t *testing.T) {
+	prev := llm.GetProvider()
+	t.Cleanup(func() { llm.SetProvider(prev) })
+
+	var reviewPrompts []string
+	llm.SetProvider(&llm.FakeProvider{
+		Respond: func(req llm.CompletionRequest, schema json.RawMessage) (string, error) {
+			if req.SystemPrompt != prompts.P_REVIEW_FILE_01 {
+				return `{"category": "code", "type": "go"}`, nil
+			}
+			reviewPrompts = append(reviewPrompts, req.Prompt)
+			if len(reviewPrompts) == 1 {
+				// severities that aren't in the schema's enum are sent back to the model to be fixed
+				return `{"findings": [{"start_line": 5, "end_line": 99, "severity": "LOW", "category": "style", "message": "out of range", "suggestion": ""}]}`, nil
+			}
+			return `{"findings": [
+				{"start_line": 5, "end_line": 99, "severity": "low", "category": "style", "message": "out of range", "suggestion": ""},
+				{"start_line": 2, "end_line": 1, "severity": "info", "category": "bug", "message": "  backwards range  ", "suggestion": " fix it "},
+				{"start_line": 2, "end_line": 2, "severity": "high", "category": "security", "message": "more severe", "suggestion": ""},
+				{"start_line": 1, "end_line": 1, "severity": "low", "category": "bug", "message": "", "suggestion": "empty message"}
+			]}`, nil
+		},
+	})
+
+	path := filepath.Join(t.TempDir(), "main.go")
+	content := "package main\n\nfunc main() {\n}\n"
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := ReviewFile(context.Background(), path, "security")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Language != "golang code" {
+		t.Errorf("expected language \"golang code\", got %q", result.Language)
+	}
+	if len(reviewPrompts) != 2 {
+		t.Fatalf("expected 2 review prompts (the second one to repair the response), got %v", len(reviewPrompts))
+	}
+	if !strings.Contains(reviewPrompts[1], `findings[0].severity: "LOW" is not one of`) {
+		t.Errorf("expected the invalid severity in the repair prompt:\n%s", reviewPrompts[1])
+	}
+	if !strings.Contains(reviewPrompts[0], "   3 | func main() {") {
+		t.Errorf("expected numbered lines in prompt:\n%s", reviewPrompts[0])
+	}
+	if !strings.Contains(reviewPrompts[0], "Review focus: security") {
+		t.Errorf("expected focus in prompt:\n%s", reviewPrompts[0])
+	}
+
+	expected := []Finding{
+		{StartLine: 2, EndLine: 2, Severity: "high", Category: "security", Message: "more severe"},
+		{StartLine: 2, EndLine: 2, Severity: "info", Category: "bug", Message: "backwards range", Suggestion: "fix it"},
+		{StartLine: 4, EndLine: 4, Severity: "low", Category: "style", Message: "out of range"},
+	}
+	if len(result.Findings) != len(expected) {
+		t.Fatalf("expected %v findings, got %v: %+v", len(expected), len(result.Findings), result.Findings)
+	}
+	for i, f := range result.Findings {
+		if f != expected[i] {
+			t.Errorf("finding %v: expected %+v, got %+v", i, expected[i], f)
+		}
+	}
+}
+
+func TestCleanFindings(t *testing.T) {
+	findings := cleanFindings([]Finding{
+		{StartLine: 0, EndLine: 3, Severity: "high", Category: "bug", Message: " before the range "},
+		{StartLine: 8, EndLine: 20, Severity: "low", Category: "style", Message: "past the end"},
+		{StartLine: 5, EndLine: 4, Severity: "info", Category: "other", Message: "backwards"},
+		{StartLine: 6, EndLine: 6, Severity: "info", Category: "other", Message: "  "},
+	}, 2, 10)
+
+	expected := []Finding{
+		{StartLine: 2, EndLine: 3, Severity: "high", Category: "bug", Message: "before the range"},
+		{StartLine: 8, EndLine: 10, Severity: "low", Category: "style", Message: "past the end"},
+		{StartLine: 5, EndLine: 5, Severity: "info", Category: "other", Message: "backwards"},
+	}
+	if len(findings) != len(expected) {
+		t.Fatalf("expected %v findings, got %+v", len(expected), findings)
+	}
+	for i, f := range findings {
+		if f != expected[i] {
+			t.Errorf("finding %v: expected %+v, got %+v", i, expected[i], f)
+		}
+	}
+}
+
+func TestReviewSchemaEnums(t *testing.T) {
+	schema, err := llm.ParseSchema(ReviewSchema)
+	if err != nil {
+		t.Fatal(err)
+	}
+	finding := schema.Properties["findings"].Items
+	enumStrings := func(values []any) []string {
+		s := []string{}
+		for _, v := range values {
+			s = append(s, v.(string))
+		}
+		return s
+	}
+	if got := enumStrings(finding.Properties["severity"].Enum); !slices.Equal(got, Severities) {
+		t.Errorf("severity enum %v doesn't match Severities %v", got, Severities)
+	}
+	if got := enumStrings(finding.Properties["category"].Enum); !slices.Equal(got, Categories) {
+		t.Errorf("category enum %v doesn't match Categories %v", got, Categories)
+	}
+}
@@ -0,0 +1,152 @@
+package websearch
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/webbben/caius/internal/utils"
+)
+
+// the Brave Search API allows one call per second on the free plan
+var lastBraveAPICall time.Time
+var braveAPIRate time.Duration = time.Second + (time.Millisecond * 50)
+var braveAPICallMutex sync.Mutex
+
+const braveSearchURL = "https://api.search.brave.com/res/v1/web/search"
+
+// the Brave Search API gives at most 20 results per call, and up to 10 pages
+const braveMaxCount = 20
+const braveMaxPage = 9
+
+// values of the Brave Search API's freshness parameter, for each SearchOptions.Freshness
+var braveFreshness = map[string]string{
+	"day":   "pd",
+	"week":  "pw",
+	"month": "pm",
+	"year":  "py",
+}
+
+// BraveProvider searches with the Brave Search API, which needs an API key (see https://brave.com/search/api).
+type BraveProvider struct {
+	APIKey  string
+	BaseURL string // defaults to the Brave Search API
+	Client  *http.Client
+}
+
+type searchResult struct {
+	Title         string `json:"title"`
+	Url           string `json:"url"`
+	IsSourceLocal bool   `json:"is_source_local"`
+	IsSourceBoth  bool   `json:"is_source_both"`
+	Description   string `json:"description"`
+	Profile       struct {
+		Name     string `json:"name"`
+		Url      string `json:"url"`
+		LongName string `json:"long_name"`
+		Img      string `json:"img"`
+	} `json:"profile"`
+}
+
+type braveSearchResults struct {
+	Type string `json:"type"`
+	Web  struct {
+		Type    string         `json:"type"`
+		Results []searchResult `json:"results"`
+	} `json:"web"`
+}
+
+func (b *BraveProvider) Name() string {
+	return "brave"
+}
+
+func (b *BraveProvider) Search(ctx context.Context, query string, opts SearchOptions) ([]Website, error) {
+	searchResults, err := b.callAPI(ctx, query, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	websites := []Website{}
+	for _, result := range searchResults.Web.Results {
+		websites = append(websites, Website{
+			URL:         result.Url,
+			Title:       result.Title,
+			Description: RemoveAllHTML(result.Description),
+			WebsiteName: result.Profile.Name,
+		})
+	}
+	return websites, nil
+}
+
+func (b *BraveProvider) callAPI(ctx context.Context, searchPhrase string, opts SearchOptions) (braveSearchResults, error) {
+	if b.APIKey == "" {
+		return braveSearchResults{}, errors.New("brave: no API key; set BRAVE_SEARCH_API_KEY, or use another search provider (e.g. caius config set websearch.provider duckduckgo)")
+	}
+
+	baseURL := b.BaseURL
+	if baseURL == "" {
+		baseURL = braveSearchURL
+	}
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return braveSearchResults{}, err
+	}
+	q := u.Query()
+	q.Set("q", searchPhrase)
+	q.Set("count", strconv.Itoa(min(opts.count(), braveMaxCount)))
+	if opts.Country != "" {
+		q.Set("country", strings.ToLower(opts.Country))
+	}
+	if opts.Language != "" {
+		q.Set("search_lang", strings.ToLower(opts.Language))
+	}
+	if opts.Freshness != "" {
+		q.Set("freshness", braveFreshness[opts.Freshness])
+	}
+	if opts.Page > 0 {
+		if opts.Page > braveMaxPage {
+			return braveSearchResults{}, fmt.Errorf("brave: page %v is past the last page of results (%v)", opts.Page, braveMaxPage)
+		}
+		// the offset is counted in pages of count results
+		q.Set("offset", strconv.Itoa(opts.Page))
+	}
+	u.RawQuery = q.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, "GET", u.String(), nil)
+	if err != nil {
+		return braveSearchResults{}, utils.WrapError("error on requesting Brave Search API", err)
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("X-Subscription-Token", b.APIKey)
+
+	// make sure we aren't calling the API more than once per second
+	braveAPICallMutex.Lock()
+	defer braveAPICallMutex.Unlock()
+	if wait := braveAPIRate - time.Since(lastBraveAPICall); wait > 0 {
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return braveSearchResults{}, ctx.Err()
+		}
+	}
+
+	body, err := doSearchRequest(b.Client, req, "brave")
+	lastBraveAPICall = time.Now()
+	if err != nil {
+		return braveSearchResults{}, err
+	}
+	var results braveSearchResults
+	err = json.Unmarshal(body, &results)
+	if err != nil {
+		return results, utils.WrapError("error on unmarshalling Brave Search API response data", err)
+	}
+
+	return results, nil
+}
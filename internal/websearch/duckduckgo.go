@@ -0,0 +1,142 @@
+package websearch
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/webbben/caius/internal/utils"
+	"golang.org/x/net/html"
+)
+
+const duckDuckGoURL = "https://html.duckduckgo.com/html/"
+
+// DuckDuckGoProvider searches with DuckDuckGo by reading the results out of its HTML-only search page.
+// It doesn't need an API key, but the page's layout may change.
+type DuckDuckGoProvider struct {
+	BaseURL string // defaults to DuckDuckGo's HTML search page
+	Client  *http.Client
+}
+
+func (d *DuckDuckGoProvider) Name() string {
+	return "duckduckgo"
+}
+
+func (d *DuckDuckGoProvider) Search(ctx context.Context, query string, opts SearchOptions) ([]Website, error) {
+	baseURL := d.BaseURL
+	if baseURL == "" {
+		baseURL = duckDuckGoURL
+	}
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return nil, utils.WrapError("duckduckgo: invalid URL", err)
+	}
+	q := u.Query()
+	q.Set("q", query)
+	if region := duckDuckGoRegion(opts); region != "" {
+		q.Set("kl", region)
+	}
+	if opts.Freshness != "" {
+		// d, w, m or y
+		q.Set("df", opts.Freshness[:1])
+	}
+	if opts.Page > 0 {
+		q.Set("s", strconv.Itoa(opts.Page*opts.count()))
+	}
+	u.RawQuery = q.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, "GET", u.String(), nil)
+	if err != nil {
+		return nil, utils.WrapError("duckduckgo: error creating request", err)
+	}
+	req.Header.Set("User-Agent", "Mozilla/5.0 (compatible; Caius/1.0)")
+
+	body, err := doSearchRequest(d.Client, req, "duckduckgo")
+	if err != nil {
+		return nil, err
+	}
+	return parseDuckDuckGoResults(string(body), opts.count())
+}
+
+// countries whose DuckDuckGo region is in English
+var duckDuckGoEnglishCountries = []string{"us", "uk", "au", "ca", "ie", "in", "nz", "ph", "sg", "za"}
+
+// duckDuckGoRegion gives the region to search in, e.g. "us-en" or "de-de". DuckDuckGo regions are a country and a language,
+// so if only one of them is set, the usual combination is assumed.
+func duckDuckGoRegion(opts SearchOptions) string {
+	country := strings.ToLower(opts.Country)
+	lang := strings.ToLower(opts.Language)
+	// DuckDuckGo uses uk for the United Kingdom
+	if country == "gb" {
+		country = "uk"
+	}
+	switch {
+	case country == "" && lang == "":
+		return ""
+	case country == "" && lang == "en":
+		country = "us"
+	case country == "":
+		country = lang
+	case lang == "" && slices.Contains(duckDuckGoEnglishCountries, country):
+		lang = "en"
+	case lang == "":
+		lang = country
+	}
+	return country + "-" + lang
+}
+
+// parseDuckDuckGoResults reads up to count search results out of DuckDuckGo's HTML results page. Ads are skipped.
+func parseDuckDuckGoResults(page string, count int) ([]Website, error) {
+	doc, err := html.Parse(strings.NewReader(page))
+	if err != nil {
+		return nil, utils.WrapError("duckduckgo: error parsing results page", err)
+	}
+
+	websites := []Website{}
+	results := findAllNodes(doc, func(n *html.Node) bool { return hasClass(n, "result") })
+	for _, result := range results {
+		if len(websites) == count {
+			break
+		}
+		if hasClass(result, "result--ad") {
+			continue
+		}
+		link := findByClass(result, "result__a")
+		if link == nil {
+			continue
+		}
+		resultURL := duckDuckGoTarget(getAttr(link, "href"))
+		if resultURL == "" {
+			continue
+		}
+		website := Website{
+			URL:         resultURL,
+			Title:       normalizeSpace(extractTextFromNode(link)),
+			WebsiteName: siteName(resultURL),
+		}
+		if snippet := findByClass(result, "result__snippet"); snippet != nil {
+			website.Description = normalizeSpace(extractTextFromNode(snippet))
+		}
+		websites = append(websites, website)
+	}
+	return websites, nil
+}
+
+// duckDuckGoTarget gives the URL a result link leads to. Links usually go through DuckDuckGo's redirect
+// (e.g. //duckduckgo.com/l/?uddg=https%3A%2F%2Fexample.com), which has the actual URL in its uddg parameter.
+func duckDuckGoTarget(href string) string {
+	u, err := url.Parse(href)
+	if err != nil {
+		return ""
+	}
+	if target := u.Query().Get("uddg"); target != "" {
+		return target
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return ""
+	}
+	return href
+}
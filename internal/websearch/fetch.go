@@ -0,0 +1,250 @@
+package websearch
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/webbben/caius/internal/config"
+)
+
+const userAgent = "Mozilla/5.0 (compatible; Caius/1.0)"
+
+// content types of the pages we can read
+var fetchContentTypes = []string{"text/html", "application/xhtml+xml", "text/plain"}
+
+// ErrDisallowedByRobots is given when a website's robots.txt doesn't allow us to fetch a page
+var ErrDisallowedByRobots = errors.New("disallowed by robots.txt")
+
+// Fetcher downloads web pages, several at a time, while being polite to the websites they're on:
+// only a few pages are downloaded from the same host at a time, and pages that a website's robots.txt
+// disallows aren't downloaded at all. Each host's robots.txt is only fetched once.
+//
+// The fields can't be changed once the Fetcher is in use.
+type Fetcher struct {
+	Client       *http.Client // defaults to a client with a 10 second timeout
+	Jobs         int          // max pages downloaded at a time by FetchAll
+	PerHost      int          // max pages downloaded at a time from the same host
+	MaxBodyBytes int64        // pages larger than this are rejected; 0 means no limit
+	MaxRedirects int          // 0 means redirects aren't followed
+
+	mutex  sync.Mutex
+	hosts  map[string]chan struct{} // a semaphore for each host
+	robots map[string]*robotsEntry  // robots.txt of each host, by its scheme and host
+}
+
+// FetchResult is the outcome of downloading a single page
+type FetchResult struct {
+	URL  string
+	HTML string
+	Err  error
+}
+
+// NewFetcher creates a Fetcher with the limits in the config (config.WEBSEARCH_FETCH_JOBS, etc.)
+func NewFetcher() *Fetcher {
+	return &Fetcher{
+		Jobs:         config.WEBSEARCH_FETCH_JOBS,
+		PerHost:      config.WEBSEARCH_FETCH_PER_HOST,
+		MaxBodyBytes: config.WEBSEARCH_MAX_PAGE_BYTES,
+		MaxRedirects: config.WEBSEARCH_MAX_REDIRECTS,
+	}
+}
+
+var defaultFetcher *Fetcher
+var defaultFetcherOnce sync.Once
+
+// getFetcher gives the Fetcher shared by everything in this package, so robots.txt files are only fetched once per run
+func getFetcher() *Fetcher {
+	defaultFetcherOnce.Do(func() {
+		defaultFetcher = NewFetcher()
+	})
+	return defaultFetcher
+}
+
+// FetchAll downloads pages in parallel. The results are in the same order as the URLs.
+func (f *Fetcher) FetchAll(ctx context.Context, urls []string) []FetchResult {
+	results := make([]FetchResult, len(urls))
+	jobs := make(chan struct{}, max(f.Jobs, 1))
+	var wg sync.WaitGroup
+	for i, u := range urls {
+		results[i].URL = u
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			select {
+			case jobs <- struct{}{}:
+				defer func() { <-jobs }()
+			case <-ctx.Done():
+				results[i].Err = ctx.Err()
+				return
+			}
+			results[i].HTML, results[i].Err = f.Fetch(ctx, u)
+		}()
+	}
+	wg.Wait()
+	return results
+}
+
+// Fetch downloads a single page, and gives its content.
+//
+// Pages that the website's robots.txt disallows give ErrDisallowedByRobots, and pages that aren't
+// HTML (or plain text), or that are larger than MaxBodyBytes, give an error without being downloaded in full.
+// Redirects are followed one at a time, so each one is checked against robots.txt and the PerHost limit of its own host.
+func (f *Fetcher) Fetch(ctx context.Context, pageURL string) (string, error) {
+	u, err := url.Parse(pageURL)
+	if err != nil {
+		return "", err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return "", fmt.Errorf("unsupported URL scheme %q", u.Scheme)
+	}
+	for redirects := 0; ; redirects++ {
+		page, next, err := f.fetchOnce(ctx, u)
+		if err != nil || next == nil {
+			return page, err
+		}
+		if redirects >= f.MaxRedirects {
+			return "", fmt.Errorf("%s: stopped after %v redirects", pageURL, f.MaxRedirects)
+		}
+		if next.Scheme != "http" && next.Scheme != "https" {
+			return "", fmt.Errorf("%s: redirect to unsupported URL scheme %q", pageURL, next.Scheme)
+		}
+		u = next
+	}
+}
+
+// fetchOnce makes a single request for a page. If the response is a redirect, it gives the URL it redirects to instead of the page.
+func (f *Fetcher) fetchOnce(ctx context.Context, u *url.URL) (string, *url.URL, error) {
+	if err := f.checkRobots(ctx, u); err != nil {
+		return "", nil, err
+	}
+
+	release, err := f.acquireHost(ctx, u.Host)
+	if err != nil {
+		return "", nil, err
+	}
+	defer release()
+
+	req, err := http.NewRequestWithContext(ctx, "GET", u.String(), nil)
+	if err != nil {
+		return "", nil, err
+	}
+	req.Header.Set("User-Agent", userAgent)
+	req.Header.Set("Accept", "text/html,application/xhtml+xml,text/plain;q=0.9")
+
+	resp, err := f.client(false).Do(req)
+	if err != nil {
+		return "", nil, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusMovedPermanently, http.StatusFound, http.StatusSeeOther, http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+		location, err := resp.Location()
+		if err != nil {
+			return "", nil, fmt.Errorf("%s: invalid redirect; %w", u, err)
+		}
+		return "", location, nil
+	case http.StatusOK:
+	default:
+		return "", nil, fmt.Errorf("HTTP error: %s", resp.Status)
+	}
+	if f.MaxBodyBytes > 0 && resp.ContentLength > f.MaxBodyBytes {
+		return "", nil, fmt.Errorf("page is too large (%v bytes; the limit is %v)", resp.ContentLength, f.MaxBodyBytes)
+	}
+
+	// check the content type before downloading the page; if the server doesn't say, sniff it from the start of the page
+	var body io.Reader = resp.Body
+	contentType := resp.Header.Get("Content-Type")
+	if contentType == "" {
+		head, err := io.ReadAll(io.LimitReader(resp.Body, 512))
+		if err != nil {
+			return "", nil, err
+		}
+		contentType = http.DetectContentType(head)
+		body = io.MultiReader(bytes.NewReader(head), resp.Body)
+	}
+	if mediaType, _, _ := mime.ParseMediaType(contentType); !isFetchContentType(mediaType) {
+		return "", nil, fmt.Errorf("unsupported content type %q", contentType)
+	}
+
+	page, err := readBody(body, f.MaxBodyBytes)
+	if err != nil {
+		return "", nil, err
+	}
+	return string(page), nil, nil
+}
+
+// readBody reads a response body of up to limit bytes (0 means no limit), giving an error for larger ones
+func readBody(body io.Reader, limit int64) ([]byte, error) {
+	if limit <= 0 {
+		return io.ReadAll(body)
+	}
+	b, err := io.ReadAll(io.LimitReader(body, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(b)) > limit {
+		return nil, fmt.Errorf("page is too large (more than %v bytes)", limit)
+	}
+	return b, nil
+}
+
+func isFetchContentType(mediaType string) bool {
+	for _, t := range fetchContentTypes {
+		if mediaType == t {
+			return true
+		}
+	}
+	return false
+}
+
+// acquireHost waits until fewer than PerHost pages are being downloaded from the host, and gives a func that releases its spot
+func (f *Fetcher) acquireHost(ctx context.Context, host string) (func(), error) {
+	f.mutex.Lock()
+	if f.hosts == nil {
+		f.hosts = map[string]chan struct{}{}
+	}
+	sem, ok := f.hosts[host]
+	if !ok {
+		sem = make(chan struct{}, max(f.PerHost, 1))
+		f.hosts[host] = sem
+	}
+	f.mutex.Unlock()
+
+	select {
+	case sem <- struct{}{}:
+		return func() { <-sem }, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// client gives the HTTP client to download pages with. If followRedirects is set, it follows up to MaxRedirects redirects
+// on its own; otherwise redirect responses are returned as they are.
+func (f *Fetcher) client(followRedirects bool) *http.Client {
+	client := http.Client{Timeout: 10 * time.Second}
+	if f.Client != nil {
+		client = *f.Client
+	}
+	client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		if !followRedirects {
+			return http.ErrUseLastResponse
+		}
+		if len(via) > f.MaxRedirects {
+			return fmt.Errorf("stopped after %v redirects", f.MaxRedirects)
+		}
+		if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+			return fmt.Errorf("redirect to unsupported URL scheme %q", req.URL.Scheme)
+		}
+		return nil
+	}
+	return &client
+}
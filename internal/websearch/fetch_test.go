@@ -0,0 +1,332 @@
+package websearch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestParseRobots(t *testing.T) {
+	robotsTxt := `# comments are ignored
+User-agent: *
+Disallow: /private
+Allow: /private/public
+Disallow: /*.pdf$
+Disallow: /search?
+
+User-agent: Caius
+User-agent: SomeOtherBot
+Disallow: /no-caius/  # trailing comment
+Disallow:
+
+User-agent: *
+Disallow: /also-private
+`
+	tests := []struct {
+		agent   string
+		path    string
+		query   string
+		allowed bool
+	}{
+		{"anybot", "/", "", true},
+		{"anybot", "/private", "", false},
+		{"anybot", "/private/page", "", false},
+		{"anybot", "/private/public/page", "", true},
+		{"anybot", "/also-private", "", false},
+		{"anybot", "/doc.pdf", "", false},
+		{"anybot", "/doc.pdf.html", "", true},
+		{"anybot", "/search", "q=go", false},
+		{"anybot", "/search", "", true},
+		// the caius group replaces the * groups
+		{"caius", "/private", "", true},
+		{"CAIUS", "/no-caius/page", "", false},
+		{"caius", "/no-caius", "", true},
+	}
+	for _, tt := range tests {
+		rules := parseRobots(robotsTxt, tt.agent)
+		if allowed := rules.allowed(tt.path, tt.query); allowed != tt.allowed {
+			t.Errorf("%s %s?%s: expected allowed=%v", tt.agent, tt.path, tt.query, tt.allowed)
+		}
+	}
+
+	if !parseRobots("", "caius").allowed("/anything", "") {
+		t.Error("expected an empty robots.txt to allow everything")
+	}
+	if parseRobots("User-agent: *\nDisallow: /", "caius").allowed("/page", "") {
+		t.Error("expected Disallow: / to disallow everything")
+	}
+}
+
+func TestRobotsMatch(t *testing.T) {
+	tests := []struct {
+		pattern string
+		path    string
+		match   bool
+	}{
+		{"/fish", "/fish.html", true},
+		{"/fish", "/Fish.html", false},
+		{"/fish*", "/fishheads/yummy.html", true},
+		{"/*.php", "/folder/filename.php?parameters", true},
+		{"/*.php$", "/filename.php", true},
+		{"/*.php$", "/filename.php?parameters", false},
+		{"/fish*.php", "/fishheads/catfish.php?parameters", true},
+		{"/fish*.php", "/Fish.PHP", false},
+		{"/$", "/", true},
+		{"/$", "/page", false},
+	}
+	for _, tt := range tests {
+		if match := robotsMatch(tt.pattern, tt.path); match != tt.match {
+			t.Errorf("%q %q: expected match=%v", tt.pattern, tt.path, tt.match)
+		}
+	}
+}
+
+// newSiteServer starts a local website, with the given robots.txt (or a 404 if it's empty)
+func newSiteServer(t *testing.T, robotsTxt string, pages http.HandlerFunc) (*httptest.Server, *atomic.Int32) {
+	robotsRequests := &atomic.Int32{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/robots.txt" {
+			robotsRequests.Add(1)
+			if robotsTxt == "" {
+				http.NotFound(w, r)
+				return
+			}
+			w.Write([]byte(robotsTxt))
+			return
+		}
+		pages(w, r)
+	}))
+	t.Cleanup(server.Close)
+	return server, robotsRequests
+}
+
+func TestFetch(t *testing.T) {
+	server, robotsRequests := newSiteServer(t, "User-agent: *\nDisallow: /private\n", func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/page":
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			fmt.Fprint(w, "<html><body><p>Hello</p></body></html>")
+		case "/sniffed":
+			w.Header()["Content-Type"] = nil // don't let the server detect it
+			fmt.Fprint(w, "<!DOCTYPE html><html><body><p>Hello</p></body></html>")
+		case "/image.png":
+			w.Header().Set("Content-Type", "image/png")
+			w.Write([]byte("\x89PNG\r\n\x1a\n"))
+		case "/large":
+			w.Header().Set("Content-Type", "text/html")
+			fmt.Fprint(w, strings.Repeat("x", 2000))
+		case "/large-chunked":
+			// without a Content-Length, the size is only known once it's read
+			w.Header().Set("Content-Type", "text/html")
+			for range 20 {
+				fmt.Fprint(w, strings.Repeat("x", 100))
+				w.(http.Flusher).Flush()
+			}
+		case "/missing":
+			http.NotFound(w, r)
+		case "/redirect-to-private":
+			http.Redirect(w, r, "/private/page", http.StatusFound)
+		case "/redirect-to-page":
+			http.Redirect(w, r, "/page", http.StatusMovedPermanently)
+		case "/loop":
+			http.Redirect(w, r, "/loop", http.StatusFound)
+		default:
+			t.Errorf("unexpected request for %s", r.URL)
+		}
+	})
+
+	f := &Fetcher{PerHost: 2, MaxBodyBytes: 1000, MaxRedirects: 3}
+	ctx := context.Background()
+	for _, path := range []string{"/page", "/sniffed", "/redirect-to-page"} {
+		page, err := f.Fetch(ctx, server.URL+path)
+		if err != nil {
+			t.Errorf("%s: %v", path, err)
+		} else if !strings.Contains(page, "<p>Hello</p>") {
+			t.Errorf("%s: unexpected page %q", path, page)
+		}
+	}
+
+	failures := map[string]string{
+		"/image.png":     "unsupported content type",
+		"/large":         "too large",
+		"/large-chunked": "too large",
+		"/missing":       "404",
+		"/loop":          "stopped after 3 redirects",
+	}
+	for path, expected := range failures {
+		if _, err := f.Fetch(ctx, server.URL+path); err == nil || !strings.Contains(err.Error(), expected) {
+			t.Errorf("%s: expected an error with %q, got %v", path, expected, err)
+		}
+	}
+	for _, path := range []string{"/private/page", "/redirect-to-private"} {
+		if _, err := f.Fetch(ctx, server.URL+path); !errors.Is(err, ErrDisallowedByRobots) {
+			t.Errorf("%s: expected ErrDisallowedByRobots, got %v", path, err)
+		}
+	}
+	if n := robotsRequests.Load(); n != 1 {
+		t.Errorf("expected robots.txt to be requested once, got %v requests", n)
+	}
+}
+
+func TestFetchRobotsUnavailable(t *testing.T) {
+	// a missing robots.txt allows everything
+	server, _ := newSiteServer(t, "", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "<html><body>ok</body></html>")
+	})
+	if _, err := (&Fetcher{}).Fetch(context.Background(), server.URL+"/page"); err != nil {
+		t.Error(err)
+	}
+
+	// a robots.txt that can't be reached allows nothing
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	t.Cleanup(down.Close)
+	if _, err := (&Fetcher{}).Fetch(context.Background(), down.URL+"/page"); !errors.Is(err, ErrDisallowedByRobots) {
+		t.Errorf("expected ErrDisallowedByRobots, got %v", err)
+	}
+}
+
+func TestFetchAll(t *testing.T) {
+	var inFlight, maxInFlight atomic.Int32
+	var mutex sync.Mutex
+	server, _ := newSiteServer(t, "", func(w http.ResponseWriter, r *http.Request) {
+		n := inFlight.Add(1)
+		defer inFlight.Add(-1)
+		mutex.Lock()
+		if n > maxInFlight.Load() {
+			maxInFlight.Store(n)
+		}
+		mutex.Unlock()
+		time.Sleep(20 * time.Millisecond)
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprint(w, r.URL.Path)
+	})
+
+	urls := []string{}
+	for i := range 6 {
+		urls = append(urls, fmt.Sprintf("%s/page/%v", server.URL, i))
+	}
+	urls = append(urls, "ftp://example.com/file")
+
+	f := &Fetcher{Jobs: 6, PerHost: 2}
+	results := f.FetchAll(context.Background(), urls)
+	for i, result := range results[:6] {
+		if result.Err != nil {
+			t.Errorf("%s: %v", result.URL, result.Err)
+		}
+		if expected := fmt.Sprintf("/page/%v", i); result.HTML != expected {
+			t.Errorf("expected results in the same order as the URLs; result %v is %q", i, result.HTML)
+		}
+	}
+	if results[6].Err == nil {
+		t.Error("expected an error for an unsupported URL scheme")
+	}
+	if n := maxInFlight.Load(); n > 2 {
+		t.Errorf("expected at most 2 requests to the host at a time, got %v", n)
+	}
+}
+
+func TestFetchRobotsRedirect(t *testing.T) {
+	// sites that send unknown paths to their homepage redirect robots.txt too
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/robots.txt":
+			http.Redirect(w, r, "/", http.StatusFound)
+		case "/moved":
+			http.Redirect(w, r, "/page", http.StatusFound)
+		default:
+			w.Header().Set("Content-Type", "text/html")
+			fmt.Fprint(w, "<html><body>ok</body></html>")
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	f := &Fetcher{MaxRedirects: 3}
+	done := make(chan error)
+	go func() {
+		for _, path := range []string{"/page", "/moved", "/page"} {
+			if _, err := f.Fetch(context.Background(), server.URL+path); err != nil {
+				done <- fmt.Errorf("%s: %w", path, err)
+				return
+			}
+		}
+		done <- nil
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Error(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("fetching hung on a redirected robots.txt")
+	}
+}
+
+func TestFetchRedirectPerHost(t *testing.T) {
+	var inFlight, maxInFlight atomic.Int32
+	var mutex sync.Mutex
+	target, _ := newSiteServer(t, "", func(w http.ResponseWriter, r *http.Request) {
+		n := inFlight.Add(1)
+		defer inFlight.Add(-1)
+		mutex.Lock()
+		if n > maxInFlight.Load() {
+			maxInFlight.Store(n)
+		}
+		mutex.Unlock()
+		time.Sleep(20 * time.Millisecond)
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprint(w, r.URL.Path)
+	})
+	redirector, _ := newSiteServer(t, "", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, target.URL+r.URL.Path, http.StatusFound)
+	})
+
+	// half of the pages are fetched from the target directly, the other half through a redirect from another host
+	urls := []string{}
+	for i := range 6 {
+		server := target
+		if i%2 == 1 {
+			server = redirector
+		}
+		urls = append(urls, fmt.Sprintf("%s/page/%v", server.URL, i))
+	}
+	f := &Fetcher{Jobs: 6, PerHost: 1, MaxRedirects: 1}
+	for _, result := range f.FetchAll(context.Background(), urls) {
+		if result.Err != nil {
+			t.Errorf("%s: %v", result.URL, result.Err)
+		}
+	}
+	if n := maxInFlight.Load(); n > 1 {
+		t.Errorf("expected at most 1 request to the redirect target at a time, got %v", n)
+	}
+}
+
+func TestFetchUnsupportedContentTypeNotDownloaded(t *testing.T) {
+	// the body never ends, so the fetch only returns if it doesn't try to read it
+	server, _ := newSiteServer(t, "", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/pdf")
+		w.Write([]byte("%PDF-1.7\n"))
+		w.(http.Flusher).Flush()
+		select {
+		case <-r.Context().Done():
+		case <-time.After(5 * time.Second):
+		}
+	})
+
+	start := time.Now()
+	_, err := (&Fetcher{}).Fetch(context.Background(), server.URL+"/doc.pdf")
+	if err == nil || !strings.Contains(err.Error(), "unsupported content type") {
+		t.Errorf("expected an unsupported content type error, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("expected the page not to be downloaded, but the fetch took %v", elapsed)
+	}
+}
@@ -1,6 +1,8 @@
 package websearch
 
 import (
+	"regexp"
+	"slices"
 	"strings"
 
 	"golang.org/x/net/html"
@@ -60,6 +62,8 @@ func extractTextFromNode(n *html.Node) string {
 	return strings.TrimSpace(buf.String())
 }
 
+// extractBodyText gives the readable text of a page's main content, without the navigation, footers,
+// cookie banners, comment sections and other boilerplate around it. Headings are kept on their own lines.
 func extractBodyText(s string) (string, error) {
 	doc, err := html.Parse(strings.NewReader(s))
 	if err != nil {
@@ -72,27 +76,414 @@ func extractBodyText(s string) (string, error) {
 		return "", nil // not found
 	}
 
-	cleanHTML(bodyNode)
+	return extractContentText(extractMainContent(bodyNode)), nil
+}
+
+// elements that never have readable content
+var nonContentTags = []string{"script", "style", "noscript", "template", "meta", "link", "svg", "canvas", "iframe", "button", "input", "select", "textarea", "nav", "aside", "footer"}
+
+// ARIA roles of elements around the content, rather than the content itself
+var nonContentRoles = []string{"navigation", "banner", "complementary", "contentinfo", "dialog", "alertdialog", "menu", "menubar", "search"}
+
+var (
+	// class names and ids of elements that are unlikely to be the content (e.g. sidebars and cookie banners)
+	unlikelyCandidateRegex = regexp.MustCompile(`(?i)-ad-|ai2html|banner|breadcrumbs|combx|comment|community|cover-wrap|disqus|extra|footer|gdpr|header|legends|menu|related|remark|replies|rss|shoutbox|sidebar|skyscraper|social|sponsor|supplemental|ad-break|agegate|pagination|pager|popup|yom-remote|cookie|consent|newsletter|subscribe|share|promo|signup`)
+	// ... unless they also look like they could be the content
+	maybeCandidateRegex = regexp.MustCompile(`(?i)article|column|content|main|shadow`)
+	// class names and ids that make an element more or less likely to be the content
+	positiveRegex    = regexp.MustCompile(`(?i)article|body|content|entry|hentry|h-entry|main|page|post|text|blog|story`)
+	negativeRegex    = regexp.MustCompile(`(?i)-ad-|hidden|^hid$|banner|combx|comment|com-|contact|foot|footnote|gdpr|masthead|media|meta|outbrain|promo|related|scroll|share|shoutbox|sidebar|skyscraper|sponsor|shopping|tags|tool|widget|cookie|consent|newsletter`)
+	hiddenStyleRegex = regexp.MustCompile(`(?i)display\s*:\s*none|visibility\s*:\s*hidden`)
+)
+
+// elements whose text is scored as a paragraph of the content
+var paragraphTags = []string{"p", "pre", "td", "blockquote"}
 
-	return extractTextFromNode(bodyNode), nil
+// elements that start a new block of text
+var blockTags = []string{
+	"address", "article", "blockquote", "dd", "div", "dl", "dt", "figcaption", "figure", "form", "h1", "h2", "h3", "h4", "h5", "h6",
+	"header", "hr", "li", "main", "ol", "p", "pre", "section", "table", "tbody", "thead", "tr", "td", "th", "ul",
 }
 
-func removeHTMLTag(n *html.Node, tagName string) {
+var headingTags = []string{"h1", "h2", "h3", "h4", "h5", "h6"}
+
+// extractMainContent finds the part of the page (under root, usually the body) that has its main content, the way
+// browsers' reader modes do. root is cleaned of non-content elements in the process.
+//
+// Each paragraph adds to the score of the elements around it, by how much text it has. Elements are scored higher
+// for being an <article> or <main>, or having class names like "content", and lower for class names like "sidebar",
+// or for having most of their text in links. The best scoring element is the content, along with any siblings
+// that look like they're part of it.
+func extractMainContent(root *html.Node) *html.Node {
+	cleanHTML(root)
+
+	scores := scoreCandidates(root)
+	var top *html.Node
+	// in document order, so ties go to the outermost element
+	for _, n := range findAllElements(root, func(n *html.Node) bool { _, ok := scores[n]; return ok }) {
+		if top == nil || scores[n] > scores[top] {
+			top = n
+		}
+	}
+	if top == nil {
+		return root
+	}
+
+	content := top
+	if top != root && top.Parent != nil {
+		content = &html.Node{Type: html.ElementNode, Data: "div"}
+		threshold := max(10, scores[top]*0.2)
+		for sibling := top.Parent.FirstChild; sibling != nil; {
+			next := sibling.NextSibling
+			if sibling == top || isContentSibling(sibling, top, scores, threshold) {
+				sibling.Parent.RemoveChild(sibling)
+				content.AppendChild(sibling)
+			}
+			sibling = next
+		}
+	}
+	cleanConditionally(content)
+	return content
+}
+
+// cleanHTML removes the elements that aren't part of the page's content: scripts, form controls, navigation,
+// hidden elements, and elements with class names or ids like "sidebar" or "cookie-banner".
+func cleanHTML(n *html.Node) {
 	for c := n.FirstChild; c != nil; {
 		next := c.NextSibling
-		if c.Type == html.ElementNode && c.Data == tagName {
+		if c.Type == html.CommentNode || (c.Type == html.ElementNode && isNonContent(c)) {
 			n.RemoveChild(c)
 		} else {
-			removeHTMLTag(c, tagName)
+			cleanHTML(c)
 		}
 		c = next
 	}
 }
 
-func cleanHTML(n *html.Node) {
-	removeTags := []string{"style", "script", "meta", "link", "svg", "header", "iframe", "button", "h1", "h2"}
+func isNonContent(n *html.Node) bool {
+	if slices.Contains(nonContentTags, n.Data) || slices.Contains(nonContentRoles, getAttr(n, "role")) {
+		return true
+	}
+	if hasAttr(n, "hidden") || getAttr(n, "aria-hidden") == "true" || hiddenStyleRegex.MatchString(getAttr(n, "style")) {
+		return true
+	}
+	// the page's header (but not an article's header, which usually has its title)
+	if n.Data == "header" && !hasAncestor(n, "article", "main") {
+		return true
+	}
+	switch n.Data {
+	case "html", "body", "article", "main", "a", "table", "tbody", "tr", "td", "th":
+		return false
+	}
+	match := getAttr(n, "class") + " " + getAttr(n, "id")
+	return unlikelyCandidateRegex.MatchString(match) && !maybeCandidateRegex.MatchString(match)
+}
 
-	for _, tag := range removeTags {
-		removeHTMLTag(n, tag)
+// scoreCandidates scores the elements that could hold the page's content
+func scoreCandidates(root *html.Node) map[*html.Node]float64 {
+	scores := map[*html.Node]float64{}
+	for _, p := range findAllElements(root, isParagraph) {
+		text := normalizeSpace(extractTextFromNode(p))
+		if len(text) < 25 {
+			continue
+		}
+		// a point for the paragraph, for each comma, and for each 100 characters (up to 3)
+		score := 1 + float64(strings.Count(text, ",")) + min(float64(len(text)/100), 3)
+
+		// the paragraph's parent gets its full score, and elements further up less and less of it
+		level := 0
+		for a := p.Parent; a != nil && a.Type == html.ElementNode && level < 5; a = a.Parent {
+			if _, ok := scores[a]; !ok {
+				scores[a] = initialScore(a)
+			}
+			divider := 1.0
+			if level == 1 {
+				divider = 2
+			} else if level > 1 {
+				divider = float64(level * 3)
+			}
+			scores[a] += score / divider
+			if a == root {
+				break
+			}
+			level++
+		}
+	}
+	for n := range scores {
+		scores[n] *= 1 - linkDensity(n)
+	}
+	return scores
+}
+
+// initialScore gives the score of an element before its paragraphs are counted
+func initialScore(n *html.Node) float64 {
+	score := float64(classWeight(n))
+	switch n.Data {
+	case "article", "main":
+		score += 25
+	case "div":
+		score += 5
+	case "pre", "td", "blockquote":
+		score += 3
+	case "address", "ol", "ul", "dl", "dd", "dt", "li", "form":
+		score -= 3
+	case "h1", "h2", "h3", "h4", "h5", "h6", "th":
+		score -= 5
+	}
+	if getAttr(n, "role") == "main" {
+		score += 25
+	}
+	return score
+}
+
+// classWeight weighs an element's class name and id by how much they suggest it's the content
+func classWeight(n *html.Node) int {
+	weight := 0
+	for _, attr := range []string{getAttr(n, "class"), getAttr(n, "id")} {
+		if attr == "" {
+			continue
+		}
+		if negativeRegex.MatchString(attr) {
+			weight -= 25
+		}
+		if positiveRegex.MatchString(attr) {
+			weight += 25
+		}
+	}
+	return weight
+}
+
+// linkDensity gives how much of an element's text is in links, from 0 to 1. Links within the page count less.
+func linkDensity(n *html.Node) float64 {
+	textLength := len(normalizeSpace(extractTextFromNode(n)))
+	if textLength == 0 {
+		return 0
+	}
+	linkLength := 0.0
+	for _, a := range findAllElements(n, func(n *html.Node) bool { return n.Data == "a" }) {
+		coefficient := 1.0
+		if strings.HasPrefix(getAttr(a, "href"), "#") {
+			coefficient = 0.3
+		}
+		linkLength += float64(len(normalizeSpace(extractTextFromNode(a)))) * coefficient
+	}
+	return min(linkLength/float64(textLength), 1)
+}
+
+// isParagraph reports if an element is a paragraph of text: a paragraph element, or a div or section with only inline content
+func isParagraph(n *html.Node) bool {
+	if slices.Contains(paragraphTags, n.Data) {
+		return true
+	}
+	if n.Data != "div" && n.Data != "section" {
+		return false
+	}
+	return len(findAllElements(n, func(c *html.Node) bool { return c != n && slices.Contains(blockTags, c.Data) })) == 0
+}
+
+// isContentSibling reports if a sibling of the top scoring element looks like it's also part of the content
+func isContentSibling(sibling *html.Node, top *html.Node, scores map[*html.Node]float64, threshold float64) bool {
+	if sibling.Type != html.ElementNode {
+		return false
+	}
+	bonus := 0.0
+	if class := getAttr(top, "class"); class != "" && getAttr(sibling, "class") == class {
+		bonus = scores[top] * 0.2
+	}
+	if score, ok := scores[sibling]; ok && score+bonus >= threshold {
+		return true
+	}
+	if sibling.Data != "p" {
+		return false
+	}
+	text := normalizeSpace(extractTextFromNode(sibling))
+	density := linkDensity(sibling)
+	if len(text) > 80 {
+		return density < 0.25
+	}
+	return len(text) > 0 && density == 0 && strings.HasSuffix(text, ".")
+}
+
+// cleanConditionally removes the elements within the content that look like boilerplate:
+// lists of links, elements with class names like "share", and elements that are mostly form controls or images.
+func cleanConditionally(content *html.Node) {
+	for c := content.FirstChild; c != nil; {
+		next := c.NextSibling
+		if c.Type == html.ElementNode {
+			if isBoilerplate(c) {
+				content.RemoveChild(c)
+			} else {
+				cleanConditionally(c)
+			}
+		}
+		c = next
+	}
+}
+
+func isBoilerplate(n *html.Node) bool {
+	weight := classWeight(n)
+	if slices.Contains(headingTags, n.Data) {
+		return weight < 0
+	}
+	if !slices.Contains([]string{"div", "section", "ul", "ol", "form", "table"}, n.Data) {
+		return false
+	}
+	if weight < 0 {
+		return true
+	}
+	text := normalizeSpace(extractTextFromNode(n))
+	// long paragraphs of text are content
+	if strings.Count(text, ",") >= 10 {
+		return false
+	}
+	countTags := func(tags ...string) int {
+		return len(findAllElements(n, func(c *html.Node) bool { return slices.Contains(tags, c.Data) }))
+	}
+	paragraphs, images, listItems, inputs := countTags("p"), countTags("img"), countTags("li"), countTags("input")
+	isList := n.Data == "ul" || n.Data == "ol"
+	density := linkDensity(n)
+	switch {
+	case n.Data == "table":
+		// tables of data are content; only lay-out tables full of links aren't
+		return density > 0.5
+	case images > 1 && float64(paragraphs)/float64(images) < 0.5 && !hasAncestor(n, "figure"):
+		return true
+	case !isList && listItems > paragraphs+100:
+		return true
+	case float64(inputs) > float64(paragraphs)/3:
+		return true
+	case !isList && len(text) < 25 && (images == 0 || images > 2) && density > 0:
+		return true
+	case weight < 25 && density > 0.2:
+		return true
+	case weight >= 25 && density > 0.5:
+		return true
+	}
+	return false
+}
+
+// extractContentText gives the text under n, with a line for each block of text (paragraph, heading, list item, etc.)
+func extractContentText(n *html.Node) string {
+	lines := []string{}
+	var line strings.Builder
+	flush := func() {
+		if text := normalizeSpace(line.String()); text != "" {
+			lines = append(lines, text)
+		}
+		line.Reset()
+	}
+	var f func(*html.Node)
+	f = func(n *html.Node) {
+		switch {
+		case n.Type == html.TextNode:
+			line.WriteString(n.Data)
+			return
+		case n.Type == html.ElementNode && n.Data == "br":
+			flush()
+			return
+		case n.Type == html.ElementNode && n.Data == "pre":
+			// keep the formatting of code
+			flush()
+			if text := strings.Trim(extractTextFromNode(n), "\n"); text != "" {
+				lines = append(lines, text)
+			}
+			return
+		}
+		block := n.Type == html.ElementNode && slices.Contains(blockTags, n.Data)
+		if block {
+			flush()
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			f(c)
+		}
+		if block {
+			flush()
+		}
+	}
+	f(n)
+	flush()
+	return strings.Join(lines, "\n")
+}
+
+// getAttr gives the value of an attribute of a node, or "" if it doesn't have it
+func getAttr(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+// hasClass reports if an element has the given class
+func hasClass(n *html.Node, class string) bool {
+	if n.Type != html.ElementNode {
+		return false
+	}
+	for _, c := range strings.Fields(getAttr(n, "class")) {
+		if c == class {
+			return true
+		}
+	}
+	return false
+}
+
+// findAllNodes finds all nodes under n (including n itself) that match, in document order.
+// The nodes under a match aren't searched.
+func findAllNodes(n *html.Node, match func(*html.Node) bool) []*html.Node {
+	if match(n) {
+		return []*html.Node{n}
+	}
+	found := []*html.Node{}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		found = append(found, findAllNodes(c, match)...)
+	}
+	return found
+}
+
+// findByClass finds the first element under n (including n itself) with the given class
+func findByClass(n *html.Node, class string) *html.Node {
+	found := findAllNodes(n, func(n *html.Node) bool { return hasClass(n, class) })
+	if len(found) == 0 {
+		return nil
+	}
+	return found[0]
+}
+
+// normalizeSpace collapses all whitespace in s into single spaces
+func normalizeSpace(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// hasAttr reports if a node has an attribute, even an empty one
+func hasAttr(n *html.Node, key string) bool {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return true
+		}
+	}
+	return false
+}
+
+// hasAncestor reports if any of the elements around n is one of the given tags
+func hasAncestor(n *html.Node, tags ...string) bool {
+	for a := n.Parent; a != nil; a = a.Parent {
+		if a.Type == html.ElementNode && slices.Contains(tags, a.Data) {
+			return true
+		}
+	}
+	return false
+}
+
+// findAllElements finds all elements under n (including n itself) that match, in document order.
+// Unlike findAllNodes, the elements under a match are searched too.
+func findAllElements(n *html.Node, match func(*html.Node) bool) []*html.Node {
+	found := []*html.Node{}
+	if n.Type == html.ElementNode && match(n) {
+		found = append(found, n)
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		found = append(found, findAllElements(c, match)...)
 	}
+	return found
 }
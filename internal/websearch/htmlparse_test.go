@@ -0,0 +1,106 @@
+package websearch
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+const articleTestPage = `<!DOCTYPE html>
+<html>
+<head><title>Why Go? | The Example Blog</title><style>body { color: red; }</style></head>
+<body>
+<header class="site-header">
+  <a href="/">The Example Blog</a>
+  <nav><ul><li><a href="/">Home</a></li><li><a href="/about">About</a></li><li><a href="/archive">Archive</a></li></ul></nav>
+</header>
+<div id="cookie-banner">We use cookies to improve your experience. By continuing to browse, you agree to our use of cookies. <a href="/privacy">Privacy policy</a></div>
+<div class="layout">
+  <div class="main-column">
+    <article class="post">
+      <h1>Why we moved our services to Go</h1>
+      <p class="byline">By Jane Doe</p>
+      <div class="post-content">
+        <p>Last year, our team rewrote most of our backend services in Go, after years of running them on a mix of Python and Java.</p>
+        <p>The biggest win was deployment: a single static binary, with no runtime to install, made our containers smaller, our builds faster, and our on-call rotations quieter.</p>
+        <h2>Concurrency</h2>
+        <p>Goroutines and channels let us replace a tangle of thread pools, callbacks, and queues with code that reads top to bottom, which made reviews much easier.</p>
+        <pre>go func() {
+	results &lt;- fetch(url)
+}()</pre>
+        <div class="share-buttons"><a href="https://twitter.com/share">Share on Twitter</a> <a href="https://facebook.com/share">Share on Facebook</a></div>
+      </div>
+    </article>
+    <section id="comments">
+      <h3>3 Comments</h3>
+      <div class="comment"><p>Great post, thanks for sharing your experience with the migration, it was really helpful!</p></div>
+      <div class="comment"><p>Did you consider Rust? We went with it for similar reasons, and it worked well for us too.</p></div>
+    </section>
+  </div>
+  <div class="sidebar">
+    <h3>Related posts</h3>
+    <ul>
+      <li><a href="/posts/1">Ten things we learned about Kubernetes, the hard way</a></li>
+      <li><a href="/posts/2">How we cut our cloud bill in half, with one weird trick</a></li>
+    </ul>
+  </div>
+</div>
+<footer><p>Copyright 2025 The Example Blog, all rights reserved. Powered by a static site generator.</p></footer>
+<script>trackPageView();</script>
+</body>
+</html>`
+
+func TestExtractBodyText(t *testing.T) {
+	text, err := extractBodyText(articleTestPage)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		"Why we moved our services to Go",
+		"Last year, our team rewrote most of our backend services in Go",
+		"The biggest win was deployment",
+		"Concurrency",
+		"Goroutines and channels",
+		"results <- fetch(url)",
+	}
+	for _, s := range expected {
+		if !strings.Contains(text, s) {
+			t.Errorf("expected the content to have %q, got:\n%s", s, text)
+		}
+	}
+	unexpected := []string{"Archive", "cookies", "Share on Twitter", "Comments", "Rust", "Related posts", "Kubernetes", "Copyright", "trackPageView", "color: red"}
+	for _, s := range unexpected {
+		if strings.Contains(text, s) {
+			t.Errorf("expected the content not to have %q, got:\n%s", s, text)
+		}
+	}
+
+	// headings and paragraphs are on their own lines
+	lines := strings.Split(text, "\n")
+	if !slices.Contains(lines, "Concurrency") || !slices.Contains(lines, "Why we moved our services to Go") {
+		t.Errorf("expected headings on their own lines, got:\n%s", text)
+	}
+}
+
+func TestExtractBodyTextWithoutArticle(t *testing.T) {
+	// pages without any structure still give their text
+	text, err := extractBodyText(`<html><body>
+		<div><a href="/">Home</a> | <a href="/contact">Contact</a></div>
+		<p>This is a short page with a single paragraph of text, and not much else on it.</p>
+	</body></html>`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if text != "This is a short page with a single paragraph of text, and not much else on it." {
+		t.Errorf("unexpected content: %q", text)
+	}
+
+	text, err = extractBodyText(`<html><body><h1>Hello</h1><p>Hi!</p></body></html>`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if text != "Hello\nHi!" {
+		t.Errorf("unexpected content: %q", text)
+	}
+}
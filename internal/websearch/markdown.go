@@ -0,0 +1,351 @@
+package websearch
+
+import (
+	"fmt"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// extractMarkdown gives the main content of a page (see extractMainContent) as Markdown.
+// Relative links and images are resolved against pageURL.
+func extractMarkdown(rawHTML string, pageURL string) (string, error) {
+	doc, err := html.Parse(strings.NewReader(rawHTML))
+	if err != nil {
+		return "", err
+	}
+	bodyNode := findNode(doc, "body")
+	if bodyNode == nil {
+		return "", nil // not found
+	}
+	base, err := url.Parse(pageURL)
+	if err != nil {
+		base = nil
+	}
+	return toMarkdown(extractMainContent(bodyNode), base), nil
+}
+
+// toMarkdown converts the HTML under n to Markdown, keeping its headings, lists, tables, code blocks, quotes and links.
+// If base is set, relative links are resolved against it.
+func toMarkdown(n *html.Node, base *url.URL) string {
+	m := markdownWriter{base: base}
+	return strings.Join(m.blocks(n), "\n\n")
+}
+
+type markdownWriter struct {
+	base *url.URL
+}
+
+// blocks renders the children of n as Markdown blocks (paragraphs, headings, lists, etc.)
+func (m *markdownWriter) blocks(n *html.Node) []string {
+	blocks := []string{}
+	var inline strings.Builder
+	add := func(block string) {
+		if block != "" {
+			blocks = append(blocks, block)
+		}
+	}
+	// inline content between blocks makes up a paragraph
+	flush := func() {
+		add(paragraph(inline.String()))
+		inline.Reset()
+	}
+
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type != html.ElementNode {
+			inline.WriteString(m.inline(c))
+			continue
+		}
+		if !slices.Contains(blockTags, c.Data) {
+			inline.WriteString(m.inline(c))
+			continue
+		}
+		flush()
+		switch c.Data {
+		case "h1", "h2", "h3", "h4", "h5", "h6":
+			if text := normalizeSpace(m.inline(c)); text != "" {
+				level, _ := strconv.Atoi(c.Data[1:])
+				add(strings.Repeat("#", level) + " " + text)
+			}
+		case "p":
+			add(paragraph(m.inline(c)))
+		case "pre":
+			add(codeBlock(c))
+		case "ul", "ol":
+			add(m.list(c))
+		case "blockquote":
+			add(prefixLines(strings.Join(m.blocks(c), "\n\n"), "> ", ">"))
+		case "table":
+			blocks = append(blocks, m.table(c)...)
+		case "hr":
+			add("---")
+		case "dt":
+			if text := normalizeSpace(m.inline(c)); text != "" {
+				add("**" + text + "**")
+			}
+		default:
+			blocks = append(blocks, m.blocks(c)...)
+		}
+	}
+	flush()
+	return blocks
+}
+
+// inline renders n as inline Markdown (text, links, emphasis and code)
+func (m *markdownWriter) inline(n *html.Node) string {
+	switch n.Type {
+	case html.TextNode:
+		return collapseSpace(n.Data)
+	case html.ElementNode:
+	default:
+		return m.inlineChildren(n)
+	}
+
+	switch n.Data {
+	case "br":
+		return "\n"
+	case "a":
+		text := m.inlineChildren(n)
+		href := m.resolve(getAttr(n, "href"))
+		if strings.TrimSpace(text) == "" || href == "" {
+			return text
+		}
+		return wrapInline(text, "[", "]("+href+")")
+	case "strong", "b":
+		return wrapInline(m.inlineChildren(n), "**", "**")
+	case "em", "i":
+		return wrapInline(m.inlineChildren(n), "*", "*")
+	case "del", "s", "strike":
+		return wrapInline(m.inlineChildren(n), "~~", "~~")
+	case "code", "kbd", "samp", "tt":
+		return inlineCode(normalizeSpace(rawText(n)))
+	case "img":
+		alt := normalizeSpace(getAttr(n, "alt"))
+		src := m.resolve(getAttr(n, "src"))
+		if alt == "" || src == "" {
+			return ""
+		}
+		return fmt.Sprintf("![%s](%s)", alt, src)
+	}
+	text := m.inlineChildren(n)
+	// block elements within inline content (e.g. a div inside a link) are still separate words
+	if slices.Contains(blockTags, n.Data) {
+		return " " + text + " "
+	}
+	return text
+}
+
+func (m *markdownWriter) inlineChildren(n *html.Node) string {
+	var sb strings.Builder
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		sb.WriteString(m.inline(c))
+	}
+	return sb.String()
+}
+
+// list renders a ul or ol element. Nested lists are indented under their item.
+func (m *markdownWriter) list(n *html.Node) string {
+	number := 1
+	if start, err := strconv.Atoi(getAttr(n, "start")); err == nil {
+		number = start
+	}
+	items := []string{}
+	for li := n.FirstChild; li != nil; li = li.NextSibling {
+		if li.Type != html.ElementNode || li.Data != "li" {
+			continue
+		}
+		marker := "- "
+		if n.Data == "ol" {
+			marker = fmt.Sprintf("%v. ", number)
+			number++
+		}
+		body := strings.Join(m.blocks(li), "\n")
+		if body == "" {
+			continue
+		}
+		items = append(items, marker+prefixLines(body, strings.Repeat(" ", len(marker)), "")[len(marker):])
+	}
+	return strings.Join(items, "\n")
+}
+
+// table renders a table as a GitHub Flavored Markdown table, with its first row as the header.
+// Tables with only a single column are only used for layout, so their cells are rendered as blocks instead.
+func (m *markdownWriter) table(n *html.Node) []string {
+	// rows of nested tables are within a row of this one, so they aren't found here
+	rows := findAllNodes(n, func(c *html.Node) bool { return c.Type == html.ElementNode && c.Data == "tr" })
+	cells := [][]*html.Node{}
+	columns := 0
+	for _, row := range rows {
+		rowCells := []*html.Node{}
+		for c := row.FirstChild; c != nil; c = c.NextSibling {
+			if c.Type == html.ElementNode && (c.Data == "td" || c.Data == "th") {
+				rowCells = append(rowCells, c)
+			}
+		}
+		if len(rowCells) > 0 {
+			cells = append(cells, rowCells)
+			columns = max(columns, len(rowCells))
+		}
+	}
+	if columns <= 1 {
+		blocks := []string{}
+		for _, row := range cells {
+			for _, cell := range row {
+				blocks = append(blocks, m.blocks(cell)...)
+			}
+		}
+		return blocks
+	}
+
+	lines := []string{}
+	for i, row := range cells {
+		texts := make([]string, columns)
+		for j, cell := range row {
+			text := normalizeSpace(m.inline(cell))
+			texts[j] = strings.ReplaceAll(text, "|", `\|`)
+		}
+		lines = append(lines, "| "+strings.Join(texts, " | ")+" |")
+		if i == 0 {
+			lines = append(lines, "|"+strings.Repeat(" --- |", columns))
+		}
+	}
+	return []string{strings.Join(lines, "\n")}
+}
+
+// resolve gives the URL of a link, relative to the page. Links that can't be followed (e.g. javascript: or to
+// a part of the same page) give "".
+func (m *markdownWriter) resolve(href string) string {
+	href = strings.TrimSpace(href)
+	if href == "" || strings.HasPrefix(href, "#") {
+		return ""
+	}
+	u, err := url.Parse(href)
+	if err != nil || u.Scheme == "javascript" {
+		return ""
+	}
+	if m.base != nil {
+		u = m.base.ResolveReference(u)
+	}
+	return u.String()
+}
+
+// codeBlock renders a pre element as a fenced code block, with the language from a "language-go" style class name
+func codeBlock(n *html.Node) string {
+	code := strings.Trim(rawText(n), "\n")
+	if strings.TrimSpace(code) == "" {
+		return ""
+	}
+	lang := codeLanguage(n)
+	if lang == "" {
+		if c := findNode(n, "code"); c != nil {
+			lang = codeLanguage(c)
+		}
+	}
+	fence := "```"
+	if strings.Contains(code, "```") {
+		fence = "~~~"
+	}
+	return fence + lang + "\n" + code + "\n" + fence
+}
+
+func codeLanguage(n *html.Node) string {
+	for _, class := range strings.Fields(getAttr(n, "class")) {
+		for _, prefix := range []string{"language-", "lang-"} {
+			if strings.HasPrefix(class, prefix) {
+				return strings.TrimPrefix(class, prefix)
+			}
+		}
+	}
+	return ""
+}
+
+// inlineCode renders code in backticks, with more of them if the code has any itself
+func inlineCode(code string) string {
+	if code == "" {
+		return ""
+	}
+	fence := "`"
+	for strings.Contains(code, fence) {
+		fence += "`"
+	}
+	if strings.HasPrefix(code, "`") || strings.HasSuffix(code, "`") {
+		code = " " + code + " "
+	}
+	return fence + code + fence
+}
+
+// rawText gives the text under n as-is, without collapsing its whitespace
+func rawText(n *html.Node) string {
+	if n.Type == html.TextNode {
+		return n.Data
+	}
+	var sb strings.Builder
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type == html.ElementNode && c.Data == "br" {
+			sb.WriteString("\n")
+			continue
+		}
+		sb.WriteString(rawText(c))
+	}
+	return sb.String()
+}
+
+// wrapInline puts Markdown syntax around inline text, keeping the spaces around it outside (e.g. "** bold**" isn't bold)
+func wrapInline(text string, before string, after string) string {
+	trimmed := strings.TrimSpace(text)
+	if trimmed == "" {
+		return text
+	}
+	leading := text[:len(text)-len(strings.TrimLeft(text, " \n"))]
+	trailing := text[len(strings.TrimRight(text, " \n")):]
+	return leading + before + trimmed + after + trailing
+}
+
+// paragraph tidies up the inline content of a paragraph: line breaks are kept, but other whitespace is collapsed
+func paragraph(text string) string {
+	lines := []string{}
+	for _, line := range strings.Split(text, "\n") {
+		if line = normalizeSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	// two spaces at the end of a line make a line break
+	return strings.Join(lines, "  \n")
+}
+
+// prefixLines puts a prefix before each line of text, or emptyPrefix before empty lines
+func prefixLines(text string, prefix string, emptyPrefix string) string {
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		if line == "" {
+			lines[i] = emptyPrefix
+		} else {
+			lines[i] = prefix + line
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// collapseSpace collapses each run of whitespace in s into a single space, keeping a space at either end
+func collapseSpace(s string) string {
+	var sb strings.Builder
+	space := false
+	for _, r := range s {
+		if r == ' ' || r == '\t' || r == '\n' || r == '\r' || r == '\f' {
+			space = true
+			continue
+		}
+		if space {
+			sb.WriteByte(' ')
+			space = false
+		}
+		sb.WriteRune(r)
+	}
+	if space {
+		sb.WriteByte(' ')
+	}
+	return sb.String()
+}
@@ -0,0 +1,86 @@
+package websearch
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/html"
+)
+
+func markdownOf(t *testing.T, fragment string) string {
+	t.Helper()
+	doc, err := html.Parse(strings.NewReader("<html><body>" + fragment + "</body></html>"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	base, _ := url.Parse("https://example.com/docs/page.html")
+	return toMarkdown(findNode(doc, "body"), base)
+}
+
+func TestToMarkdown(t *testing.T) {
+	tests := []struct {
+		name     string
+		html     string
+		expected string
+	}{
+		{
+			name:     "headings and paragraphs",
+			html:     "<h1>Title</h1>\n<p>Some   <b>bold</b>,\n<em>emphasized </em>and <code>inline()</code> text.</p><h3>Section</h3><p>Line one<br>line two</p>",
+			expected: "# Title\n\nSome **bold**, *emphasized* and `inline()` text.\n\n### Section\n\nLine one  \nline two",
+		},
+		{
+			name:     "links",
+			html:     `<p>See <a href="../guide.html">the guide</a>, <a href="https://go.dev/">Go</a>, <a href="#top">the top</a> or <a href="javascript:void(0)">nothing</a>.</p>`,
+			expected: "See [the guide](https://example.com/guide.html), [Go](https://go.dev/), the top or nothing.",
+		},
+		{
+			name:     "lists",
+			html:     `<ul><li>one</li><li>two<ul><li>two and a half</li></ul></li></ul><ol start="3"><li>three</li><li><p>four</p></li></ol>`,
+			expected: "- one\n- two\n  - two and a half\n\n3. three\n4. four",
+		},
+		{
+			name:     "code blocks",
+			html:     "<pre><code class=\"language-go\">func main() {\n\tfmt.Println(\"hi\")\n}\n</code></pre><p>Use <code>a `b` c</code>.</p>",
+			expected: "```go\nfunc main() {\n\tfmt.Println(\"hi\")\n}\n```\n\nUse ``a `b` c``.",
+		},
+		{
+			name:     "tables",
+			html:     `<table><thead><tr><th>Name</th><th>Type</th></tr></thead><tbody><tr><td>count</td><td><code>int</code></td></tr><tr><td>a|b</td><td>string</td></tr></tbody></table>`,
+			expected: "| Name | Type |\n| --- | --- |\n| count | `int` |\n| a\\|b | string |",
+		},
+		{
+			name:     "layout tables",
+			html:     `<table><tr><td><p>Just some content</p></td></tr></table>`,
+			expected: "Just some content",
+		},
+		{
+			name:     "quotes and images",
+			html:     `<blockquote><p>First</p><p>Second</p></blockquote><hr><img src="/img/gopher.png" alt="Gopher"><img src="/spacer.gif">`,
+			expected: "> First\n>\n> Second\n\n---\n\n![Gopher](https://example.com/img/gopher.png)",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if md := markdownOf(t, tt.html); md != tt.expected {
+				t.Errorf("expected:\n%s\n\ngot:\n%s", tt.expected, md)
+			}
+		})
+	}
+}
+
+func TestExtractMarkdown(t *testing.T) {
+	md, err := extractMarkdown(articleTestPage, "https://blog.example.com/posts/why-go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"# Why we moved our services to Go\n\n", "\n\n## Concurrency\n\n", "```\ngo func() {\n\tresults <- fetch(url)\n}()\n```"}
+	for _, s := range expected {
+		if !strings.Contains(md, s) {
+			t.Errorf("expected the Markdown to have %q, got:\n%s", s, md)
+		}
+	}
+	if strings.Contains(md, "Share on Twitter") || strings.Contains(md, "Related posts") {
+		t.Errorf("expected only the main content, got:\n%s", md)
+	}
+}
@@ -0,0 +1,137 @@
+package websearch
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/webbben/caius/internal/config"
+)
+
+// SearchProvider is a web search backend.
+type SearchProvider interface {
+	// Name is a short identifier for the backend, e.g. "brave"
+	Name() string
+	// Search finds websites that match the query, best matches first.
+	Search(ctx context.Context, query string, opts SearchOptions) ([]Website, error)
+}
+
+// SearchOptions narrows down a search. Zero values leave it up to the provider.
+type SearchOptions struct {
+	Count     int    // number of results to give; defaults to DefaultResultCount
+	Country   string // two-letter country code to get results for, e.g. "us"
+	Language  string // two-letter code of the language results should be in, e.g. "en"
+	Freshness string // only give results from the past day, week, month or year
+	Page      int    // page of results to give, starting at 0
+}
+
+// DefaultResultCount is the number of results a search gives, if SearchOptions.Count isn't set
+const DefaultResultCount = 5
+
+// Freshnesses are the accepted values of SearchOptions.Freshness
+var Freshnesses = []string{"day", "week", "month", "year"}
+
+// Validate checks that the options make sense, before sending them to a provider.
+func (o SearchOptions) Validate() error {
+	if o.Count < 0 {
+		return fmt.Errorf("invalid result count %v", o.Count)
+	}
+	if o.Page < 0 {
+		return fmt.Errorf("invalid page %v", o.Page)
+	}
+	if o.Country != "" && len(o.Country) != 2 {
+		return fmt.Errorf("invalid country %q (expected a two-letter code, e.g. us)", o.Country)
+	}
+	if o.Language != "" && len(o.Language) != 2 {
+		return fmt.Errorf("invalid language %q (expected a two-letter code, e.g. en)", o.Language)
+	}
+	if o.Freshness != "" && !slices.Contains(Freshnesses, o.Freshness) {
+		return fmt.Errorf("invalid freshness %q (expected one of: %s)", o.Freshness, strings.Join(Freshnesses, ", "))
+	}
+	return nil
+}
+
+func (o SearchOptions) count() int {
+	if o.Count > 0 {
+		return o.Count
+	}
+	return DefaultResultCount
+}
+
+var provider SearchProvider
+var providerMutex sync.RWMutex
+
+// SetProvider changes the backend that WebSearch uses. If it's never set, the backend configured by config.WEBSEARCH_PROVIDER is used.
+func SetProvider(p SearchProvider) {
+	providerMutex.Lock()
+	defer providerMutex.Unlock()
+	provider = p
+}
+
+// GetProvider gives the backend that WebSearch uses.
+func GetProvider() (SearchProvider, error) {
+	providerMutex.RLock()
+	p := provider
+	providerMutex.RUnlock()
+	if p != nil {
+		return p, nil
+	}
+	return ProviderByName(config.WEBSEARCH_PROVIDER)
+}
+
+// ProviderByName resolves a search backend from its name: brave, searxng or duckduckgo.
+//
+// The brave provider reads its API key from BRAVE_SEARCH_API_KEY, and the searxng provider uses the instance at config.SEARXNG_URL.
+func ProviderByName(name string) (SearchProvider, error) {
+	switch name {
+	case "", "brave":
+		return &BraveProvider{APIKey: os.Getenv("BRAVE_SEARCH_API_KEY")}, nil
+	case "searxng":
+		return &SearxngProvider{BaseURL: config.SEARXNG_URL}, nil
+	case "duckduckgo":
+		return &DuckDuckGoProvider{}, nil
+	default:
+		return nil, fmt.Errorf("unknown search provider %q (expected brave, searxng or duckduckgo)", name)
+	}
+}
+
+func httpClient(client *http.Client) *http.Client {
+	if client != nil {
+		return client
+	}
+	return &http.Client{Timeout: 10 * time.Second}
+}
+
+// doSearchRequest sends a request to a search backend, and gives the body of a successful response.
+func doSearchRequest(client *http.Client, req *http.Request, backend string) ([]byte, error) {
+	resp, err := httpClient(client).Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%s: error on requesting search results; %w", backend, err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("%s: error on reading search results; %w", backend, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: HTTP error: %s", backend, resp.Status)
+	}
+	return body, nil
+}
+
+// siteName gives a readable name of the website a URL is on (its host name, without "www.")
+func siteName(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimPrefix(u.Hostname(), "www.")
+}
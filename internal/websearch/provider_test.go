@@ -0,0 +1,244 @@
+package websearch
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/webbben/caius/internal/config"
+)
+
+// newSearchServer starts a local stand-in for a search backend, which replies to every request with the given body
+func newSearchServer(t *testing.T, contentType string, body string, onRequest func(*http.Request)) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if onRequest != nil {
+			onRequest(r)
+		}
+		w.Header().Set("Content-Type", contentType)
+		w.Write([]byte(body))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func checkWebsites(t *testing.T, got []Website, expected []Website) {
+	t.Helper()
+	if len(got) != len(expected) {
+		t.Fatalf("expected %v websites, got %v: %+v", len(expected), len(got), got)
+	}
+	for i := range expected {
+		if got[i] != expected[i] {
+			t.Errorf("website %v: expected %+v, got %+v", i, expected[i], got[i])
+		}
+	}
+}
+
+func TestBraveProvider(t *testing.T) {
+	var got *http.Request
+	server := newSearchServer(t, "application/json", `{
+		"type": "search",
+		"web": {"type": "search", "results": [
+			{"title": "Go", "url": "https://go.dev/", "description": "The <strong>Go</strong> programming language", "profile": {"name": "Go"}}
+		]}
+	}`, func(r *http.Request) { got = r })
+
+	p := &BraveProvider{APIKey: "test-key", BaseURL: server.URL}
+	websites, err := p.Search(context.Background(), "golang", SearchOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkWebsites(t, websites, []Website{
+		{URL: "https://go.dev/", Title: "Go", Description: "The Go programming language", WebsiteName: "Go"},
+	})
+	if got.Header.Get("X-Subscription-Token") != "test-key" || got.URL.Query().Get("q") != "golang" {
+		t.Errorf("unexpected request: %v %v", got.URL, got.Header)
+	}
+
+	if _, err := (&BraveProvider{BaseURL: server.URL}).Search(context.Background(), "golang", SearchOptions{}); err == nil {
+		t.Error("expected an error without an API key")
+	}
+}
+
+func TestSearxngProvider(t *testing.T) {
+	var got *http.Request
+	server := newSearchServer(t, "application/json", `{
+		"query": "golang",
+		"results": [
+			{"url": "https://www.example.com/a", "title": "A", "content": " first result ", "engine": "bing"},
+			{"url": "https://b.example.org/", "title": "B", "content": "second result", "engine": "google"},
+			{"url": "https://c.example.org/", "title": "C", "content": "", "engine": "google"},
+			{"url": "https://d.example.org/", "title": "D", "content": "", "engine": "google"},
+			{"url": "https://e.example.org/", "title": "E", "content": "", "engine": "google"},
+			{"url": "https://f.example.org/", "title": "F", "content": "one too many", "engine": "google"}
+		]
+	}`, func(r *http.Request) { got = r })
+
+	p := &SearxngProvider{BaseURL: server.URL + "/"}
+	websites, err := p.Search(context.Background(), "golang", SearchOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.URL.Path != "/search" || got.URL.Query().Get("format") != "json" || got.URL.Query().Get("q") != "golang" {
+		t.Errorf("unexpected request: %v", got.URL)
+	}
+	if len(websites) != DefaultResultCount {
+		t.Fatalf("expected %v websites, got %v", DefaultResultCount, len(websites))
+	}
+	checkWebsites(t, websites[:2], []Website{
+		{URL: "https://www.example.com/a", Title: "A", Description: "first result", WebsiteName: "example.com"},
+		{URL: "https://b.example.org/", Title: "B", Description: "second result", WebsiteName: "b.example.org"},
+	})
+}
+
+func TestSearxngProviderErrors(t *testing.T) {
+	// instances without the JSON format enabled reply with 403 Forbidden
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	t.Cleanup(server.Close)
+	if _, err := (&SearxngProvider{BaseURL: server.URL}).Search(context.Background(), "golang", SearchOptions{}); err == nil {
+		t.Error("expected an error for a non-200 response")
+	}
+}
+
+const duckDuckGoTestPage = `<!DOCTYPE html>
+<html><body>
+<div class="serp__results">
+  <div class="result results_links results_links_deep result--ad">
+    <div class="links_main links_deep result__body">
+      <h2 class="result__title"><a class="result__a" href="https://duckduckgo.com/y.js?ad_provider=x">Buy stuff</a></h2>
+      <a class="result__snippet" href="#">An ad</a>
+    </div>
+  </div>
+  <div class="result results_links results_links_deep web-result">
+    <div class="links_main links_deep result__body">
+      <h2 class="result__title">
+        <a rel="nofollow" class="result__a" href="//duckduckgo.com/l/?uddg=https%3A%2F%2Fgo.dev%2Fdoc%2F&amp;rut=abc">The <b>Go</b> Documentation</a>
+      </h2>
+      <div class="result__extras"><a class="result__url" href="#">go.dev/doc</a></div>
+      <a class="result__snippet" href="#">Learn   <b>Go</b>
+        from the docs.</a>
+    </div>
+  </div>
+  <div class="result results_links results_links_deep web-result">
+    <div class="links_main links_deep result__body">
+      <h2 class="result__title"><a class="result__a" href="https://www.example.com/go">Example</a></h2>
+    </div>
+  </div>
+</div>
+</body></html>`
+
+func TestDuckDuckGoProvider(t *testing.T) {
+	var got *http.Request
+	server := newSearchServer(t, "text/html", duckDuckGoTestPage, func(r *http.Request) { got = r })
+
+	p := &DuckDuckGoProvider{BaseURL: server.URL + "/html/"}
+	websites, err := p.Search(context.Background(), "golang docs", SearchOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.URL.Query().Get("q") != "golang docs" {
+		t.Errorf("unexpected request: %v", got.URL)
+	}
+	checkWebsites(t, websites, []Website{
+		{URL: "https://go.dev/doc/", Title: "The Go Documentation", Description: "Learn Go from the docs.", WebsiteName: "go.dev"},
+		{URL: "https://www.example.com/go", Title: "Example", WebsiteName: "example.com"},
+	})
+}
+
+func TestProviderByName(t *testing.T) {
+	prevURL := config.SEARXNG_URL
+	config.SEARXNG_URL = "http://searx.local"
+	t.Cleanup(func() { config.SEARXNG_URL = prevURL })
+
+	for name, expected := range map[string]string{"": "brave", "brave": "brave", "searxng": "searxng", "duckduckgo": "duckduckgo"} {
+		p, err := ProviderByName(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if p.Name() != expected {
+			t.Errorf("%q: expected the %s provider, got %s", name, expected, p.Name())
+		}
+	}
+	if p, _ := ProviderByName("searxng"); p.(*SearxngProvider).BaseURL != "http://searx.local" {
+		t.Errorf("expected the configured SearXNG URL")
+	}
+	if _, err := ProviderByName("altavista"); err == nil {
+		t.Error("expected an error for an unknown provider")
+	}
+
+	// WebSearch uses the provider that was set
+	server := newSearchServer(t, "text/html", duckDuckGoTestPage, nil)
+	SetProvider(&DuckDuckGoProvider{BaseURL: server.URL})
+	t.Cleanup(func() { SetProvider(nil) })
+	websites, err := WebSearch(context.Background(), "go", SearchOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(websites) != 2 {
+		t.Errorf("expected 2 websites, got %+v", websites)
+	}
+}
+
+func TestSearchOptions(t *testing.T) {
+	opts := SearchOptions{Count: 3, Country: "DE", Language: "de", Freshness: "week", Page: 2}
+
+	var got *http.Request
+	server := newSearchServer(t, "application/json", `{"web": {"results": []}, "results": []}`, func(r *http.Request) { got = r })
+	tests := []struct {
+		provider SearchProvider
+		expected map[string]string
+	}{
+		{&BraveProvider{APIKey: "test-key", BaseURL: server.URL}, map[string]string{"count": "3", "country": "de", "search_lang": "de", "freshness": "pw", "offset": "2"}},
+		{&SearxngProvider{BaseURL: server.URL}, map[string]string{"language": "de-DE", "time_range": "week", "pageno": "3"}},
+	}
+	for _, tt := range tests {
+		// don't wait on the Brave rate limit
+		lastBraveAPICall = time.Time{}
+		if _, err := tt.provider.Search(context.Background(), "golang", opts); err != nil {
+			t.Fatal(err)
+		}
+		for key, value := range tt.expected {
+			if got.URL.Query().Get(key) != value {
+				t.Errorf("%s: expected %s=%s, got %v", tt.provider.Name(), key, value, got.URL.RawQuery)
+			}
+		}
+	}
+
+	// DuckDuckGo has no count parameter, so results are skipped and capped on our end
+	server = newSearchServer(t, "text/html", duckDuckGoTestPage, func(r *http.Request) { got = r })
+	websites, err := (&DuckDuckGoProvider{BaseURL: server.URL}).Search(context.Background(), "golang", SearchOptions{Count: 1, Country: "us", Freshness: "day", Page: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(websites) != 1 {
+		t.Errorf("expected 1 website, got %+v", websites)
+	}
+	if q := got.URL.Query(); q.Get("kl") != "us-en" || q.Get("df") != "d" || q.Get("s") != "2" {
+		t.Errorf("duckduckgo: unexpected request: %v", got.URL.RawQuery)
+	}
+
+	for _, invalid := range []SearchOptions{{Count: -1}, {Page: -1}, {Country: "usa"}, {Language: "english"}, {Freshness: "hour"}} {
+		if err := invalid.Validate(); err == nil {
+			t.Errorf("expected an error for %+v", invalid)
+		}
+	}
+}
+
+func TestDuckDuckGoRegion(t *testing.T) {
+	tests := map[SearchOptions]string{
+		{}:                              "",
+		{Language: "en"}:                "us-en",
+		{Language: "fr"}:                "fr-fr",
+		{Country: "gb"}:                 "uk-en",
+		{Country: "de"}:                 "de-de",
+		{Country: "ch", Language: "fr"}: "ch-fr",
+	}
+	for opts, expected := range tests {
+		if region := duckDuckGoRegion(opts); region != expected {
+			t.Errorf("%+v: expected %q, got %q", opts, expected, region)
+		}
+	}
+}
@@ -0,0 +1,247 @@
+package websearch
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// the product token we look for in robots.txt files
+const robotsAgent = "caius"
+
+// robots.txt files larger than this are cut off (the minimum that RFC 9309 says crawlers should read)
+const maxRobotsBytes = 500 * 1024
+
+// robotsEntry is the cached robots.txt of a host. It's only fetched once, even if several pages of the host are fetched at the same time:
+// the others wait for done to be closed.
+type robotsEntry struct {
+	done  chan struct{}
+	rules *robotsRules
+	err   error
+}
+
+// robotsRules are the rules of a robots.txt file that apply to us
+type robotsRules struct {
+	rules    []robotsRule
+	allowAll bool
+	denyAll  bool
+}
+
+type robotsRule struct {
+	allow   bool
+	pattern string
+}
+
+// checkRobots gives ErrDisallowedByRobots if the host's robots.txt doesn't allow us to fetch the URL
+func (f *Fetcher) checkRobots(ctx context.Context, u *url.URL) error {
+	if u.Path == "/robots.txt" {
+		return nil
+	}
+	origin := u.Scheme + "://" + u.Host
+
+	entry, err := f.robotsFor(ctx, origin)
+	if err != nil {
+		return err
+	}
+	if !entry.rules.allowed(u.EscapedPath(), u.RawQuery) {
+		return fmt.Errorf("%s: %w", u, ErrDisallowedByRobots)
+	}
+	return nil
+}
+
+// robotsFor gives the robots.txt of a website, fetching it if it isn't cached yet.
+// No lock is held while it's being fetched; other callers wait for it on the entry instead.
+func (f *Fetcher) robotsFor(ctx context.Context, origin string) (*robotsEntry, error) {
+	for {
+		f.mutex.Lock()
+		if f.robots == nil {
+			f.robots = map[string]*robotsEntry{}
+		}
+		entry, ok := f.robots[origin]
+		if !ok {
+			entry = &robotsEntry{done: make(chan struct{})}
+			f.robots[origin] = entry
+		}
+		f.mutex.Unlock()
+
+		if !ok {
+			entry.rules, entry.err = f.fetchRobots(ctx, origin)
+			if entry.err != nil {
+				// it only fails if the fetch was cancelled; the next one tries again
+				f.mutex.Lock()
+				delete(f.robots, origin)
+				f.mutex.Unlock()
+			}
+			close(entry.done)
+			return entry, entry.err
+		}
+
+		select {
+		case <-entry.done:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		if entry.err == nil {
+			return entry, nil
+		}
+		// the fetch we waited on was cancelled, but we weren't; try again
+	}
+}
+
+// fetchRobots fetches and parses the robots.txt of a website.
+// Following RFC 9309, a missing robots.txt allows everything, and one that can't be reached (a server error) allows nothing.
+func (f *Fetcher) fetchRobots(ctx context.Context, origin string) (*robotsRules, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", origin+"/robots.txt", nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", userAgent)
+
+	// robots.txt itself can't be disallowed, so its redirects are simply followed
+	resp, err := f.client(true).Do(req)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return &robotsRules{denyAll: true}, nil
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 500 {
+		return &robotsRules{denyAll: true}, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return &robotsRules{allowAll: true}, nil
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxRobotsBytes))
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return &robotsRules{denyAll: true}, nil
+	}
+	return parseRobots(string(body), robotsAgent), nil
+}
+
+// parseRobots gives the rules of a robots.txt file for an agent: the rules of the groups that name the agent,
+// or if there aren't any, the rules of the groups for all agents (*).
+func parseRobots(robotsTxt string, agent string) *robotsRules {
+	type group struct {
+		agents []string
+		rules  []robotsRule
+	}
+	groups := []*group{}
+	var current *group
+	inAgents := false // if the last line was a user-agent line, in which case the next one adds to the same group
+
+	for _, line := range strings.Split(robotsTxt, "\n") {
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		value = strings.TrimSpace(value)
+
+		switch key {
+		case "user-agent":
+			if !inAgents {
+				current = &group{}
+				groups = append(groups, current)
+			}
+			current.agents = append(current.agents, strings.ToLower(value))
+			inAgents = true
+		case "allow", "disallow":
+			inAgents = false
+			// rules before any user-agent line, and empty rules (which allow everything) don't count
+			if current == nil || value == "" {
+				continue
+			}
+			current.rules = append(current.rules, robotsRule{allow: key == "allow", pattern: value})
+		default:
+			inAgents = false
+		}
+	}
+
+	matching := func(match func(string) bool) *robotsRules {
+		var rules *robotsRules
+		for _, g := range groups {
+			for _, a := range g.agents {
+				if match(a) {
+					if rules == nil {
+						rules = &robotsRules{}
+					}
+					rules.rules = append(rules.rules, g.rules...)
+					break
+				}
+			}
+		}
+		return rules
+	}
+	if rules := matching(func(a string) bool { return a == strings.ToLower(agent) }); rules != nil {
+		return rules
+	}
+	if rules := matching(func(a string) bool { return a == "*" }); rules != nil {
+		return rules
+	}
+	return &robotsRules{allowAll: true}
+}
+
+// allowed reports if a path may be fetched. The longest matching rule wins, and allow rules win ties.
+func (r *robotsRules) allowed(path string, query string) bool {
+	if r.allowAll {
+		return true
+	}
+	if r.denyAll {
+		return false
+	}
+	if path == "" {
+		path = "/"
+	}
+	if query != "" {
+		path += "?" + query
+	}
+	allow := true
+	longest := -1
+	for _, rule := range r.rules {
+		if !robotsMatch(rule.pattern, path) {
+			continue
+		}
+		if len(rule.pattern) > longest || (len(rule.pattern) == longest && rule.allow) {
+			allow = rule.allow
+			longest = len(rule.pattern)
+		}
+	}
+	return allow
+}
+
+// robotsMatch reports if a robots.txt path pattern matches a path. Patterns match the start of the path,
+// "*" matches any characters, and a "$" at the end matches the end of the path.
+func robotsMatch(pattern string, path string) bool {
+	anchored := strings.HasSuffix(pattern, "$")
+	pattern = strings.TrimSuffix(pattern, "$")
+	parts := strings.Split(pattern, "*")
+
+	if !strings.HasPrefix(path, parts[0]) {
+		return false
+	}
+	pos := len(parts[0])
+	for i, part := range parts[1:] {
+		if anchored && i == len(parts)-2 {
+			// the last part has to be at the end of the path
+			return strings.HasSuffix(path[pos:], part)
+		}
+		j := strings.Index(path[pos:], part)
+		if j < 0 {
+			return false
+		}
+		pos += j + len(part)
+	}
+	return !anchored || pos == len(path)
+}
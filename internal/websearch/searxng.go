@@ -0,0 +1,91 @@
+package websearch
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/webbben/caius/internal/utils"
+)
+
+// SearxngProvider searches with a (usually self-hosted) SearXNG instance, through its JSON API.
+// The instance needs to have the JSON format enabled (search.formats in its settings.yml).
+type SearxngProvider struct {
+	BaseURL string // e.g. "http://localhost:8888"
+	Client  *http.Client
+}
+
+type searxngResults struct {
+	Results []struct {
+		URL     string `json:"url"`
+		Title   string `json:"title"`
+		Content string `json:"content"`
+	} `json:"results"`
+}
+
+func (s *SearxngProvider) Name() string {
+	return "searxng"
+}
+
+func (s *SearxngProvider) Search(ctx context.Context, query string, opts SearchOptions) ([]Website, error) {
+	u, err := url.Parse(strings.TrimSuffix(s.BaseURL, "/") + "/search")
+	if err != nil {
+		return nil, utils.WrapError("searxng: invalid URL", err)
+	}
+	q := u.Query()
+	q.Set("q", query)
+	q.Set("format", "json")
+	if lang := searxngLanguage(opts); lang != "" {
+		q.Set("language", lang)
+	}
+	if opts.Freshness != "" {
+		q.Set("time_range", opts.Freshness)
+	}
+	// SearXNG pages are a fixed size, which depends on the engines it uses; we take the first count results of a page
+	q.Set("pageno", strconv.Itoa(opts.Page+1))
+	u.RawQuery = q.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, "GET", u.String(), nil)
+	if err != nil {
+		return nil, utils.WrapError("searxng: error creating request", err)
+	}
+	req.Header.Set("Accept", "application/json")
+
+	body, err := doSearchRequest(s.Client, req, "searxng")
+	if err != nil {
+		return nil, err
+	}
+	var results searxngResults
+	if err := json.Unmarshal(body, &results); err != nil {
+		return nil, utils.WrapError("searxng: error on unmarshalling search results (is the JSON format enabled?)", err)
+	}
+
+	websites := []Website{}
+	for _, result := range results.Results {
+		if len(websites) == opts.count() {
+			break
+		}
+		websites = append(websites, Website{
+			URL:         result.URL,
+			Title:       result.Title,
+			Description: strings.TrimSpace(result.Content),
+			WebsiteName: siteName(result.URL),
+		})
+	}
+	return websites, nil
+}
+
+// searxngLanguage gives the language (e.g. "en") or locale (e.g. "en-US") to search in.
+// SearXNG has no separate country parameter, so the country only counts along with a language.
+func searxngLanguage(opts SearchOptions) string {
+	if opts.Language == "" {
+		return ""
+	}
+	if opts.Country == "" {
+		return strings.ToLower(opts.Language)
+	}
+	return strings.ToLower(opts.Language) + "-" + strings.ToUpper(opts.Country)
+}
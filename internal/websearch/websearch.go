@@ -1,201 +1,131 @@
 package websearch
 
 import (
-	"encoding/json"
-	"errors"
+	"context"
 	"fmt"
-	"io"
 	"log"
-	"net/http"
-	"net/url"
 	"os"
-	"sync"
-	"time"
 
+	"github.com/webbben/caius/internal/config"
 	"github.com/webbben/caius/internal/llm"
 	"github.com/webbben/caius/internal/utils"
 	"github.com/webbben/caius/prompts"
 )
 
-var lastBraveAPICall time.Time
-var braveAPIRate time.Duration = time.Second + (time.Millisecond * 50)
-var braveAPICallMutex sync.Mutex
-
-type searchResult struct {
-	Title         string `json:"title"`
-	Url           string `json:"url"`
-	IsSourceLocal bool   `json:"is_source_local"`
-	IsSourceBoth  bool   `json:"is_source_both"`
-	Description   string `json:"description"`
-	Profile       struct {
-		Name     string `json:"name"`
-		Url      string `json:"url"`
-		LongName string `json:"long_name"`
-		Img      string `json:"img"`
-	} `json:"profile"`
-}
-
-type braveSearchResults struct {
-	Type string `json:"type"`
-	Web  struct {
-		Type    string         `json:"type"`
-		Results []searchResult `json:"results"`
-	} `json:"web"`
-}
-
-// find API key from env variable
-func getBraveSearchAPIKey() string {
-	val, _ := os.LookupEnv("BRAVE_SEARCH_API_KEY")
-	return val
+// Website is a single search result. Every search provider gives its results in this form.
+type Website struct {
+	URL         string `json:"url"`
+	Title       string `json:"title"`
+	Description string `json:"description,omitempty"`
+	WebsiteName string `json:"website_name,omitempty"`
 }
 
-func callBraveSearchAPI(searchPhrase string) (braveSearchResults, error) {
-	apiKey := getBraveSearchAPIKey()
-	if apiKey == "" {
-		return braveSearchResults{}, errors.New("failed to get brave search API Key")
-	}
-
-	u, err := url.Parse("https://api.search.brave.com/res/v1/web/search")
-	if err != nil {
-		return braveSearchResults{}, err
-	}
-	q := u.Query()
-	q.Set("q", searchPhrase)
-	q.Set("count", "5")
-	q.Set("country", "us")
-	q.Set("search_lang", "en")
-	u.RawQuery = q.Encode()
-
-	req, err := http.NewRequest("GET", u.String(), nil)
-	if err != nil {
-		return braveSearchResults{}, utils.WrapError("error on requesting Brave Search API", err)
-	}
-	req.Header.Set("X-Subscription-Token", apiKey)
-
-	// make sure we aren't calling the API more than once per second
-	braveAPICallMutex.Lock()
-	if time.Since(lastBraveAPICall) < braveAPIRate {
-		time.Sleep(braveAPIRate - time.Since(lastBraveAPICall))
+// WebSearch searches the web with the current search provider (see SetProvider).
+func WebSearch(ctx context.Context, searchPhrase string, opts SearchOptions) ([]Website, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, err
 	}
-
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil {
-		return braveSearchResults{}, utils.WrapError("error on requesting Brave Search API", err)
-	}
-	defer resp.Body.Close()
-	lastBraveAPICall = time.Now()
-	braveAPICallMutex.Unlock()
-
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return braveSearchResults{}, utils.WrapError("error on reading Brave Search API response body", err)
-	}
-	var results braveSearchResults
-	err = json.Unmarshal(body, &results)
+	p, err := GetProvider()
 	if err != nil {
-		return results, utils.WrapError("error on unmarshalling Brave Search API response data", err)
+		return nil, err
 	}
-
-	return results, nil
-}
-
-type Website struct {
-	URL         string
-	Title       string
-	Description string
-	WebsiteName string
-}
-
-func WebSearch(searchPhrase string) ([]Website, error) {
-	searchResults, err := callBraveSearchAPI(searchPhrase)
+	websites, err := p.Search(ctx, searchPhrase, opts)
 	if err != nil {
-		return []Website{}, err
+		return nil, err
 	}
-
-	websites := []Website{}
-	for _, result := range searchResults.Web.Results {
-		websites = append(websites, Website{
-			URL:         result.Url,
-			Title:       result.Title,
-			Description: RemoveAllHTML(result.Description),
-			WebsiteName: result.Profile.Name,
-		})
+	// not every provider lets us set the number of results
+	if len(websites) > opts.count() {
+		websites = websites[:opts.count()]
 	}
-
 	return websites, nil
 }
 
-func fetchURL(url string) (string, error) {
-	client := &http.Client{
-		Timeout: 10 * time.Second,
-	}
-
-	req, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		return "", err
-	}
-	req.Header.Set("User-Agent", "Mozilla/5.0 (compatible; Caius/1.0)")
+// fetchURL downloads a web page with the shared Fetcher (see Fetcher.Fetch)
+func fetchURL(ctx context.Context, url string) (string, error) {
+	return getFetcher().Fetch(ctx, url)
+}
 
-	resp, err := client.Do(req)
+// FetchText fetches a web page, and gives the text of its main content.
+func FetchText(ctx context.Context, pageURL string) (string, error) {
+	rawHTML, err := fetchURL(ctx, pageURL)
 	if err != nil {
 		return "", err
 	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("HTTP error: %s", resp.Status)
-	}
+	return extractBodyText(rawHTML)
+}
 
-	bodyBytes, err := io.ReadAll(resp.Body)
+// FetchMarkdown fetches a web page, and gives its main content as Markdown.
+func FetchMarkdown(ctx context.Context, pageURL string) (string, error) {
+	rawHTML, err := fetchURL(ctx, pageURL)
 	if err != nil {
 		return "", err
 	}
-
-	return string(bodyBytes), nil
+	return extractMarkdown(rawHTML, pageURL)
 }
 
-func SummarizeWebsite(website Website) (string, error) {
-	rawHTML, err := fetchURL(website.URL)
+// SummarizeWebsite has the LLM summarize the main content of a website. The content is given to it as Markdown,
+// so it can see the page's structure (headings, lists, code, etc.)
+func SummarizeWebsite(ctx context.Context, website Website) (string, error) {
+	rawHTML, err := fetchURL(ctx, website.URL)
 	if err != nil {
 		return "", err
 	}
+	return summarizePage(ctx, website, rawHTML)
+}
 
+func summarizePage(ctx context.Context, website Website, rawHTML string) (string, error) {
 	utils.WriteLogs(rawHTML)
 
-	bodyText, err := extractBodyText(rawHTML)
+	bodyText, err := extractMarkdown(rawHTML, website.URL)
 	if err != nil {
 		return "", err
 	}
 
 	utils.WriteLogs(bodyText)
 
-	utils.Terminal.Lowkey("\n\n" + bodyText)
-
 	prompt := fmt.Sprintf("Website: %s\nTitle: %s\n\n%s", website.WebsiteName, website.Title, bodyText)
 
-	aiSummary, err := llm.GenerateSimpleCompletion(prompts.P_SUMMARIZE_WEBSITE, prompt)
+	aiSummary, err := llm.GenerateSimpleCompletionWithModel(ctx, config.WEBSITE_SUMMARY_MODEL, prompts.P_SUMMARIZE_WEBSITE, prompt)
+	if err != nil {
+		return "", err
+	}
 
 	return aiSummary, nil
 }
 
-func SummarizeListOfWebsites(websites []Website) (string, error) {
+// SummarizeListOfWebsites summarizes each website, and then combines the summaries into a single report.
+// The websites are all downloaded in parallel first (see Fetcher.FetchAll), and then summarized one by one.
+// If fn is set, the report is streamed to it as it's generated. Progress is shown on stderr.
+func SummarizeListOfWebsites(ctx context.Context, websites []Website, fn llm.StreamFunc) (string, error) {
+	urls := make([]string, len(websites))
+	for i, website := range websites {
+		urls[i] = website.URL
+	}
+	pages := getFetcher().FetchAll(ctx, urls)
+	if ctx.Err() != nil {
+		return "", ctx.Err()
+	}
+
 	summaries := ""
-	llm.SetModel(llm.Models.Llama3)
 	for i, website := range websites {
-		summary, err := SummarizeWebsite(website)
+		if pages[i].Err != nil {
+			log.Printf("error fetching website %s: %v", website.URL, pages[i].Err)
+			continue
+		}
+		summary, err := summarizePage(ctx, website, pages[i].HTML)
 		if err != nil {
+			if ctx.Err() != nil {
+				return "", ctx.Err()
+			}
 			log.Println("error summarizing website:", err)
 			continue
 		}
 		summaries += summary + "\n---\n"
-		utils.Terminal.Lowkey(fmt.Sprintf("[%v / %v] Website summarized", i+1, len(websites)))
+		fmt.Fprintln(os.Stderr, utils.Terminal.LowkeyS(fmt.Sprintf("[%v / %v] Website summarized", i+1, len(websites))))
 	}
-
-	fmt.Println()
-	utils.Terminal.Lowkey(summaries)
-	fmt.Println()
+	utils.WriteLogs(summaries)
 
 	// summarize all of the summaries
-	llm.SetModel(llm.Models.DeepSeek14b)
-	return llm.GenerateSimpleCompletion(prompts.P_SUMMARIZE_WEBSITE_LIST, summaries)
+	report, err := llm.GenerateSimpleCompletionStream(ctx, config.WEBSITE_LIST_SUMMARY_MODEL, prompts.P_SUMMARIZE_WEBSITE_LIST, summaries, fn)
+	return report.Answer, err
 }
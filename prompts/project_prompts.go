@@ -54,6 +54,7 @@ var P_ANALYZE_FILE_MAP_01 string = `
 You are an assistant that analyzes a directory and all the files within, and gives a description of its overall purpose or content.
 
 You will be given a list of all files under a directory. For each file, the type of file and a short description is also included.
+For large projects, some entries may be subdirectories (marked as "directory") with a summary of their contents instead of their individual files.
 Analyze all the different files and their descriptions, and give an overall description of the purpose or content of the directory as a whole.
 
 Guidelines for describing the project:
@@ -63,6 +64,51 @@ Guidelines for describing the project:
 - Give at least 2 sentences in the description.
 `
 
+// for summarizing one section of a file that is too large to analyze all at once
+var P_ANALYZE_FILE_CHUNK_01 string = `
+You are an assistant that analyzes one section of a large file, and describes what that section contains.
+
+You will be given the name and type of the file, which section of the file you are looking at, and the content of that section.
+The section may start or end in the middle of a function, class, paragraph, etc.
+
+Give a short description of the section:
+
+- If the section contains code, describe the functions, types or logic it defines.
+- If the section contains other textual content, summarize the information it contains.
+- Limit your description to 1 or 2 sentences.
+`
+
+// for analyzing a large file, given summaries of each of its sections (see P_ANALYZE_FILE_CHUNK_01)
+var P_ANALYZE_FILE_CHUNKS_01 string = `
+You are an assistant that analyzes files and describes their contents and purpose.
+
+The file was too large to read all at once, so instead you will be given summaries of each section of the file, in order.
+Based on these summaries, tell me the following information:
+
+- Type: the type of file and its data (e.g. "javascript", "python", "yaml", "markdown").
+- Description: an overall description of what the file contains.
+
+When giving the description:
+
+- Describe the file as a whole, rather than listing each section.
+- If the file contains code, focus on describing the overall functionality of the code.
+- Try to limit your descriptions to 2 or 3 sentences at most.
+`
+
+// for summarizing a single directory, as part of "compressing" a large project before describing it as a whole
+var P_SUMMARIZE_DIRECTORY_01 string = `
+You are an assistant that summarizes the contents of a directory within a larger project.
+
+You will be given a list of the files in the directory, along with the type and a short description of each file.
+The list may also include subdirectories (marked as "directory"), along with a summary of what they contain.
+
+Give a short description of the overall purpose of the directory:
+
+- Focus on what the directory is responsible for within the project, rather than listing every file.
+- Mention important technologies or frameworks if they are apparent.
+- Limit your description to 2 or 3 sentences at most.
+`
+
 // for detecting the type of a file (without returning a description)
 var P_ANALYZE_FILE_TYPE_01 string = `
 Given a snippet of file content, tell me what type of data it is out of the following categories:
@@ -80,7 +126,7 @@ Tell me the "category" from the list above, and then give the specific "type":
 `
 
 var P_SUMMARIZE_WEBSITE string = `
-Given the content of a website, summarize its content.
+Given the content of a website (in Markdown), summarize its content.
 `
 
 var P_SUMMARIZE_WEBSITE_LIST string = `